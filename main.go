@@ -30,12 +30,15 @@ import (
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	"hsnlab/dcontroller/internal/buildinfo"
 	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	dcontroller "hsnlab/dcontroller/pkg/controller"
 	"hsnlab/dcontroller/pkg/operator"
 )
 
@@ -52,14 +55,23 @@ func init() {
 }
 
 func main() {
-	var metricsAddr, probeAddr string
-	var enableLeaderElection bool
+	var metricsAddr, probeAddr, stateDir, stateNamespace string
+	var enableLeaderElection, secureMetrics, enableTraceEndpoint bool
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&secureMetrics, "metrics-secure", false,
+		"Serve the metrics endpoint via HTTPS, with authentication and authorization.")
+	flag.BoolVar(&enableTraceEndpoint, "enable-trace-endpoint", false,
+		"Expose the pipeline traces at "+operator.TraceEndpoint+" on the metrics server. "+
+			"Use with --metrics-secure to restrict access to authorized users.")
+	flag.StringVar(&stateDir, "state-dir", "",
+		"Persist the state of the controllers into files in the given directory.")
+	flag.StringVar(&stateNamespace, "state-namespace", "",
+		"Persist the state of the controllers into ConfigMaps in the given namespace.")
 
 	opts := zap.Options{
 		Development:     true,
@@ -77,14 +89,44 @@ func main() {
 	buildInfo := buildinfo.BuildInfo{Version: version, CommitHash: commitHash, BuildDate: buildDate}
 	setupLog.Info(fmt.Sprintf("starting the dcontroller %s", buildInfo.String()))
 
-	c, err := operator.NewController(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme: scheme,
-		Metrics: metricsserver.Options{
-			BindAddress: metricsAddr,
+	config := ctrl.GetConfigOrDie()
+
+	var state dcontroller.StateBackend
+	switch {
+	case stateDir != "" && stateNamespace != "":
+		setupLog.Error(nil, "at most one of --state-dir and --state-namespace can be set")
+		os.Exit(1)
+	case stateDir != "":
+		state = dcontroller.NewFileStateBackend(stateDir)
+	case stateNamespace != "":
+		// the state is only read on startup: use a direct client instead of watching all ConfigMaps
+		c, err := client.New(config, client.Options{Scheme: scheme})
+		if err != nil {
+			setupLog.Error(err, "unable to set up state backend")
+			os.Exit(1)
+		}
+		state = dcontroller.NewConfigMapStateBackend(c, stateNamespace)
+	}
+
+	metricsOpts := metricsserver.Options{
+		BindAddress: metricsAddr,
+	}
+	if secureMetrics {
+		// the filter is applied to the trace endpoint as well
+		metricsOpts.SecureServing = true
+		metricsOpts.FilterProvider = filters.WithAuthenticationAndAuthorization
+	}
+
+	c, err := operator.NewController(config, operator.ControllerOptions{
+		Options: ctrl.Options{
+			Scheme:                 scheme,
+			Metrics:                metricsOpts,
+			HealthProbeBindAddress: probeAddr,
+			LeaderElection:         enableLeaderElection,
+			LeaderElectionID:       "92062b70.dcontroller.io",
 		},
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "92062b70.dcontroller.io",
+		StateBackend:        state,
+		EnableTraceEndpoint: enableTraceEndpoint,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to set up dcontroller")
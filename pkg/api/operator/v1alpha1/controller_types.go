@@ -22,17 +22,53 @@ type Controller struct {
 	Pipeline Pipeline `json:"pipeline"`
 	// The target resource the results are to be added.
 	Target Target `json:"target"`
+	// CoalesceWindow is an optional time window to collect the events of the sources before
+	// processing them. Successive events on the same object within the window are merged, e.g.,
+	// an add followed by an update becomes an add and an update followed by a delete becomes a
+	// delete, and the resultant writes to the target are merged likewise. Useful to absorb bursts
+	// of updates at the cost of added latency. Default is to process each event immediately.
+	CoalesceWindow *metav1.Duration `json:"coalesceWindow,omitempty"`
+	// Workers is the number of concurrent workers fetching the source objects and writing to the
+	// target. The requests on the same object are always processed in order by the same worker,
+	// while the pipeline itself is evaluated sequentially. Default is 1, i.e., the requests are
+	// processed synchronously.
+	// +kubebuilder:validation:Minimum=1
+	Workers *int32 `json:"workers,omitempty"`
 }
 
-// Pipeline is an optional join followed by an aggregation.
+// Pipeline is an optional join followed by an aggregation, or a sequence of such steps with named
+// intermediate results.
 type Pipeline struct {
 	*Join        `json:",inline"`
 	*Aggregation `json:",inline"`
+	// Steps is a chain of join/aggregation steps. The output of each step is an intermediate view
+	// named after the step that can be used as an input in subsequent steps, and the output of
+	// the last step is written into the target. Steps cannot be combined with a top-level join or
+	// aggregation.
+	Steps []Step `json:"@steps,omitempty"`
+}
+
+// Step is a single stage in a chained pipeline.
+type Step struct {
+	// Name is the name of the intermediate view the step writes into. Mandatory for all but the
+	// last step.
+	Name string `json:"name,omitempty"`
+	// Sources lists the inputs of the step by name: either the name of a controller source (its
+	// alias or Kind) or the name of a previous step. Default is all controller sources for the
+	// first step and the previous step otherwise.
+	Sources      []string `json:"sources,omitempty"`
+	*Join        `json:",inline"`
+	*Aggregation `json:",inline"`
 }
 
 // Join is an operation that can be used to perform an inner join on a list of views.
 type Join struct {
 	Expression expression.Expression `json:"@join"`
+	// ID is an optional expression to generate the identity of the join results. The expression
+	// is evaluated on the join input and it must yield either a string, used as the name of the
+	// result, or a map with a string "name" and an optional "namespace" key. Default is a hash
+	// of the keys of the joined objects.
+	ID *expression.Expression `json:"@id,omitempty"`
 }
 
 // Aggregation is an operation that can be used to process, objects, or alter the shape of a list
@@ -54,6 +90,10 @@ type Resource struct {
 // Source is a watch source that feeds deltas into the controller.
 type Source struct {
 	Resource `json:",inline"`
+	// Alias is an optional name for the objects of the source in the join input. Default is the
+	// Kind of the resource. Aliases must be used when joining a resource with itself or when
+	// joining resources of the same Kind from different API groups.
+	Alias *string `json:"alias,omitempty"`
 	// Namespace, if given, restricts the source to generate events only from the given namespace.
 	Namespace *string `json:"namespace,omitempty"`
 	// LabelSelector is an optional label selector to filter events on this source.
@@ -63,6 +103,11 @@ type Source struct {
 	// +kubebuilder:validation:Schemaless
 	// +kubebuilder:pruning:PreserveUnknownFields
 	Predicate *predicate.Predicate `json:"predicate,omitempty"`
+	// Finalizer is an optional finalizer the controller adds to the objects of the source, e.g.,
+	// to clean up external state when an object is deleted. Objects with a deletion timestamp
+	// are processed as deleted and the finalizer is removed only after all the resultant writes
+	// to the target have succeeded. Not supported for views.
+	Finalizer *string `json:"finalizer,omitempty"`
 }
 
 // Target is the target reource type in which the controller writes.
@@ -70,8 +115,31 @@ type Target struct {
 	Resource `json:",inline"`
 	// Type is the type of the target.
 	Type TargetType `json:"type,omitempty"`
+	// Subresource is the subresource of the target to write. The only supported subresource is
+	// "status": the output is written into the status of the target through the status
+	// subresource, e.g., to update the status of a custom resource, while the rest of the target
+	// is left intact. Supported for Updater and Patcher targets. Default is to write the main
+	// resource.
+	//
+	// +kubebuilder:validation:Enum=status
+	Subresource string `json:"subresource,omitempty"`
+	// Owner is an optional expression that yields the owner of the objects written into the
+	// target. The expression is evaluated on the input of the aggregation of the (last step of
+	// the) pipeline, i.e., on the join row or the source object, and it must yield either a
+	// Kubernetes object, e.g., a source object in the join row like $.ConfigDeployment, or an
+	// explicit reference given as a map with an "apiVersion", a "kind", a "name" and optionally a
+	// "uid". The objects are written with a controller owner reference to the owner, so that the
+	// Kubernetes garbage collector removes them with the owner. The UID of explicit references is
+	// resolved from the cache. Cannot be used with grouping stages.
+	//
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Owner *expression.Expression `json:"owner,omitempty"`
 }
 
+// StatusSubresource is the name of the status subresource.
+const StatusSubresource = "status"
+
 // TargetType represents the type of a target.
 type TargetType string
 
@@ -80,4 +148,7 @@ const (
 	Updater TargetType = "Updater"
 	// Patcher is a target that applies the update as a patch to the target resource.
 	Patcher TargetType = "Patcher"
+	// Applier is a target that writes the update into the target resource using server-side
+	// apply, under a field manager specific to the controller.
+	Applier TargetType = "Applier"
 )
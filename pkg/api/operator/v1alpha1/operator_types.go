@@ -58,6 +58,9 @@ type ControllerStatus struct {
 	Name       string             `json:"name"`
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 	LastErrors []string           `json:"lastErrors,omitempty"`
+	// FailedKeys lists the objects whose processing or target write has permanently failed
+	// after all retries.
+	FailedKeys []string `json:"failedKeys,omitempty"`
 }
 
 // ControllerConditionType is a type of condition associated with a Controller. This type should be
@@ -60,6 +60,16 @@ func (in *Controller) DeepCopyInto(out *Controller) {
 	}
 	in.Pipeline.DeepCopyInto(&out.Pipeline)
 	in.Target.DeepCopyInto(&out.Target)
+	if in.CoalesceWindow != nil {
+		in, out := &in.CoalesceWindow, &out.CoalesceWindow
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Workers != nil {
+		in, out := &in.Workers, &out.Workers
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Controller.
@@ -87,6 +97,11 @@ func (in *ControllerStatus) DeepCopyInto(out *ControllerStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.FailedKeys != nil {
+		in, out := &in.FailedKeys, &out.FailedKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ControllerStatus.
@@ -103,6 +118,11 @@ func (in *ControllerStatus) DeepCopy() *ControllerStatus {
 func (in *Join) DeepCopyInto(out *Join) {
 	*out = *in
 	in.Expression.DeepCopyInto(&out.Expression)
+	if in.ID != nil {
+		in, out := &in.ID, &out.ID
+		*out = new(expression.Expression)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Join.
@@ -231,6 +251,13 @@ func (in *Pipeline) DeepCopyInto(out *Pipeline) {
 		*out = new(Aggregation)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]Step, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Pipeline.
@@ -272,6 +299,11 @@ func (in *Resource) DeepCopy() *Resource {
 func (in *Source) DeepCopyInto(out *Source) {
 	*out = *in
 	in.Resource.DeepCopyInto(&out.Resource)
+	if in.Alias != nil {
+		in, out := &in.Alias, &out.Alias
+		*out = new(string)
+		**out = **in
+	}
 	if in.Namespace != nil {
 		in, out := &in.Namespace, &out.Namespace
 		*out = new(string)
@@ -286,6 +318,11 @@ func (in *Source) DeepCopyInto(out *Source) {
 		in, out := &in.Predicate, &out.Predicate
 		*out = (*in).DeepCopy()
 	}
+	if in.Finalizer != nil {
+		in, out := &in.Finalizer, &out.Finalizer
+		*out = new(string)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Source.
@@ -298,10 +335,45 @@ func (in *Source) DeepCopy() *Source {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Step) DeepCopyInto(out *Step) {
+	*out = *in
+	if in.Sources != nil {
+		in, out := &in.Sources, &out.Sources
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Join != nil {
+		in, out := &in.Join, &out.Join
+		*out = new(Join)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Aggregation != nil {
+		in, out := &in.Aggregation, &out.Aggregation
+		*out = new(Aggregation)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Step.
+func (in *Step) DeepCopy() *Step {
+	if in == nil {
+		return nil
+	}
+	out := new(Step)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Target) DeepCopyInto(out *Target) {
 	*out = *in
 	in.Resource.DeepCopyInto(&out.Resource)
+	if in.Owner != nil {
+		in, out := &in.Owner, &out.Owner
+		*out = new(expression.Expression)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Target.
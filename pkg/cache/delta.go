@@ -23,10 +23,12 @@ const (
 // NilDelta is a placeholder for a delta that means no change.
 var NilDelta = Delta{Object: nil}
 
-// Delta registers a change (addition, deletion, etc) on an object. By convention, Object is nil if no change occurs.
+// Delta registers a change (addition, deletion, etc) on an object. By convention, Object is nil if
+// no change occurs. OldObject is the previous version of the object for Updated deltas, if known.
 type Delta struct {
-	Object object.Object
-	Type   DeltaType
+	Object    object.Object
+	OldObject object.Object
+	Type      DeltaType
 }
 
 func (d Delta) IsUnchanged() bool { return d.Object == nil }
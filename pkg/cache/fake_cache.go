@@ -6,6 +6,7 @@ package cache
 import (
 	"context"
 	"errors"
+	"sync"
 	"time"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -28,6 +29,7 @@ type FakeRuntimeCache struct {
 	Error          error
 	Synced         *bool
 	Store          *Store
+	mu             sync.Mutex // guards InformersByGVK
 }
 
 func NewFakeRuntimeCache(s *runtime.Scheme) *FakeRuntimeCache {
@@ -39,6 +41,8 @@ func NewFakeRuntimeCache(s *runtime.Scheme) *FakeRuntimeCache {
 
 // GetInformerForKind implements Informers.
 func (c *FakeRuntimeCache) GetInformerForKind(ctx context.Context, gvk schema.GroupVersionKind, opts ...cache.InformerGetOption) (cache.Informer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if c.InformersByGVK == nil {
 		c.InformersByGVK = map[schema.GroupVersionKind]toolscache.SharedIndexInformer{}
 	}
@@ -68,7 +72,9 @@ func (c *FakeRuntimeCache) RemoveInformer(ctx context.Context, obj client.Object
 		return errors.New("expecting an object.Object")
 	}
 	gvk := u.GroupVersionKind()
+	c.mu.Lock()
 	delete(c.InformersByGVK, gvk)
+	c.mu.Unlock()
 	return nil
 }
 
@@ -200,6 +206,7 @@ type FakeInformer struct {
 	Indexer Lister
 
 	handlers []eventHandlerWrapper
+	mu       sync.Mutex // guards handlers
 }
 
 type modernResourceEventHandler interface {
@@ -266,7 +273,9 @@ func (f *FakeInformer) HasSynced() bool {
 
 // AddEventHandler implements the Informer interface.  Adds an EventHandler to the fake Informers. TODO(community): Implement Registration.
 func (f *FakeInformer) AddEventHandler(handler toolscache.ResourceEventHandler) (toolscache.ResourceEventHandlerRegistration, error) {
+	f.mu.Lock()
 	f.handlers = append(f.handlers, eventHandlerWrapper{handler})
+	f.mu.Unlock()
 
 	for _, item := range f.Indexer.List() {
 		handler.OnAdd(item, true)
@@ -282,25 +291,31 @@ func (f *FakeInformer) Run(<-chan struct{}) {
 
 // Add fakes an Add event for obj.
 func (f *FakeInformer) Add(obj metav1.Object) {
-	for _, h := range f.handlers {
+	for _, h := range f.getHandlers() {
 		h.OnAdd(obj)
 	}
 }
 
 // Update fakes an Update event for obj.
 func (f *FakeInformer) Update(oldObj, newObj metav1.Object) {
-	for _, h := range f.handlers {
+	for _, h := range f.getHandlers() {
 		h.OnUpdate(oldObj, newObj)
 	}
 }
 
 // Delete fakes an Delete event for obj.
 func (f *FakeInformer) Delete(obj metav1.Object) {
-	for _, h := range f.handlers {
+	for _, h := range f.getHandlers() {
 		h.OnDelete(obj)
 	}
 }
 
+func (f *FakeInformer) getHandlers() []eventHandlerWrapper {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]eventHandlerWrapper{}, f.handlers...)
+}
+
 // AddEventHandlerWithResyncPeriod does nothing.  TODO(community): Implement this.
 func (f *FakeInformer) AddEventHandlerWithResyncPeriod(handler toolscache.ResourceEventHandler, _ time.Duration) (toolscache.ResourceEventHandlerRegistration, error) {
 	return f.AddEventHandler(handler)
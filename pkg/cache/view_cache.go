@@ -314,6 +314,19 @@ func (c *ViewCache) Dump(ctx context.Context, gvk schema.GroupVersionKind) []str
 	return ret
 }
 
+// Count returns the number of objects stored in the cache for each view.
+func (c *ViewCache) Count() map[schema.GroupVersionKind]int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ret := make(map[schema.GroupVersionKind]int, len(c.caches))
+	for gvk, indexer := range c.caches {
+		ret[gvk] = len(indexer.ListKeys())
+	}
+
+	return ret
+}
+
 func (c *ViewCache) Watch(ctx context.Context, list client.ObjectList, opts ...client.ListOption) (watch.Interface, error) {
 	gvk := list.GetObjectKind().GroupVersionKind()
 
@@ -6,6 +6,7 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/watch"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -89,6 +90,20 @@ var _ = Describe("ViewCache", func() {
 			Expect(list.Items).To(ContainElement(*objects[2]))
 		})
 
+		It("should count the objects of each view", func() {
+			for _, name := range []string{"test-1", "test-2"} {
+				obj := object.NewViewObject("view")
+				object.SetName(obj, "ns", name)
+				Expect(cache.Add(obj)).To(Succeed())
+			}
+			Expect(cache.RegisterCacheForKind(viewv1a1.NewGVK("other"))).To(Succeed())
+
+			Expect(cache.Count()).To(Equal(map[schema.GroupVersionKind]int{
+				viewv1a1.NewGVK("view"):  2,
+				viewv1a1.NewGVK("other"): 0,
+			}))
+		})
+
 		It("should return an empty list when cache is empty", func() {
 			list := object.NewViewObjectList("view")
 			err := cache.List(ctx, list)
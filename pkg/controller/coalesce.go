@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"context"
+
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/object"
+	"hsnlab/dcontroller/pkg/pipeline"
+	"hsnlab/dcontroller/pkg/reconciler"
+)
+
+// coalesceRequests merges the requests on the same object into a single request that has the same
+// net effect, like pipeline.ConsolidateDeltas does with the deltas, but using whether the pipeline
+// already knows the object instead of the type of the first request, since the events of the
+// sources may not reflect the state of the pipeline (e.g., after a relist or a failed request): a
+// delete is a delete for known objects and cancels out for the objects added in the window only,
+// and an add or an update is an update for known objects and an add for the rest. If the pipeline
+// cannot tell then the objects are assumed to be known unless the first request is an add.
+// Snapshot requests are kept as is. The order of the first occurrence of each object is preserved.
+func coalesceRequests(reqs []reconciler.Request, known func(reconciler.Request) (bool, bool)) []reconciler.Request {
+	type key struct {
+		gvk             string
+		namespace, name string
+	}
+	type net struct{ first, last reconciler.Request }
+
+	keys, nets := []key{}, map[key]*net{}
+	for _, req := range reqs {
+		k := key{gvk: req.GVK.String(), namespace: req.Namespace, name: req.Name}
+		if req.EventType == cache.Sync && req.Name == "" {
+			// snapshots are deduplicated but never merged with object events
+			k.name = "<snapshot>"
+		}
+		if n, ok := nets[k]; ok {
+			n.last = req
+			continue
+		}
+		keys = append(keys, k)
+		nets[k] = &net{first: req, last: req}
+	}
+
+	ret := []reconciler.Request{}
+	for _, k := range keys {
+		first, last := nets[k].first, nets[k].last
+		exists, ok := known(last)
+		if !ok {
+			exists = first.EventType != cache.Added
+		}
+
+		req := last
+		switch last.EventType { //nolint:exhaustive
+		case cache.Deleted:
+			if first.EventType == cache.Added && !exists {
+				// transient object
+				continue
+			}
+		case cache.Added, cache.Updated:
+			if exists {
+				req.EventType = cache.Updated
+			} else {
+				req.EventType = cache.Added
+			}
+		}
+		ret = append(ret, req)
+	}
+
+	return ret
+}
+
+// knows returns true if the pipeline has already seen the object of a request. The second return
+// value is false if the pipeline cannot tell.
+func (c *Controller) knows(req reconciler.Request) (bool, bool) {
+	p, ok := c.pipeline.(pipeline.StoreEvaluator)
+	if !ok {
+		return false, false
+	}
+
+	obj := object.New()
+	obj.SetGroupVersionKind(req.GVK)
+	obj.SetNamespace(req.Namespace)
+	obj.SetName(req.Name)
+
+	return p.HasObject(obj)
+}
+
+// enqueue adds a request to the pending requests and returns true if this is the first pending
+// request, i.e., the coalescing window has to be started.
+func (c *Controller) enqueue(req reconciler.Request) bool {
+	c.pending = append(c.pending, req)
+	return len(c.pending) == 1
+}
+
+// flush processes the requests collected in the coalescing window and writes the consolidated
+// deltas into the target.
+func (c *Controller) flush(ctx context.Context) {
+	reqs := coalesceRequests(c.pending, c.knows)
+	c.log.V(2).Info("coalescing window closed", "requests", len(c.pending), "coalesced", len(reqs))
+	c.pending = nil
+
+	c.outbox = []cache.Delta{}
+	for _, req := range reqs {
+		c.process(ctx, req)
+	}
+	deltas := pipeline.ConsolidateDeltas(c.outbox)
+	c.outbox = nil
+
+	for _, d := range deltas {
+		if err := c.write(ctx, d); err != nil {
+			c.log.Error(c.PushError(err), "error", "delta", d.String())
+		}
+	}
+
+	// the finalizers are removed only if all writes have succeeded
+	c.finalizePending(ctx)
+}
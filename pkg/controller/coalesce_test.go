@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	runtimeManager "sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/yaml"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	viewv1a1 "hsnlab/dcontroller/pkg/api/view/v1alpha1"
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/manager"
+	"hsnlab/dcontroller/pkg/object"
+	"hsnlab/dcontroller/pkg/reconciler"
+)
+
+// recordingTarget records the deltas written into the target.
+type recordingTarget struct {
+	reconciler.Target
+	mu     sync.Mutex
+	deltas []string
+}
+
+func (t *recordingTarget) Write(ctx context.Context, delta cache.Delta) error {
+	t.mu.Lock()
+	t.deltas = append(t.deltas, string(delta.Type)+":"+delta.Object.GetName())
+	t.mu.Unlock()
+	return t.Target.Write(ctx, delta)
+}
+
+func (t *recordingTarget) get() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string{}, t.deltas...)
+}
+
+var _ = Describe("Coalescing", func() {
+	var gvk = viewv1a1.GroupVersion.WithKind("view")
+
+	newReq := func(name string, eventType cache.DeltaType) reconciler.Request {
+		return reconciler.Request{Namespace: "default", Name: name, EventType: eventType, GVK: gvk}
+	}
+
+	knownIn := func(names ...string) func(reconciler.Request) (bool, bool) {
+		return func(req reconciler.Request) (bool, bool) { return slices.Contains(names, req.Name), true }
+	}
+	unknown := func(reconciler.Request) (bool, bool) { return false, false }
+
+	summary := func(reqs []reconciler.Request) []string {
+		ret := []string{}
+		for _, r := range reqs {
+			ret = append(ret, string(r.EventType)+":"+r.Name)
+		}
+		return ret
+	}
+
+	It("should merge the requests on the same object", func() {
+		reqs := coalesceRequests([]reconciler.Request{
+			newReq("a", cache.Added),
+			newReq("b", cache.Updated),
+			newReq("a", cache.Updated),
+			newReq("c", cache.Added),
+			newReq("b", cache.Updated),
+			newReq("d", cache.Updated),
+			newReq("c", cache.Deleted),
+			newReq("d", cache.Deleted),
+			newReq("e", cache.Deleted),
+			{EventType: cache.Sync, GVK: gvk},
+			newReq("e", cache.Added),
+			{EventType: cache.Sync, GVK: gvk},
+		}, knownIn("b", "d", "e"))
+		Expect(summary(reqs)).To(Equal([]string{
+			"Added:a", "Updated:b", "Deleted:d", "Updated:e", "Sync:",
+		}))
+	})
+
+	It("should merge the requests by whether the pipeline knows the object", func() {
+		reqs := coalesceRequests([]reconciler.Request{
+			newReq("a", cache.Added),
+			newReq("b", cache.Updated),
+			newReq("c", cache.Updated),
+			newReq("d", cache.Updated),
+			newReq("a", cache.Deleted),
+			newReq("b", cache.Added),
+			newReq("c", cache.Added),
+			newReq("d", cache.Deleted),
+		}, knownIn("a", "b"))
+		Expect(summary(reqs)).To(Equal([]string{
+			"Deleted:a", "Updated:b", "Added:c", "Deleted:d",
+		}))
+
+		// fall back to the first request if the pipeline cannot tell
+		reqs = coalesceRequests([]reconciler.Request{
+			newReq("a", cache.Added),
+			newReq("b", cache.Updated),
+			newReq("a", cache.Deleted),
+			newReq("b", cache.Added),
+		}, unknown)
+		Expect(summary(reqs)).To(Equal([]string{"Updated:b"}))
+	})
+
+	It("should know the objects seen by the pipeline", func() {
+		var p opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(`
+'@aggregate':
+  - '@select': true`), &p)).NotTo(HaveOccurred())
+
+		config := opv1a1.Controller{
+			Name:     "test",
+			Sources:  []opv1a1.Source{{Resource: opv1a1.Resource{Kind: "view"}}},
+			Pipeline: p,
+			Target:   opv1a1.Target{Resource: opv1a1.Resource{Kind: "target"}, Type: "Updater"},
+		}
+
+		mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger})
+		Expect(err).NotTo(HaveOccurred())
+		c, err := New(mgr, config, Options{})
+		Expect(err).NotTo(HaveOccurred())
+
+		obj := object.NewViewObject("view")
+		object.SetName(obj, "default", "a")
+		known := func(name string) bool {
+			exists, ok := c.knows(newReq(name, cache.Deleted))
+			Expect(ok).To(BeTrue())
+			return exists
+		}
+		Expect(known("a")).To(BeFalse())
+		_, err = c.pipeline.Evaluate(cache.Delta{Type: cache.Added, Object: obj})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(known("a")).To(BeTrue())
+		Expect(known("b")).To(BeFalse())
+	})
+
+	It("should coalesce bursts of updates into a single target write", func() {
+		var p opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(`
+'@aggregate':
+  - '@project':
+      metadata:
+        name: $.metadata.name
+        namespace: $.metadata.namespace
+      spec: $.spec`), &p)).NotTo(HaveOccurred())
+
+		config := opv1a1.Controller{
+			Name:           "test",
+			Sources:        []opv1a1.Source{{Resource: opv1a1.Resource{Kind: "view"}}},
+			Pipeline:       p,
+			Target:         opv1a1.Target{Resource: opv1a1.Resource{Kind: "target"}, Type: "Updater"},
+			CoalesceWindow: &metav1.Duration{Duration: time.Second},
+		}
+
+		mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger})
+		Expect(err).NotTo(HaveOccurred())
+
+		c, err := New(mgr, config, Options{})
+		Expect(err).NotTo(HaveOccurred())
+		target := &recordingTarget{Target: c.target}
+		c.target = target
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func(ctx context.Context) { mgr.Start(ctx) }(ctx)
+
+		vcache := mgr.GetCompositeCache().GetViewCache()
+		Expect(vcache).NotTo(BeNil())
+
+		// wait until the controller is running
+		probe := object.NewViewObject("view")
+		object.SetName(probe, "default", "probe")
+		Expect(vcache.Add(probe)).To(Succeed())
+		Eventually(target.get, 2*timeout, retryInterval).Should(Equal([]string{"Added:probe"}))
+
+		// a burst of updates, spread out so that each event is processed separately without
+		// the coalescing window
+		obj := object.NewViewObject("view")
+		object.SetName(obj, "default", "obj")
+		Expect(unstructured.SetNestedField(obj.Object, int64(0), "spec", "x")).To(Succeed())
+		Expect(vcache.Add(obj)).To(Succeed())
+		for i := 1; i <= 5; i++ {
+			time.Sleep(50 * time.Millisecond)
+			newObj := object.DeepCopy(obj)
+			Expect(unstructured.SetNestedField(newObj.Object, int64(i), "spec", "x")).To(Succeed())
+			Expect(vcache.Update(obj, newObj)).To(Succeed())
+			obj = newObj
+		}
+
+		// a transient object
+		tmp := object.NewViewObject("view")
+		object.SetName(tmp, "default", "tmp")
+		Expect(vcache.Add(tmp)).To(Succeed())
+		time.Sleep(50 * time.Millisecond)
+		Expect(vcache.Delete(tmp)).To(Succeed())
+
+		Eventually(target.get, 3*timeout, retryInterval).Should(Equal([]string{"Added:probe", "Added:obj"}))
+		Consistently(target.get, 500*time.Millisecond, retryInterval).Should(Equal([]string{"Added:probe", "Added:obj"}))
+
+		get := object.NewViewObject("target")
+		Expect(vcache.Get(ctx, client.ObjectKey{Namespace: "default", Name: "obj"}, get)).To(Succeed())
+		x, ok, err := unstructured.NestedInt64(get.Object, "spec", "x")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(x).To(Equal(int64(5)))
+	})
+})
@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -16,6 +19,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	viewv1a1 "hsnlab/dcontroller/pkg/api/view/v1alpha1"
 	"hsnlab/dcontroller/pkg/cache"
 	"hsnlab/dcontroller/pkg/object"
 	"hsnlab/dcontroller/pkg/pipeline"
@@ -31,6 +35,34 @@ type Options struct {
 	Processor ProcessorFunc
 	// ErrorChannel is a channel to receive errors from the controller.
 	ErrorChan chan error
+	// StateBackend, if set, is used to persist the state of the pipeline across restarts. On
+	// startup the saved state is restored and reconciled against the current state of the
+	// sources. Only controllers with a native target resource persist their state: views are
+	// not persisted so the state of controllers that write into a view would be stale after a
+	// restart.
+	StateBackend StateBackend
+	// StateKey is the key to save the state of the controller under. Default is the name of the
+	// controller.
+	StateKey string
+	// StateSyncPeriod is the period to save the state if it has changed. Default is
+	// DefaultStateSyncPeriod.
+	StateSyncPeriod time.Duration
+	// FieldManager is the field manager to use for server-side apply in Applier targets. Default
+	// is "dcontroller-" followed by the name of the controller.
+	FieldManager string
+	// MaxRetries is the number of times a failed request or target write is retried before the
+	// object is marked as permanently failed. Default is DefaultMaxRetries, a negative value
+	// disables retries.
+	MaxRetries int
+	// RetryBaseDelay is the delay before the first retry, doubled on each subsequent retry.
+	// Default is DefaultRetryBaseDelay.
+	RetryBaseDelay time.Duration
+	// RetryMaxDelay is the upper limit of the delay between retries. Default is
+	// DefaultRetryMaxDelay.
+	RetryMaxDelay time.Duration
+	// Operator is the name of the operator the controller belongs to, used to label the
+	// metrics of the controller.
+	Operator string
 }
 
 var _ runtimeManager.Runnable = &Controller{}
@@ -38,15 +70,38 @@ var _ runtimeManager.Runnable = &Controller{}
 // Controller is a dcontroller reconciler.
 type Controller struct {
 	*errorReporter
-	name, kind  string
-	config      opv1a1.Controller
-	sources     []reconciler.Source
-	target      reconciler.Target
-	mgr         runtimeManager.Manager
-	watcher     chan reconciler.Request
-	pipeline    pipeline.Evaluator
-	processor   ProcessorFunc
-	logger, log logr.Logger
+	name, kind   string
+	config       opv1a1.Controller
+	sources      []reconciler.Source
+	target       reconciler.Target
+	mgr          runtimeManager.Manager
+	watcher      chan reconciler.Request
+	pipeline     pipeline.Evaluator
+	processor    ProcessorFunc
+	split        bool // whether the source objects can be fetched concurrently by the workers
+	traces       traceBuffer
+	stateBackend StateBackend
+	stateKey     string
+	statePeriod  time.Duration
+	stateDirty   bool
+	window       time.Duration        // coalescing window, zero if disabled
+	pending      []reconciler.Request // requests collected in the coalescing window
+	outbox       []cache.Delta        // target deltas collected in the coalescing window
+	finalizers   map[schema.GroupVersionKind]string
+	finalizing   []object.Object // objects to finalize once the target has been updated
+	maxRetries   int
+	retryBase    time.Duration
+	retryMax     time.Duration
+	retries      map[retryKey]*retry // failed operations waiting for a retry
+	retryChan    chan retryKey
+	failed       map[retryKey]*retry // permanently failed operations, guarded by mu
+	numWorkers   int                 // the number of concurrent workers
+	workers      []*worker           // nil if the requests are processed synchronously
+	results      resultQueue         // the finished jobs of the workers
+	inflight     map[retryKey]int    // the number of jobs under way per object
+	metrics      *controllerMetrics
+	mu           sync.Mutex
+	logger, log  logr.Logger
 }
 
 // New registers a new controller given by the source resource(s) the controller watches, a target
@@ -63,6 +118,11 @@ func New(mgr runtimeManager.Manager, config opv1a1.Controller, opts Options) (*C
 		sources:       []reconciler.Source{},
 		config:        config,
 		watcher:       make(chan reconciler.Request, WatcherBufferSize),
+		finalizers:    map[schema.GroupVersionKind]string{},
+		retries:       map[retryKey]*retry{},
+		retryChan:     make(chan retryKey),
+		failed:        map[retryKey]*retry{},
+		inflight:      map[retryKey]int{},
 		errorReporter: NewErrorReporter(opts.ErrorChan),
 		logger:        logger,
 	}
@@ -72,6 +132,7 @@ func New(mgr runtimeManager.Manager, config opv1a1.Controller, opts Options) (*C
 		return c, c.PushCriticalError(errors.New("invalid controller configuration: empty name"))
 	}
 	c.name = name
+	c.metrics = newControllerMetrics(opts.Operator, name)
 	c.log = logger.WithName("controller").WithValues("name", name)
 
 	// sanity check
@@ -90,10 +151,70 @@ func New(mgr runtimeManager.Manager, config opv1a1.Controller, opts Options) (*C
 		processor = opts.Processor
 	}
 	c.processor = processor
+	c.split = opts.Processor == nil
+
+	c.maxRetries = opts.MaxRetries
+	switch {
+	case c.maxRetries == 0:
+		c.maxRetries = DefaultMaxRetries
+	case c.maxRetries < 0:
+		c.maxRetries = 0
+	}
+	c.retryBase = opts.RetryBaseDelay
+	if c.retryBase <= 0 {
+		c.retryBase = DefaultRetryBaseDelay
+	}
+	c.retryMax = opts.RetryMaxDelay
+	if c.retryMax <= 0 {
+		c.retryMax = DefaultRetryMaxDelay
+	}
+
+	if opts.StateBackend != nil {
+		if config.Target.Resource.Group != nil && *config.Target.Resource.Group != viewv1a1.GroupVersion.Group {
+			c.stateBackend = opts.StateBackend
+			c.stateKey = opts.StateKey
+			if c.stateKey == "" {
+				c.stateKey = name
+			}
+			c.statePeriod = opts.StateSyncPeriod
+			if c.statePeriod == 0 {
+				c.statePeriod = DefaultStateSyncPeriod
+			}
+		} else {
+			c.log.Info("ignoring state backend: the target is a view")
+		}
+	}
+
+	if config.CoalesceWindow != nil {
+		if config.CoalesceWindow.Duration < 0 {
+			return c, c.PushCriticalError(errors.New("invalid controller configuration: " +
+				"negative coalescing window"))
+		}
+		c.window = config.CoalesceWindow.Duration
+	}
+
+	c.numWorkers = 1
+	if config.Workers != nil {
+		if *config.Workers < 1 {
+			return c, c.PushCriticalError(errors.New("invalid controller configuration: " +
+				"the number of workers must be positive"))
+		}
+		c.numWorkers = int(*config.Workers)
+	}
+
+	// owner references are set only on the objects the controller creates
+	if config.Target.Owner != nil && (config.Target.Type == opv1a1.Patcher || config.Target.Subresource != "") {
+		return c, c.PushCriticalError(errors.New("invalid controller configuration: " +
+			"an owner can be set only for Updater and Applier targets"))
+	}
 
 	// Create the target
 	c.kind = config.Target.Resource.Kind // the kind of the target
-	c.target = reconciler.NewTarget(mgr, config.Target)
+	fieldManager := opts.FieldManager
+	if fieldManager == "" {
+		fieldManager = reconciler.DefaultFieldManager + "-" + name
+	}
+	c.target = reconciler.NewTarget(mgr, config.Target, reconciler.TargetOptions{FieldManager: fieldManager})
 
 	// Create the reconciler
 	controllerReconciler := NewControllerReconciler(mgr, c)
@@ -105,11 +226,24 @@ func New(mgr runtimeManager.Manager, config opv1a1.Controller, opts Options) (*C
 		c.sources = append(c.sources, source)
 		srcs = append(srcs, source.String())
 	}
+
+	// Objects referenced in @lookup stages are watched like sources but they are not fed into
+	// the join
+	lookups, err := pipeline.LookupResources(config.Pipeline)
+	if err != nil {
+		return c, c.PushCriticalError(fmt.Errorf("invalid pipeline in controller %s: %w",
+			c.name, err))
+	}
+	for _, r := range lookups {
+		source := reconciler.NewSource(mgr, opv1a1.Source{Resource: r})
+		c.sources = append(c.sources, source)
+		srcs = append(srcs, source.String())
+	}
 	c.log.Info("creating", "sources", fmt.Sprintf("[%s]", strings.Join(srcs, ",")))
 
 	on := true
-	baseviews := []schema.GroupVersionKind{}
-	for _, s := range c.sources {
+	baseviews := []pipeline.Source{}
+	for i, s := range c.sources {
 		gvk, err := s.GetGVK()
 		if err != nil {
 			return c, c.PushCriticalError(fmt.Errorf("failed to obtain GVK for source %s: %w",
@@ -140,17 +274,40 @@ func New(mgr runtimeManager.Manager, config opv1a1.Controller, opts Options) (*C
 
 		c.log.V(2).Info("watching resource", "GVK", s.String())
 
-		baseviews = append(baseviews, gvk)
+		if i >= len(config.Sources) {
+			baseviews = append(baseviews, pipeline.Source{GVK: gvk, Lookup: true})
+			continue
+		}
+
+		alias := ""
+		if config.Sources[i].Alias != nil {
+			alias = *config.Sources[i].Alias
+		}
+		baseviews = append(baseviews, pipeline.Source{GVK: gvk, Alias: alias})
+
+		if f := config.Sources[i].Finalizer; f != nil && *f != "" {
+			if gvk.Group == viewv1a1.GroupVersion.Group {
+				return c, c.PushCriticalError(fmt.Errorf("invalid controller configuration: "+
+					"finalizers are not supported for view source %s", gvk.Kind))
+			}
+			c.finalizers[gvk] = *f
+		}
 	}
 
 	// Create the pipeline
-	pipeline, err := pipeline.NewPipeline(c.kind, baseviews, c.config.Pipeline,
+	p, err := pipeline.NewPipeline(c.kind, baseviews, c.config.Pipeline,
 		logger.WithName("pipeline").WithValues("controller", c.name, "kind/view", c.kind))
 	if err != nil {
 		return c, c.PushCriticalError(fmt.Errorf("failed to create pipleline for controller %s: %w",
 			c.name, err))
 	}
-	c.pipeline = pipeline
+	if config.Target.Owner != nil {
+		if err := pipeline.SetOwner(p, config.Target.Owner); err != nil {
+			return c, c.PushCriticalError(fmt.Errorf("failed to set owner for controller %s: %w",
+				c.name, err))
+		}
+	}
+	c.pipeline = p
 
 	// Add the controller to the manager (this will automatically start it when Start is called
 	// on the manager, but the reconciler must still be explicitly started)
@@ -171,6 +328,21 @@ func (c *Controller) GetWatcher() chan reconciler.Request { return c.watcher }
 // SetPipeline overrides the pipeline of the controller. Useful for adding a custom pipeline to a controller.
 func (c *Controller) SetPipeline(pipeline pipeline.Evaluator) { c.pipeline = pipeline }
 
+// Resync requests the controller to re-process the full state of all sources: the current
+// objects of each source are listed from the cache and diffed against the state of the pipeline,
+// and the resultant deltas are written into the target. Useful to recover from missed events.
+func (c *Controller) Resync() {
+	for _, s := range c.sources {
+		gvk, err := s.GetGVK()
+		if err != nil {
+			c.log.Error(c.PushError(err), "resync: cannot obtain GVK for source", "source", s.String())
+			continue
+		}
+		// a sync request without a name stands for a snapshot of the entire source
+		c.watcher <- reconciler.Request{EventType: cache.Sync, GVK: gvk}
+	}
+}
+
 // ReportErrors returns a short report on the error stack of the controller.
 func (c *Controller) ReportErrors() []string { return c.errorReporter.Report() }
 
@@ -179,23 +351,117 @@ func (c *Controller) ReportErrors() []string { return c.errorReporter.Report() }
 func (c *Controller) Start(ctx context.Context) error {
 	c.log.Info("starting")
 
-	defer close(c.watcher)
+	var tick <-chan time.Time
+	if c.stateBackend != nil {
+		if err := c.restoreState(ctx); err != nil {
+			c.log.Error(c.PushError(err), "failed to restore state, starting from scratch")
+		}
+
+		ticker := time.NewTicker(c.statePeriod)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	if c.numWorkers > 1 {
+		c.startWorkers(ctx, c.numWorkers)
+	}
+
+	// the watcher is never closed: the reconcilers of the sources may still be sending
+	var flush <-chan time.Time
 	for {
 		select {
 		case req := <-c.watcher:
-			c.log.V(2).Info("processing request", "request", util.Stringify(req))
-
-			if err := c.processor(ctx, c, req); err != nil {
-				err = fmt.Errorf("error processing watch event: %w", err)
-				c.log.Error(c.PushError(err), "error", "request", req)
+			c.metrics.events.WithLabelValues(req.GVK.GroupKind().String(), string(req.EventType)).Inc()
+			if c.window > 0 {
+				if c.enqueue(req) {
+					flush = time.After(c.window)
+				}
+				continue
+			}
+			c.process(ctx, req)
+		case <-flush:
+			flush = nil
+			c.flush(ctx)
+		case key := <-c.retryChan:
+			c.retry(ctx, key)
+		case <-c.results.ready:
+			c.complete(ctx)
+		case <-tick:
+			if c.stateDirty {
+				if err := c.saveState(ctx); err != nil {
+					c.log.Error(c.PushError(err), "failed to save state")
+					continue
+				}
+				c.stateDirty = false
 			}
 		case <-ctx.Done():
+			// requests still pending in the coalescing window are dropped: the informers
+			// re-list the sources on restart anyway
+			if c.stateBackend != nil && c.stateDirty {
+				// the context is already canceled
+				sctx, cancel := context.WithTimeout(context.Background(), stateSaveTimeout)
+				if err := c.saveState(sctx); err != nil {
+					c.log.Error(err, "failed to save state")
+				}
+				cancel()
+			}
 			c.log.V(2).Info("controller terminating")
 			return nil
 		}
 	}
 }
 
+// process processes a single request.
+func (c *Controller) process(ctx context.Context, req reconciler.Request) {
+	c.log.V(2).Info("processing request", "request", util.Stringify(req))
+
+	// a new request on the object supersedes the pending retry
+	key := requestKey(req)
+	r, ok := c.retries[key]
+	if !ok {
+		r = &retry{}
+	}
+	delete(c.retries, key)
+	r.req = req
+
+	c.handle(ctx, key, r)
+}
+
+// handle runs the processor on a request. With concurrent workers the source object is fetched by
+// the worker of the object while the pipeline is still evaluated sequentially. Snapshots and the
+// requests in a coalescing window are processed synchronously, after the requests being fetched.
+func (c *Controller) handle(ctx context.Context, key retryKey, r *retry) {
+	if c.workers != nil {
+		if c.split && c.outbox == nil && !isSnapshot(r.req) {
+			c.dispatchRequest(ctx, key, r)
+			return
+		}
+		c.drain(ctx)
+	}
+
+	c.processed(ctx, key, r, c.processor(ctx, c, r.req))
+}
+
+// processed processes the result of a request.
+func (c *Controller) processed(ctx context.Context, key retryKey, r *retry, err error) {
+	if err != nil {
+		err = fmt.Errorf("error processing watch event: %w", err)
+		c.log.Error(c.PushError(err), "error", "request", r.req)
+		switch {
+		case isWriteError(err):
+			// failed writes are retried on their own
+		case isEvaluationError(err):
+			c.setFailed(key, r)
+		default:
+			c.scheduleRetry(ctx, key, r)
+		}
+	} else {
+		c.setFailed(key, nil)
+	}
+	c.observeStore()
+	c.stateDirty = true
+}
+
 func (c *Controller) GetStatus(gen int64) opv1a1.ControllerStatus {
 	status := opv1a1.ControllerStatus{Name: c.name}
 
@@ -234,20 +500,43 @@ func (c *Controller) GetStatus(gen int64) opv1a1.ControllerStatus {
 	status.Conditions = conditions
 
 	status.LastErrors = c.errorReporter.Report()
+	status.FailedKeys = c.failedKeys()
 
 	return status
 }
 
 func processRequest(ctx context.Context, c *Controller, req reconciler.Request) error {
+	if isSnapshot(req) {
+		return processSnapshot(ctx, c, req)
+	}
+
+	delta, err := fetchRequest(ctx, c, req)
+	if err != nil {
+		return err
+	}
+
+	return evaluateRequest(ctx, c, req, delta)
+}
+
+// isSnapshot returns true for a request to process the full snapshot of a source.
+func isSnapshot(req reconciler.Request) bool {
+	return req.EventType == cache.Sync && req.Name == ""
+}
+
+// fetchRequest obtains the source object of a request and adds the finalizer of the source to the
+// object. This touches only the object of the request, so it is safe to run concurrently with the
+// requests on other objects.
+func fetchRequest(ctx context.Context, c *Controller, req reconciler.Request) (cache.Delta, error) {
 	// Obtain the requested object
 	obj := &unstructured.Unstructured{}
 	obj.SetGroupVersionKind(req.GVK)
 	obj.SetNamespace(req.Namespace)
 	obj.SetName(req.Name)
 
-	if req.EventType == cache.Added || req.EventType == cache.Updated || req.EventType == cache.Replaced {
+	if req.EventType == cache.Added || req.EventType == cache.Updated || req.EventType == cache.Replaced ||
+		req.EventType == cache.Upserted || req.EventType == cache.Sync {
 		if err := c.mgr.GetClient().Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
-			return fmt.Errorf("object %s/%s disappeared for Add/Update event: %w",
+			return cache.Delta{}, fmt.Errorf("object %s/%s disappeared for Add/Update event: %w",
 				req.GVK, client.ObjectKeyFromObject(obj), err)
 		}
 	}
@@ -256,22 +545,125 @@ func processRequest(ctx context.Context, c *Controller, req reconciler.Request)
 		Object: obj,
 	}
 
+	// objects with a finalizer are deleted only when the finalizer is removed: process the
+	// deletion as soon as the deletion timestamp is set
+	switch {
+	case delta.Type != cache.Deleted && c.isFinalizing(obj):
+		delta = cache.Delta{Type: cache.Deleted, Object: obj}
+	case delta.Type != cache.Deleted:
+		if err := c.addFinalizer(ctx, obj); err != nil {
+			return cache.Delta{}, err
+		}
+	}
+
+	return delta, nil
+}
+
+// evaluateRequest processes the delta of a request through the pipeline and writes the result into
+// the target. The pipeline is shared by all objects so requests are evaluated one at a time.
+func evaluateRequest(ctx context.Context, c *Controller, req reconciler.Request, delta cache.Delta) error {
+	// deleted objects carry a deletion timestamp only if they are being finalized
+	obj := delta.Object
+	finalizing := c.isFinalizing(obj)
+
 	// Process the delta through the pipeline
-	deltas, err := c.pipeline.Evaluate(delta)
+	start := time.Now()
+	deltas, err := c.evaluate(delta)
+	c.observeEvaluation(start, deltas)
 	if err != nil {
-		return fmt.Errorf("error evaluating pipeline for object %s/%s: %w", req.GVK,
-			client.ObjectKeyFromObject(obj), err)
+		return &evaluationError{fmt.Errorf("error evaluating pipeline for object %s/%s: %w", req.GVK,
+			client.ObjectKeyFromObject(obj), err)}
 	}
 
 	// Apply the resultant deltas
-	for _, d := range deltas {
-		c.log.V(4).Info("writing delta to target", "target", c.target.String(),
-			"delta-type", d.Type, "object", object.Dump(delta.Object))
+	if err := writeDeltas(ctx, c, req, deltas); err != nil {
+		if finalizing {
+			c.deferFinalize(obj)
+		}
+		return err
+	}
 
-		if err := c.target.Write(ctx, d); err != nil {
-			return fmt.Errorf("cannot update target %s for delta %s: %w", req.GVK,
-				d.String(), err)
+	// the finalizer is removed only after the target has been updated
+	if finalizing {
+		return c.finalize(ctx, obj)
+	}
+
+	return nil
+}
+
+// processSnapshot lists the source given in the request and processes the full snapshot.
+func processSnapshot(ctx context.Context, c *Controller, req reconciler.Request) error {
+	p, ok := c.pipeline.(pipeline.SnapshotEvaluator)
+	if !ok {
+		return fmt.Errorf("pipeline %s does not support snapshots", c.pipeline.String())
+	}
+
+	var objs []object.Object
+	found := false
+	for _, s := range c.sources {
+		if gvk, err := s.GetGVK(); err != nil || gvk != req.GVK {
+			continue
+		}
+		list, err := s.List(ctx)
+		if err != nil {
+			return fmt.Errorf("cannot list source %s: %w", req.GVK, err)
+		}
+		objs, found = list, true
+		break
+	}
+	if !found {
+		return fmt.Errorf("unknown source %s in snapshot request", req.GVK)
+	}
+
+	// objects being finalized are left out from the snapshot, i.e., they are deleted
+	finalizing := []object.Object{}
+	objs = slices.DeleteFunc(objs, func(obj object.Object) bool {
+		if c.isFinalizing(obj) {
+			finalizing = append(finalizing, obj)
+			return true
+		}
+		return false
+	})
+
+	start := time.Now()
+	deltas, err := p.EvaluateSnapshot(req.GVK, objs)
+	c.observeEvaluation(start, deltas)
+	if err != nil {
+		return &evaluationError{fmt.Errorf("error evaluating pipeline for snapshot of %s: %w", req.GVK, err)}
+	}
+
+	if err := writeDeltas(ctx, c, req, deltas); err != nil {
+		for _, obj := range finalizing {
+			c.deferFinalize(obj)
 		}
+		return err
+	}
+
+	for _, obj := range finalizing {
+		if err := c.finalize(ctx, obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeDeltas(ctx context.Context, c *Controller, req reconciler.Request, deltas []cache.Delta) error {
+	// in a coalescing window the deltas are written when the window closes
+	if c.outbox != nil {
+		c.outbox = append(c.outbox, deltas...)
+		return nil
+	}
+
+	// failed writes are retried, the rest of the deltas are still written
+	errs := []error{}
+	for _, d := range deltas {
+		if err := c.write(ctx, d); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return &writeError{errors.Join(errs...)}
 	}
 
 	return nil
@@ -295,6 +687,9 @@ func NewControllerReconciler(mgr runtimeManager.Manager, c *Controller) *Control
 
 func (r *ControllerReconciler) Reconcile(ctx context.Context, req reconciler.Request) (reconcile.Result, error) {
 	r.log.V(4).Info("reconcile", "request", req)
-	r.watcher <- req
+	select {
+	case r.watcher <- req:
+	case <-ctx.Done():
+	}
 	return reconcile.Result{}, nil
 }
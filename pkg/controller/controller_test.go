@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
 
@@ -174,12 +175,20 @@ var _ = Describe("Controller", func() {
 			Expect(err).NotTo(HaveOccurred())
 			Expect(mgr).NotTo(BeNil())
 
-			go func() { mgr.Start(ctx) }()
+			go func(ctx context.Context) { mgr.Start(ctx) }(ctx)
 
 			// Create controller overriding the request processor
+			var mu sync.Mutex
 			request := reconciler.Request{}
+			getRequest := func() reconciler.Request {
+				mu.Lock()
+				defer mu.Unlock()
+				return request
+			}
 			c, err := New(mgr, config, Options{
 				Processor: func(_ context.Context, _ *Controller, req reconciler.Request) error {
+					mu.Lock()
+					defer mu.Unlock()
 					request = req
 					return nil
 				},
@@ -195,9 +204,9 @@ var _ = Describe("Controller", func() {
 			Expect(err).NotTo(HaveOccurred())
 
 			Eventually(func() bool {
-				return request != reconciler.Request{}
+				return getRequest() != reconciler.Request{}
 			}, timeout, retryInterval).Should(BeTrue())
-			Expect(request).To(Equal(reconciler.Request{
+			Expect(getRequest()).To(Equal(reconciler.Request{
 				GVK:       viewv1a1.NewGVK("view"),
 				Namespace: "default",
 				Name:      "viewname",
@@ -247,7 +256,7 @@ var _ = Describe("Controller", func() {
 			vcache := mgr.GetCompositeCache().GetViewCache()
 			Expect(vcache).NotTo(BeNil())
 
-			go func() { mgr.Start(ctx) }()
+			go func(ctx context.Context) { mgr.Start(ctx) }(ctx)
 
 			// Push a view object via the view cache
 			err = vcache.Add(view)
@@ -297,12 +306,78 @@ var _ = Describe("Controller", func() {
 			}, timeout, retryInterval).Should(BeTrue())
 		})
 
+		It("should record pipeline traces", func() {
+			jsonData := `
+'@aggregate':
+  - '@project':
+      metadata: $.metadata`
+			var p opv1a1.Pipeline
+			err := yaml.Unmarshal([]byte(jsonData), &p)
+			Expect(err).NotTo(HaveOccurred())
+
+			config := opv1a1.Controller{
+				Name:     "test",
+				Sources:  []opv1a1.Source{{Resource: opv1a1.Resource{Kind: "view"}}},
+				Pipeline: p,
+				Target: opv1a1.Target{
+					Resource: opv1a1.Resource{Kind: "targetview"},
+					Type:     "Updater",
+				},
+			}
+
+			mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger})
+			Expect(err).NotTo(HaveOccurred())
+
+			c, err := New(mgr, config, Options{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.GetTraceSize()).To(Equal(0))
+			c.SetTraceSize(2)
+			Expect(c.GetTraceSize()).To(Equal(2))
+
+			vcache := mgr.GetCompositeCache().GetViewCache()
+			go func(ctx context.Context) { mgr.Start(ctx) }(ctx)
+
+			// add the objects one by one so that the traces are recorded in order
+			for _, name := range []string{"v1", "v2", "v3"} {
+				obj := object.NewViewObject("view")
+				object.SetName(obj, "default", name)
+				Expect(vcache.Add(obj)).NotTo(HaveOccurred())
+
+				Eventually(func() bool {
+					ts := c.GetTraces()
+					if len(ts) == 0 {
+						return false
+					}
+					n, _, _ := unstructured.NestedString(ts[len(ts)-1].Input.Object.(map[string]any),
+						"metadata", "name")
+					return n == name
+				}, timeout, retryInterval).Should(BeTrue())
+			}
+
+			ts := c.GetTraces()
+			name, _, _ := unstructured.NestedString(ts[0].Input.Object.(map[string]any), "metadata", "name")
+			Expect(name).To(Equal("v2"))
+			Expect(ts[0].Stages).To(HaveLen(1))
+			Expect(ts[0].Stages[0].Stage).To(Equal("@project"))
+			Expect(ts[0].Result).To(HaveLen(1))
+
+			// shrinking keeps the latest traces
+			c.SetTraceSize(1)
+			ts = c.GetTraces()
+			Expect(ts).To(HaveLen(1))
+			name, _, _ = unstructured.NestedString(ts[0].Input.Object.(map[string]any), "metadata", "name")
+			Expect(name).To(Equal("v3"))
+
+			c.SetTraceSize(0)
+			Expect(c.GetTraces()).To(BeEmpty())
+		})
+
 		It("should implement a basic controller on native objects", func() {
 			mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger})
 			Expect(err).NotTo(HaveOccurred())
 			Expect(mgr).NotTo(BeNil())
 
-			go func() { mgr.Start(ctx) }()
+			go func(ctx context.Context) { mgr.Start(ctx) }(ctx)
 
 			yamlData := `
 name: test
@@ -451,7 +526,7 @@ target:
 			Expect(err).NotTo(HaveOccurred())
 			Expect(mgr).NotTo(BeNil())
 
-			go func() { mgr.Start(ctx) }()
+			go func(ctx context.Context) { mgr.Start(ctx) }(ctx)
 
 			yamlData := `
 name: test
@@ -477,7 +552,7 @@ target:
 			Expect(err).NotTo(HaveOccurred())
 			Expect(mgr).NotTo(BeNil())
 
-			go func() { mgr.Start(ctx) }()
+			go func(ctx context.Context) { mgr.Start(ctx) }(ctx)
 
 			yamlData := `
 name: test
@@ -497,12 +572,42 @@ pipeline:
 			Expect(err).To(HaveOccurred())
 		})
 
+		It("should reject an owner for Patcher targets", func() {
+			mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mgr).NotTo(BeNil())
+
+			go func(ctx context.Context) { mgr.Start(ctx) }(ctx)
+
+			yamlData := `
+name: test
+sources:
+  - apiGroup: ""
+    kind: Pod
+pipeline:
+  '@aggregate':
+    - '@project':
+        metadata: "$.metadata"
+target:
+  apiGroup: ""
+  kind: ConfigMap
+  type: Patcher
+  owner: $.`
+
+			var config opv1a1.Controller
+			err = yaml.Unmarshal([]byte(yamlData), &config)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = New(mgr, config, Options{})
+			Expect(err).To(HaveOccurred())
+		})
+
 		It("should reject a controller with an invalid pipeline", func() {
 			mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger})
 			Expect(err).NotTo(HaveOccurred())
 			Expect(mgr).NotTo(BeNil())
 
-			go func() { mgr.Start(ctx) }()
+			go func(ctx context.Context) { mgr.Start(ctx) }(ctx)
 
 			yamlData := `
 sources:
@@ -565,7 +670,7 @@ target:
 			Expect(c.GetName()).To(Equal("test"))
 
 			log.V(1).Info("Starting the manager")
-			go func() { mgr.Start(ctx) }()
+			go func(ctx context.Context) { mgr.Start(ctx) }(ctx)
 
 			log.V(1).Info("Obtain the viewcache")
 			vcache := mgr.GetCompositeCache().GetViewCache()
@@ -744,7 +849,7 @@ target:
 			Expect(mgr).NotTo(BeNil())
 
 			// Start manager late
-			go func() { mgr.Start(ctx) }()
+			go func(ctx context.Context) { mgr.Start(ctx) }(ctx)
 
 			// 1. create replicasets by joining on the "app" label
 			// 2. write the rs name back into the pod as the annotation "rs-name"
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"hsnlab/dcontroller/pkg/object"
+)
+
+// finalizerOf returns the finalizer of the source of an object, or an empty string if the source
+// has no finalizer.
+func (c *Controller) finalizerOf(obj client.Object) string {
+	return c.finalizers[obj.GetObjectKind().GroupVersionKind()]
+}
+
+// isFinalizing returns true if an object of a source with a finalizer is being deleted: these
+// objects are processed as deleted.
+func (c *Controller) isFinalizing(obj client.Object) bool {
+	return c.finalizerOf(obj) != "" && obj.GetDeletionTimestamp() != nil
+}
+
+// addFinalizer adds the finalizer of the source to an object, if not already there.
+func (c *Controller) addFinalizer(ctx context.Context, obj object.Object) error {
+	finalizer := c.finalizerOf(obj)
+	if finalizer == "" || !controllerutil.AddFinalizer(obj, finalizer) {
+		return nil
+	}
+
+	c.log.V(4).Info("adding finalizer", "object", client.ObjectKeyFromObject(obj), "finalizer", finalizer)
+	if err := c.mgr.GetClient().Update(ctx, obj); err != nil {
+		return fmt.Errorf("cannot add finalizer %s to object %s: %w", finalizer,
+			client.ObjectKeyFromObject(obj), err)
+	}
+
+	return nil
+}
+
+// finalize removes the finalizer of the source from an object being deleted. In a coalescing
+// window the finalizer is removed only when the deltas are written at the end of the window, and
+// with concurrent workers only when the target writes under way have completed.
+func (c *Controller) finalize(ctx context.Context, obj object.Object) error {
+	if c.outbox != nil || c.writing() {
+		c.finalizing = append(c.finalizing, obj)
+		return nil
+	}
+
+	return c.removeFinalizer(ctx, obj)
+}
+
+// deferFinalize defers the removal of the finalizer from an object until the failed target writes
+// succeed. If the writes have permanently failed the finalizer is kept.
+func (c *Controller) deferFinalize(obj object.Object) {
+	if c.pendingWrites() {
+		c.finalizing = append(c.finalizing, obj)
+	}
+}
+
+// finalizePending removes the finalizers from the objects waiting for the target to be updated,
+// provided that there are no target writes waiting for a retry.
+func (c *Controller) finalizePending(ctx context.Context) {
+	if c.pendingWrites() {
+		return
+	}
+
+	finalizing := c.finalizing
+	c.finalizing = nil
+	for _, obj := range finalizing {
+		if err := c.removeFinalizer(ctx, obj); err != nil {
+			c.log.Error(c.PushError(err), "error", "object", object.Dump(obj))
+		}
+	}
+}
+
+// removeFinalizer removes the finalizer of the source from an object.
+func (c *Controller) removeFinalizer(ctx context.Context, obj object.Object) error {
+	finalizer := c.finalizerOf(obj)
+	if !controllerutil.RemoveFinalizer(obj, finalizer) {
+		return nil
+	}
+
+	c.log.V(4).Info("removing finalizer", "object", client.ObjectKeyFromObject(obj), "finalizer", finalizer)
+	if err := c.mgr.GetClient().Update(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("cannot remove finalizer %s from object %s: %w", finalizer,
+			client.ObjectKeyFromObject(obj), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	runtimeManager "sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/yaml"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/manager"
+	"hsnlab/dcontroller/pkg/object"
+	"hsnlab/dcontroller/pkg/reconciler"
+)
+
+// failingTarget is a target that cannot be written.
+type failingTarget struct {
+	reconciler.Target
+}
+
+func (t *failingTarget) Write(ctx context.Context, delta cache.Delta) error {
+	return errors.New("target unavailable")
+}
+
+var _ = Describe("Finalizers", func() {
+	const finalizer = "test.dcontroller.io/cleanup"
+	var podGVK = schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	var podGVR = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+
+	newController := func(mgr *manager.FakeManager, yamlData string) *Controller {
+		var config opv1a1.Controller
+		Expect(yaml.Unmarshal([]byte(yamlData), &config)).NotTo(HaveOccurred())
+		c, err := New(mgr, config, Options{})
+		Expect(err).NotTo(HaveOccurred())
+		return c
+	}
+
+	// the fake runtime cache does not follow the object tracker
+	syncCache := func(mgr *manager.FakeManager, old object.Object) object.Object {
+		obj, err := mgr.GetObjectTracker().Get(podGVR, "testns", "testpod")
+		Expect(err).NotTo(HaveOccurred())
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		Expect(err).NotTo(HaveOccurred())
+		newObj := object.New()
+		newObj.SetUnstructuredContent(content)
+		newObj.SetGroupVersionKind(podGVK)
+		Expect(mgr.GetRuntimeCache().Update(old, newObj)).To(Succeed())
+		return newObj
+	}
+
+	It("should process the deletion of objects before removing the finalizer", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		pod := object.New()
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(podn)
+		Expect(err).NotTo(HaveOccurred())
+		pod.SetUnstructuredContent(content)
+		pod.SetGroupVersionKind(podGVK)
+
+		mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger}, pod)
+		Expect(err).NotTo(HaveOccurred())
+		// the manager is not started: the requests are processed by the test
+
+		c := newController(mgr, `
+name: test
+sources:
+  - apiGroup: ""
+    kind: Pod
+    finalizer: `+finalizer+`
+pipeline:
+  '@aggregate':
+    - '@project':
+        metadata:
+          name: $.metadata.name
+          namespace: $.metadata.namespace
+target:
+  kind: podview`)
+		vcache := mgr.GetCompositeCache().GetViewCache()
+		key := client.ObjectKey{Namespace: "testns", Name: "testpod"}
+		req := reconciler.Request{Namespace: "testns", Name: "testpod", GVK: podGVK}
+
+		// the finalizer is added on create
+		req.EventType = cache.Added
+		Expect(processRequest(ctx, c, req)).To(Succeed())
+		Expect(vcache.Get(ctx, key, object.NewViewObject("podview"))).To(Succeed())
+		pod = syncCache(mgr, pod)
+		Expect(pod.GetFinalizers()).To(ConsistOf(finalizer))
+
+		// the object is not removed while it has a finalizer
+		Expect(mgr.GetClient().Delete(ctx, pod)).To(Succeed())
+		pod = syncCache(mgr, pod)
+		Expect(pod.GetDeletionTimestamp()).NotTo(BeNil())
+
+		// the deletion is processed and then the finalizer is removed
+		req.EventType = cache.Updated
+		Expect(processRequest(ctx, c, req)).To(Succeed())
+		err = vcache.Get(ctx, key, object.NewViewObject("podview"))
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		_, err = mgr.GetObjectTracker().Get(podGVR, "testns", "testpod")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should keep the finalizer if the target cannot be written", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		pod := object.New()
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(podn)
+		Expect(err).NotTo(HaveOccurred())
+		pod.SetUnstructuredContent(content)
+		pod.SetGroupVersionKind(podGVK)
+
+		mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger}, pod)
+		Expect(err).NotTo(HaveOccurred())
+		// the manager is not started: the requests are processed by the test
+
+		c := newController(mgr, `
+name: test
+sources:
+  - apiGroup: ""
+    kind: Pod
+    finalizer: `+finalizer+`
+pipeline:
+  '@aggregate':
+    - '@project':
+        metadata:
+          name: $.metadata.name
+          namespace: $.metadata.namespace
+target:
+  kind: podview`)
+		req := reconciler.Request{Namespace: "testns", Name: "testpod", GVK: podGVK}
+
+		req.EventType = cache.Added
+		Expect(processRequest(ctx, c, req)).To(Succeed())
+		pod = syncCache(mgr, pod)
+		Expect(pod.GetFinalizers()).To(ConsistOf(finalizer))
+
+		Expect(mgr.GetClient().Delete(ctx, pod)).To(Succeed())
+		syncCache(mgr, pod)
+
+		c.target = &failingTarget{Target: c.target}
+		req.EventType = cache.Updated
+		Expect(processRequest(ctx, c, req)).NotTo(Succeed())
+		obj, err := mgr.GetObjectTracker().Get(podGVR, "testns", "testpod")
+		Expect(err).NotTo(HaveOccurred())
+		o, ok := obj.(client.Object)
+		Expect(ok).To(BeTrue())
+		Expect(o.GetFinalizers()).To(ConsistOf(finalizer))
+	})
+
+	It("should reject finalizers on view sources", func() {
+		mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger})
+		Expect(err).NotTo(HaveOccurred())
+
+		var config opv1a1.Controller
+		Expect(yaml.Unmarshal([]byte(`
+name: test
+sources:
+  - kind: view
+    finalizer: `+finalizer+`
+pipeline:
+  '@aggregate':
+    - '@project':
+        metadata: $.metadata
+target:
+  kind: target`), &config)).NotTo(HaveOccurred())
+		_, err = New(mgr, config, Options{})
+		Expect(err).To(HaveOccurred())
+	})
+})
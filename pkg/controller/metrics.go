@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/pipeline"
+)
+
+var (
+	sourceEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dcontroller_source_events_total",
+		Help: "Number of events received from the sources of the controller.",
+	}, []string{"operator", "controller", "source", "event"})
+
+	pipelineDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dcontroller_pipeline_duration_seconds",
+		Help:    "Time spent evaluating the pipeline of the controller on an event or a snapshot.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 9),
+	}, []string{"operator", "controller"})
+
+	pipelineDeltas = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dcontroller_pipeline_deltas_total",
+		Help: "Number of deltas emitted by the pipeline of the controller.",
+	}, []string{"operator", "controller", "type"})
+
+	targetWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dcontroller_target_writes_total",
+		Help: "Number of writes to the target of the controller.",
+	}, []string{"operator", "controller", "verb"})
+
+	targetWriteErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dcontroller_target_write_errors_total",
+		Help: "Number of failed writes to the target of the controller.",
+	}, []string{"operator", "controller", "verb"})
+
+	pipelineStore = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dcontroller_pipeline_store_entries",
+		Help: "Number of entries in the internal stores of the pipeline of the controller.",
+	}, []string{"operator", "controller", "store"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(sourceEvents, pipelineDuration, pipelineDeltas, targetWrites,
+		targetWriteErrors, pipelineStore)
+}
+
+// controllerMetrics are the metrics of a controller.
+type controllerMetrics struct {
+	events      *prometheus.CounterVec
+	duration    prometheus.Observer
+	deltas      *prometheus.CounterVec
+	writes      *prometheus.CounterVec
+	writeErrors *prometheus.CounterVec
+	store       *prometheus.GaugeVec
+}
+
+func newControllerMetrics(operator, controller string) *controllerMetrics {
+	labels := prometheus.Labels{"operator": operator, "controller": controller}
+	return &controllerMetrics{
+		events:      sourceEvents.MustCurryWith(labels),
+		duration:    pipelineDuration.With(labels),
+		deltas:      pipelineDeltas.MustCurryWith(labels),
+		writes:      targetWrites.MustCurryWith(labels),
+		writeErrors: targetWriteErrors.MustCurryWith(labels),
+		store:       pipelineStore.MustCurryWith(labels),
+	}
+}
+
+// DeleteMetrics removes the metrics of the controllers of an operator.
+func DeleteMetrics(operator string) {
+	labels := prometheus.Labels{"operator": operator}
+	sourceEvents.DeletePartialMatch(labels)
+	pipelineDuration.DeletePartialMatch(labels)
+	pipelineDeltas.DeletePartialMatch(labels)
+	targetWrites.DeletePartialMatch(labels)
+	targetWriteErrors.DeletePartialMatch(labels)
+	pipelineStore.DeletePartialMatch(labels)
+}
+
+// observeEvaluation records the latency and the output of a pipeline evaluation.
+func (c *Controller) observeEvaluation(start time.Time, deltas []cache.Delta) {
+	c.metrics.duration.Observe(time.Since(start).Seconds())
+	for _, d := range deltas {
+		c.metrics.deltas.WithLabelValues(string(d.Type)).Inc()
+	}
+}
+
+// observeWrite records the result of a target write.
+func (c *Controller) observeWrite(d cache.Delta, err error) {
+	verb := c.target.Verb(d)
+	c.metrics.writes.WithLabelValues(verb).Inc()
+	if err != nil {
+		c.metrics.writeErrors.WithLabelValues(verb).Inc()
+	}
+}
+
+// observeStore records the size of the internal stores of the pipeline. Must be called from the
+// goroutine that evaluates the pipeline.
+func (c *Controller) observeStore() {
+	p, ok := c.pipeline.(pipeline.StatsEvaluator)
+	if !ok {
+		return
+	}
+	for store, n := range p.GetStoreSizes() {
+		c.metrics.store.WithLabelValues(store).Set(float64(n))
+	}
+}
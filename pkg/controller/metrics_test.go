@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	runtimeManager "sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/yaml"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/manager"
+	"hsnlab/dcontroller/pkg/object"
+	"hsnlab/dcontroller/pkg/pipeline"
+)
+
+var _ = Describe("Metrics", func() {
+	const operator = "metrics-test"
+
+	AfterEach(func() {
+		DeleteMetrics(operator)
+	})
+
+	It("should count the events, the deltas and the target writes", func() {
+		mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger})
+		Expect(err).NotTo(HaveOccurred())
+
+		var p opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(`
+'@aggregate':
+  - '@project':
+      metadata:
+        name: $.metadata.name
+        namespace: $.metadata.namespace
+      spec: $.spec`), &p)).NotTo(HaveOccurred())
+		c, err := New(mgr, opv1a1.Controller{
+			Name:     "test",
+			Sources:  []opv1a1.Source{{Resource: opv1a1.Resource{Kind: "view"}}},
+			Pipeline: p,
+			Target:   opv1a1.Target{Resource: opv1a1.Resource{Kind: "target"}, Type: "Updater"},
+		}, Options{Operator: operator})
+		Expect(err).NotTo(HaveOccurred())
+		target := &flakyTarget{Target: c.target}
+		c.target = target
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func(ctx context.Context) { mgr.Start(ctx) }(ctx)
+
+		vcache := mgr.GetCompositeCache().GetViewCache()
+		obj := object.NewViewObject("view")
+		object.SetName(obj, "default", "obj")
+		Expect(vcache.Add(obj)).To(Succeed())
+
+		writes := func(verb string) func() float64 {
+			return func() float64 {
+				return testutil.ToFloat64(targetWrites.WithLabelValues(operator, "test", verb))
+			}
+		}
+		Eventually(writes("create"), timeout, retryInterval).Should(Equal(1.0))
+
+		// a failed update
+		target.failures.Store(1)
+		newObj := object.DeepCopy(obj)
+		Expect(unstructured.SetNestedField(newObj.Object, "b", "spec", "a")).To(Succeed())
+		Expect(vcache.Update(obj, newObj)).To(Succeed())
+		Eventually(writes("update"), timeout, retryInterval).Should(Equal(2.0))
+		Expect(testutil.ToFloat64(targetWriteErrors.WithLabelValues(operator, "test", "update"))).
+			To(Equal(1.0))
+
+		Expect(testutil.ToFloat64(sourceEvents.WithLabelValues(operator, "test", "view.view.dcontroller.io",
+			string(cache.Added)))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(sourceEvents.WithLabelValues(operator, "test", "view.view.dcontroller.io",
+			string(cache.Updated)))).To(Equal(1.0))
+		Expect(testutil.ToFloat64(pipelineDeltas.WithLabelValues(operator, "test", string(cache.Added)))).
+			To(Equal(1.0))
+		Expect(testutil.ToFloat64(pipelineDeltas.WithLabelValues(operator, "test", string(cache.Updated)))).
+			To(Equal(1.0))
+		Expect(testutil.ToFloat64(pipelineStore.WithLabelValues(operator, "test", pipeline.ObjectStore))).
+			To(Equal(1.0))
+		Expect(testutil.CollectAndCount(pipelineDuration, "dcontroller_pipeline_duration_seconds")).
+			To(BeNumerically(">=", 1))
+
+		// the metrics are removed with the operator
+		DeleteMetrics(operator)
+		Expect(targetWrites.DeletePartialMatch(prometheus.Labels{"operator": operator})).To(BeZero())
+	})
+})
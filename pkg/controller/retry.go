@@ -0,0 +1,279 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/object"
+	"hsnlab/dcontroller/pkg/pipeline"
+	"hsnlab/dcontroller/pkg/reconciler"
+)
+
+const (
+	// DefaultMaxRetries is the default number of times a failed request or target write is
+	// retried before it is given up.
+	DefaultMaxRetries = 5
+	// DefaultRetryBaseDelay is the default delay before the first retry. The delay is doubled
+	// on each retry.
+	DefaultRetryBaseDelay = 100 * time.Millisecond
+	// DefaultRetryMaxDelay is the default upper limit of the delay between retries.
+	DefaultRetryMaxDelay = 30 * time.Second
+)
+
+// retryKey identifies a failed operation on an object: either the processing of a request on a
+// source object, or a write to a target object.
+type retryKey struct {
+	write           bool
+	gvk             schema.GroupVersionKind
+	namespace, name string
+}
+
+func requestKey(req reconciler.Request) retryKey {
+	return retryKey{gvk: req.GVK, namespace: req.Namespace, name: req.Name}
+}
+
+func writeKey(obj object.Object) retryKey {
+	return retryKey{write: true, gvk: obj.GroupVersionKind(), namespace: obj.GetNamespace(), name: obj.GetName()}
+}
+
+func (k retryKey) String() string {
+	op := "process"
+	if k.write {
+		op = "write"
+	}
+	key := client.ObjectKey{Namespace: k.namespace, Name: k.name}.String()
+	return fmt.Sprintf("%s %s:%s", op, k.gvk.GroupKind().String(), key)
+}
+
+// retry is a failed operation waiting to be retried: a request whose evaluation has failed is
+// processed again, while a failed write is written again (the pipeline has already processed the
+// request so reprocessing it would produce no output).
+type retry struct {
+	req      reconciler.Request
+	delta    cache.Delta
+	attempts int
+	due      time.Time
+}
+
+// writeError is returned by the request processor when the pipeline has been evaluated but some
+// of the resultant writes have failed. Failed writes are retried on their own.
+type writeError struct{ error }
+
+func (e *writeError) Unwrap() error { return e.error }
+
+func isWriteError(err error) bool {
+	var e *writeError
+	return errors.As(err, &e)
+}
+
+// evaluationError is returned by the request processor when the pipeline has failed. The engine may
+// already hold a partial result of the evaluation, in which case the request would be dropped as a
+// duplicate when evaluated again, so failed evaluations are not retried: the object is marked as
+// failed until a new request on the object succeeds.
+type evaluationError struct{ error }
+
+func (e *evaluationError) Unwrap() error { return e.error }
+
+func isEvaluationError(err error) bool {
+	var e *evaluationError
+	return errors.As(err, &e)
+}
+
+// scheduleRetry schedules a failed operation to be retried after an exponential backoff, or
+// marks the key as permanently failed if the maximum number of retries has been reached.
+func (c *Controller) scheduleRetry(ctx context.Context, key retryKey, r *retry) {
+	r.attempts++
+	if r.attempts > c.maxRetries {
+		delete(c.retries, key)
+		c.setFailed(key, r)
+		c.log.Error(c.PushError(fmt.Errorf("giving up %s after %d attempts", key.String(), r.attempts)),
+			"permanent failure")
+		if key.write && len(c.finalizing) > 0 {
+			// the target is not in sync: keep the finalizers
+			c.log.Info("keeping finalizers after a failed write", "objects", len(c.finalizing))
+			c.finalizing = nil
+		}
+		return
+	}
+
+	delay := c.retryMax
+	if r.attempts <= 32 {
+		if d := c.retryBase << (r.attempts - 1); d > 0 && d < delay {
+			delay = d
+		}
+	}
+	r.due = time.Now().Add(delay)
+	c.retries[key] = r
+
+	c.log.V(2).Info("scheduling retry", "key", key.String(), "attempt", r.attempts, "delay", delay)
+	time.AfterFunc(delay, func() {
+		select {
+		case c.retryChan <- key:
+		case <-ctx.Done():
+		}
+	})
+}
+
+// retry retries a failed operation.
+func (c *Controller) retry(ctx context.Context, key retryKey) {
+	r, ok := c.retries[key]
+	if !ok || time.Now().Before(r.due) {
+		// superseded or rescheduled
+		return
+	}
+	if key.write && c.inflight[key] > 0 {
+		// a newer write is under way: its result decides on the retry
+		return
+	}
+	delete(c.retries, key)
+
+	c.log.V(2).Info("retrying", "key", key.String(), "attempt", r.attempts)
+
+	if !key.write {
+		c.handle(ctx, key, r)
+		return
+	}
+
+	if err := c.writeTarget(ctx, key, r); err != nil {
+		c.log.Error(c.PushError(err), "error", "delta", r.delta.String())
+		return
+	}
+	c.finalizePending(ctx)
+}
+
+// write writes a delta into the target. A delta pending a retry, or the delta that has
+// permanently failed, on the same object is merged with the new delta so that the target never goes
+// back to a stale state and catches up with the missed writes. Failed writes are scheduled for a
+// retry.
+func (c *Controller) write(ctx context.Context, d cache.Delta) error {
+	key := writeKey(d.Object)
+	r, missed := c.retries[key]
+	if missed {
+		delete(c.retries, key)
+	} else if f := c.getFailed(key); f != nil {
+		r, missed = &retry{delta: f.delta}, true
+	} else {
+		r = &retry{}
+	}
+
+	if missed {
+		ds := pipeline.ConsolidateDeltas([]cache.Delta{r.delta, d})
+		if len(ds) == 0 {
+			// cancels out
+			c.setFailed(key, nil)
+			return nil
+		}
+		d = ds[0]
+	}
+
+	r.delta = d
+
+	return c.writeTarget(ctx, key, r)
+}
+
+// writeTarget writes the delta of a write operation into the target, or dispatches it to a worker
+// if there are concurrent workers.
+func (c *Controller) writeTarget(ctx context.Context, key retryKey, r *retry) error {
+	c.log.V(4).Info("writing delta to target", "target", c.target.String(),
+		"delta-type", r.delta.Type, "object", object.Dump(r.delta.Object))
+
+	if c.workers != nil {
+		c.dispatchWrite(ctx, key, r)
+		return nil
+	}
+
+	return c.written(ctx, key, r, c.target.Write(ctx, r.delta))
+}
+
+// written processes the result of a target write. A failed write is scheduled for a retry, merged
+// with the failed write of an older delta on the same object if there is one.
+func (c *Controller) written(ctx context.Context, key retryKey, r *retry, err error) error {
+	c.observeWrite(r.delta, err)
+	if err == nil {
+		// supersedes the older failed writes
+		delete(c.retries, key)
+		c.setFailed(key, nil)
+		return nil
+	}
+
+	err = fmt.Errorf("cannot update target %s for delta %s: %w", c.target.String(),
+		r.delta.String(), err)
+
+	if p, ok := c.retries[key]; ok {
+		delete(c.retries, key)
+		ds := pipeline.ConsolidateDeltas([]cache.Delta{p.delta, r.delta})
+		if len(ds) == 0 {
+			// cancels out
+			c.setFailed(key, nil)
+			return nil
+		}
+		r.delta, r.attempts = ds[0], max(r.attempts, p.attempts)
+	}
+	c.scheduleRetry(ctx, key, r)
+
+	return err
+}
+
+// setFailed marks a key as permanently failed with the given operation, or clears the mark if the
+// operation is nil.
+func (c *Controller) setFailed(key retryKey, r *retry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if r != nil {
+		c.failed[key] = r
+	} else {
+		delete(c.failed, key)
+	}
+}
+
+// getFailed returns the permanently failed operation for a key, or nil.
+func (c *Controller) getFailed(key retryKey) *retry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.failed[key]
+}
+
+// failedKeys returns the permanently failed keys in a sorted list.
+func (c *Controller) failedKeys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.failed) == 0 {
+		return nil
+	}
+	ret := make([]string, 0, len(c.failed))
+	for k := range c.failed {
+		ret = append(ret, k.String())
+	}
+	slices.Sort(ret)
+	return ret
+}
+
+// pendingWrites returns true if there are target writes in progress or waiting for a retry.
+func (c *Controller) pendingWrites() bool {
+	if c.writing() {
+		return true
+	}
+	for k := range c.retries {
+		if k.write {
+			return true
+		}
+	}
+	return false
+}
+
+// writing returns true if there are target writes under way.
+func (c *Controller) writing() bool {
+	for k := range c.inflight {
+		if k.write {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	runtimeManager "sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/yaml"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/manager"
+	"hsnlab/dcontroller/pkg/object"
+	"hsnlab/dcontroller/pkg/pipeline"
+	"hsnlab/dcontroller/pkg/reconciler"
+)
+
+// flakyTarget is a target that fails the given number of writes before it starts to work.
+type flakyTarget struct {
+	reconciler.Target
+	failures atomic.Int32
+	writes   atomic.Int32
+}
+
+func (t *flakyTarget) Write(ctx context.Context, delta cache.Delta) error {
+	t.writes.Add(1)
+	if t.failures.Add(-1) >= 0 {
+		return errors.New("target unavailable")
+	}
+	return t.Target.Write(ctx, delta)
+}
+
+var _ = Describe("Retries", func() {
+	var mgr *manager.FakeManager
+	var ctx context.Context
+	var cancel context.CancelFunc
+
+	BeforeEach(func() {
+		var err error
+		mgr, err = manager.NewFakeManager(runtimeManager.Options{Logger: logger})
+		Expect(err).NotTo(HaveOccurred())
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	newController := func(opts Options) *Controller {
+		var p opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(`
+'@aggregate':
+  - '@project':
+      metadata:
+        name: $.metadata.name
+        namespace: $.metadata.namespace
+      spec: $.spec`), &p)).NotTo(HaveOccurred())
+		config := opv1a1.Controller{
+			Name:     "test",
+			Sources:  []opv1a1.Source{{Resource: opv1a1.Resource{Kind: "view"}}},
+			Pipeline: p,
+			Target:   opv1a1.Target{Resource: opv1a1.Resource{Kind: "target"}, Type: "Updater"},
+		}
+		opts.RetryBaseDelay = 10 * time.Millisecond
+		c, err := New(mgr, config, opts)
+		Expect(err).NotTo(HaveOccurred())
+		return c
+	}
+
+	getTarget := func() (object.Object, error) {
+		obj := object.NewViewObject("target")
+		err := mgr.GetCompositeCache().GetViewCache().Get(ctx,
+			client.ObjectKey{Namespace: "default", Name: "obj"}, obj)
+		return obj, err
+	}
+
+	It("should retry failed target writes", func() {
+		c := newController(Options{})
+		target := &flakyTarget{Target: c.target}
+		target.failures.Store(2)
+		c.target = target
+		go func(ctx context.Context) { mgr.Start(ctx) }(ctx)
+
+		obj := object.NewViewObject("view")
+		object.SetName(obj, "default", "obj")
+		Expect(mgr.GetCompositeCache().GetViewCache().Add(obj)).To(Succeed())
+
+		Eventually(func() error { _, err := getTarget(); return err }, timeout, retryInterval).Should(Succeed())
+		Expect(target.writes.Load()).To(Equal(int32(3)))
+		status := c.GetStatus(0)
+		Expect(status.LastErrors).NotTo(BeEmpty())
+		Expect(status.FailedKeys).To(BeEmpty())
+	})
+
+	It("should report permanently failed keys and clear them on a later success", func() {
+		c := newController(Options{MaxRetries: 2})
+		target := &flakyTarget{Target: c.target}
+		target.failures.Store(100)
+		c.target = target
+		go func(ctx context.Context) { mgr.Start(ctx) }(ctx)
+
+		vcache := mgr.GetCompositeCache().GetViewCache()
+		obj := object.NewViewObject("view")
+		object.SetName(obj, "default", "obj")
+		Expect(vcache.Add(obj)).To(Succeed())
+
+		Eventually(func() []string { return c.GetStatus(0).FailedKeys }, timeout, retryInterval).
+			Should(Equal([]string{"write target.view.dcontroller.io:default/obj"}))
+		Consistently(target.writes.Load, 200*time.Millisecond, retryInterval).Should(Equal(int32(3)))
+
+		// the next update is written and clears the failure
+		target.failures.Store(0)
+		newObj := object.DeepCopy(obj)
+		Expect(unstructured.SetNestedField(newObj.Object, "b", "spec", "a")).To(Succeed())
+		Expect(vcache.Update(obj, newObj)).To(Succeed())
+
+		Eventually(func() []string { return c.GetStatus(0).FailedKeys }, timeout, retryInterval).Should(BeEmpty())
+		res, err := getTarget()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Object["spec"]).To(Equal(map[string]any{"a": "b"}))
+	})
+
+	It("should retry failed requests", func() {
+		var calls atomic.Int32
+		c := newController(Options{Processor: func(ctx context.Context, c *Controller, req reconciler.Request) error {
+			if calls.Add(1) <= 2 {
+				return errors.New("transient error")
+			}
+			return processRequest(ctx, c, req)
+		}})
+		go func(ctx context.Context) { mgr.Start(ctx) }(ctx)
+
+		obj := object.NewViewObject("view")
+		object.SetName(obj, "default", "obj")
+		Expect(mgr.GetCompositeCache().GetViewCache().Add(obj)).To(Succeed())
+
+		Eventually(func() error { _, err := getTarget(); return err }, timeout, retryInterval).Should(Succeed())
+		Expect(c.GetStatus(0).FailedKeys).To(BeEmpty())
+	})
+
+	It("should not retry requests failing in the pipeline", func() {
+		var p opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(`
+'@aggregate':
+  - '@select':
+      '@lt': [$.spec.x, 10]
+  - '@project':
+      metadata:
+        name: $.metadata.name
+        namespace: $.metadata.namespace`), &p)).NotTo(HaveOccurred())
+		c, err := New(mgr, opv1a1.Controller{
+			Name:     "test",
+			Sources:  []opv1a1.Source{{Resource: opv1a1.Resource{Kind: "view"}}},
+			Pipeline: p,
+			Target:   opv1a1.Target{Resource: opv1a1.Resource{Kind: "target"}, Type: "Updater"},
+		}, Options{RetryBaseDelay: 10 * time.Millisecond})
+		Expect(err).NotTo(HaveOccurred())
+		evals := &countingEvaluator{Evaluator: c.pipeline}
+		c.SetPipeline(evals)
+		go func(ctx context.Context) { mgr.Start(ctx) }(ctx)
+
+		// the pipeline fails on the non-numeric field after the object has been stored
+		obj := object.NewViewObject("view")
+		object.SetName(obj, "default", "obj")
+		Expect(unstructured.SetNestedField(obj.Object, "a", "spec", "x")).To(Succeed())
+		Expect(mgr.GetCompositeCache().GetViewCache().Add(obj)).To(Succeed())
+
+		Eventually(func() []string { return c.GetStatus(0).FailedKeys }, timeout, retryInterval).
+			Should(Equal([]string{"process view.view.dcontroller.io:default/obj"}))
+		Consistently(evals.count.Load, 200*time.Millisecond, retryInterval).Should(Equal(int32(1)))
+		Expect(c.GetStatus(0).LastErrors).To(ContainElement(ContainSubstring("error evaluating pipeline")))
+	})
+})
+
+// countingEvaluator counts the evaluations of a pipeline.
+type countingEvaluator struct {
+	pipeline.Evaluator
+	count atomic.Int32
+}
+
+func (e *countingEvaluator) Evaluate(delta cache.Delta) ([]cache.Delta, error) {
+	e.count.Add(1)
+	return e.Evaluator.Evaluate(delta)
+}
@@ -0,0 +1,271 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/json"
+	retryutil "k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	viewv1a1 "hsnlab/dcontroller/pkg/api/view/v1alpha1"
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/pipeline"
+	"hsnlab/dcontroller/pkg/reconciler"
+)
+
+const (
+	// DefaultStateSyncPeriod is the default period to save the state of the pipeline.
+	DefaultStateSyncPeriod = 30 * time.Second
+	// StateConfigMapPrefix is the prefix of the name of the ConfigMaps that hold the state of
+	// the pipelines.
+	StateConfigMapPrefix = "dcontroller-state-"
+	// StateConfigMapKey is the key in the ConfigMap data that holds the state.
+	StateConfigMapKey = "state"
+	// MaxConfigMapStateSize is the maximum size of the state that can be stored in a ConfigMap.
+	MaxConfigMapStateSize = 1024 * 1024
+
+	stateSaveTimeout = 5 * time.Second
+)
+
+// StateBackend is a storage to persist the state of the pipelines across restarts.
+type StateBackend interface {
+	// Load returns the state saved under the given key, or nil if no state was saved.
+	Load(ctx context.Context, key string) ([]byte, error)
+	// Save saves the state under the given key.
+	Save(ctx context.Context, key string, data []byte) error
+}
+
+// fileStateBackend saves the state of each controller into a separate file in a directory.
+type fileStateBackend struct {
+	dir string
+}
+
+// NewFileStateBackend creates a state backend that stores the state into <dir>/<key>.json.
+func NewFileStateBackend(dir string) StateBackend {
+	return &fileStateBackend{dir: dir}
+}
+
+func (b *fileStateBackend) Load(_ context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(b.file(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (b *fileStateBackend) Save(_ context.Context, key string, data []byte) error {
+	if err := os.MkdirAll(b.dir, 0o755); err != nil {
+		return err
+	}
+
+	// write atomically so that a crash never leaves a truncated state behind
+	tmp, err := os.CreateTemp(b.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close() //nolint:errcheck
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), b.file(key))
+}
+
+func (b *fileStateBackend) file(key string) string {
+	return filepath.Join(b.dir, key+".json")
+}
+
+// configMapStateBackend saves the state of each controller into a ConfigMap.
+type configMapStateBackend struct {
+	client    client.Client
+	namespace string
+}
+
+// NewConfigMapStateBackend creates a state backend that stores the state into the ConfigMap
+// <StateConfigMapPrefix><key> in the given namespace. Note that the size of a ConfigMap is limited
+// to 1 MiB: larger states are rejected, use the file backend for large pipelines.
+func NewConfigMapStateBackend(c client.Client, namespace string) StateBackend {
+	return &configMapStateBackend{client: c, namespace: namespace}
+}
+
+func (b *configMapStateBackend) Load(ctx context.Context, key string) ([]byte, error) {
+	cm := &corev1.ConfigMap{}
+	if err := b.client.Get(ctx, b.key(key), cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	data, ok := cm.Data[StateConfigMapKey]
+	if !ok {
+		return nil, nil
+	}
+	return []byte(data), nil
+}
+
+func (b *configMapStateBackend) Save(ctx context.Context, key string, data []byte) error {
+	if len(data) > MaxConfigMapStateSize {
+		return fmt.Errorf("state of %d bytes exceeds the maximum ConfigMap size of %d bytes",
+			len(data), MaxConfigMapStateSize)
+	}
+
+	// the ConfigMap may be written concurrently, e.g., during a rolling upgrade
+	return retryutil.OnError(retryutil.DefaultRetry, func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}, func() error {
+		cm := &corev1.ConfigMap{}
+		err := b.client.Get(ctx, b.key(key), cm)
+		switch {
+		case apierrors.IsNotFound(err):
+			cm.SetNamespace(b.namespace)
+			cm.SetName(StateConfigMapPrefix + key)
+			cm.Data = map[string]string{StateConfigMapKey: string(data)}
+			return b.client.Create(ctx, cm)
+		case err != nil:
+			return err
+		default:
+			cm.Data = map[string]string{StateConfigMapKey: string(data)}
+			return b.client.Update(ctx, cm)
+		}
+	})
+}
+
+func (b *configMapStateBackend) key(key string) client.ObjectKey {
+	return client.ObjectKey{Namespace: b.namespace, Name: StateConfigMapPrefix + key}
+}
+
+// restoreState loads the saved state of the pipeline and, if found, processes a snapshot of each
+// native source so that the changes missed while the controller was down are processed. The
+// objects of the view sources are dropped from the state: views are not persisted so they are
+// rebuilt from scratch anyway, and the views that vanished during the restart would never be
+// retracted otherwise.
+func (c *Controller) restoreState(ctx context.Context) error {
+	p, ok := c.pipeline.(pipeline.StatefulEvaluator)
+	if !ok {
+		return fmt.Errorf("pipeline %s does not support state persistence", c.pipeline.String())
+	}
+
+	data, err := c.stateBackend.Load(ctx, c.stateKey)
+	if err != nil {
+		return fmt.Errorf("cannot load state: %w", err)
+	}
+	if data == nil {
+		c.log.Info("no saved state found", "key", c.stateKey)
+		return nil
+	}
+
+	st := &pipeline.State{}
+	if err := json.Unmarshal(data, st); err != nil {
+		return fmt.Errorf("cannot parse state: %w", err)
+	}
+
+	natives, views := []schema.GroupVersionKind{}, map[schema.GroupVersionKind]bool{}
+	for _, s := range c.sources {
+		gvk, err := s.GetGVK()
+		if err != nil {
+			return err
+		}
+		if gvk.Group == viewv1a1.GroupVersion.Group {
+			views[gvk] = true
+		} else {
+			natives = append(natives, gvk)
+		}
+	}
+	if err := dropViews(st, views); err != nil {
+		return fmt.Errorf("cannot restore state: %w", err)
+	}
+
+	if err := p.SetState(st); err != nil {
+		return fmt.Errorf("cannot restore state: %w", err)
+	}
+
+	c.log.Info("state restored", "key", c.stateKey)
+
+	// the snapshots are processed right here: the watcher is not drained until the controller
+	// starts so queueing the requests may block
+	for _, gvk := range natives {
+		c.process(ctx, reconciler.Request{EventType: cache.Sync, GVK: gvk})
+	}
+
+	return nil
+}
+
+// dropViews removes the objects of the given view resources from a pipeline state. Only the
+// inputs of the engines can be dropped: the counts of @count and @distinct stages and the objects
+// the later steps of a chain have derived from the views cannot be corrected, so such states are
+// rejected and the controller starts from scratch.
+func dropViews(st *pipeline.State, views map[schema.GroupVersionKind]bool) error {
+	if len(views) == 0 {
+		return nil
+	}
+
+	isView := func(u map[string]any) bool {
+		o := &unstructured.Unstructured{Object: u}
+		return views[o.GroupVersionKind()]
+	}
+	isViewRef := func(r pipeline.ObjectRef) bool {
+		return views[schema.FromAPIVersionAndKind(r.APIVersion, r.Kind)]
+	}
+
+	for name, es := range st.Engines {
+		n := len(es.Objects) + len(es.Lookups)
+		es.Objects = slices.DeleteFunc(es.Objects, isView)
+		es.Lookups = slices.DeleteFunc(es.Lookups, isView)
+		if len(es.Objects)+len(es.Lookups) == n {
+			continue
+		}
+		if len(es.Groups) > 0 {
+			return fmt.Errorf("engine %q: cannot drop view objects from the state of "+
+				"@count or @distinct stages", name)
+		}
+		if len(st.Engines) > 1 {
+			return fmt.Errorf("engine %q: cannot drop view objects from the state of "+
+				"a chained pipeline", name)
+		}
+		es.LookupDeps = slices.DeleteFunc(es.LookupDeps, func(d pipeline.LookupDep) bool {
+			return isViewRef(d.Object) || isViewRef(d.Input)
+		})
+	}
+
+	return nil
+}
+
+// saveState saves the state of the pipeline.
+func (c *Controller) saveState(ctx context.Context) error {
+	p, ok := c.pipeline.(pipeline.StatefulEvaluator)
+	if !ok {
+		return fmt.Errorf("pipeline %s does not support state persistence", c.pipeline.String())
+	}
+
+	st, err := p.GetState()
+	if err != nil {
+		return fmt.Errorf("cannot obtain state: %w", err)
+	}
+	data, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("cannot serialize state: %w", err)
+	}
+	if err := c.stateBackend.Save(ctx, c.stateKey, data); err != nil {
+		return fmt.Errorf("cannot save state: %w", err)
+	}
+
+	c.log.V(2).Info("state saved", "key", c.stateKey, "size", len(data))
+
+	return nil
+}
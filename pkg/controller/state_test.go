@@ -0,0 +1,250 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/json"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	runtimeManager "sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/yaml"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	"hsnlab/dcontroller/pkg/manager"
+	"hsnlab/dcontroller/pkg/object"
+	"hsnlab/dcontroller/pkg/pipeline"
+)
+
+var _ = Describe("State persistence", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		config opv1a1.Controller
+		svcGVR = schema.GroupVersionResource{Version: "v1", Resource: "services"}
+	)
+
+	newPod := func(name string) object.Object {
+		pod := object.New()
+		pod.SetGroupVersionKind(schema.GroupVersionKind{Version: "v1", Kind: "Pod"})
+		pod.SetNamespace("default")
+		pod.SetName(name)
+		return pod
+	}
+
+	newService := func(name string) object.Object {
+		svc := object.New()
+		svc.SetGroupVersionKind(schema.GroupVersionKind{Version: "v1", Kind: "Service"})
+		svc.SetNamespace("default")
+		svc.SetName(name)
+		return svc
+	}
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(logr.NewContext(context.Background(), logger))
+		Expect(yaml.Unmarshal([]byte(`
+name: test
+sources:
+  - apiGroup: ""
+    kind: Pod
+pipeline:
+  '@aggregate':
+    - '@project':
+        metadata: $.metadata
+target:
+  apiGroup: ""
+  kind: Service
+  type: Updater`), &config)).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should save and load state from a file", func() {
+		b := NewFileStateBackend(GinkgoT().TempDir())
+
+		data, err := b.Load(ctx, "test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(BeNil())
+
+		Expect(b.Save(ctx, "test", []byte("state"))).NotTo(HaveOccurred())
+		data, err = b.Load(ctx, "test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("state"))
+	})
+
+	It("should save and load state from a ConfigMap", func() {
+		mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger})
+		Expect(err).NotTo(HaveOccurred())
+		b := NewConfigMapStateBackend(mgr.GetRuntimeClient(), "default")
+
+		data, err := b.Load(ctx, "test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(BeNil())
+
+		Expect(b.Save(ctx, "test", []byte("state-1"))).NotTo(HaveOccurred())
+		Expect(b.Save(ctx, "test", []byte("state-2"))).NotTo(HaveOccurred())
+		data, err = b.Load(ctx, "test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("state-2"))
+
+		// oversized states are rejected
+		err = b.Save(ctx, "test", make([]byte, MaxConfigMapStateSize+1))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("exceeds the maximum ConfigMap size"))
+		data, err = b.Load(ctx, "test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("state-2"))
+	})
+
+	It("should drop the objects of view sources from the state", func() {
+		view := schema.GroupVersionKind{Group: "view.dcontroller.io", Version: "v1alpha1", Kind: "view"}
+		viewObj := object.NewViewObject("view")
+		object.SetName(viewObj, "default", "obj")
+		st := &pipeline.State{Engines: map[string]*pipeline.EngineState{
+			"Service": {
+				Objects: []map[string]any{newPod("pod1").UnstructuredContent(), viewObj.UnstructuredContent()},
+				Lookups: []map[string]any{viewObj.UnstructuredContent()},
+				LookupDeps: []pipeline.LookupDep{{
+					Object: pipeline.ObjectRef{APIVersion: "view.dcontroller.io/v1alpha1", Kind: "view", Key: "default/obj"},
+					Input:  pipeline.ObjectRef{APIVersion: "v1", Kind: "Pod", Key: "default/pod1"},
+				}},
+			},
+		}}
+
+		Expect(dropViews(st, map[schema.GroupVersionKind]bool{view: true})).To(Succeed())
+		es := st.Engines["Service"]
+		Expect(es.Objects).To(HaveLen(1))
+		Expect(es.Objects[0]).To(Equal(newPod("pod1").UnstructuredContent()))
+		Expect(es.Lookups).To(BeEmpty())
+		Expect(es.LookupDeps).To(BeEmpty())
+
+		// group counts cannot be corrected
+		st.Engines["Service"].Objects = append(es.Objects, viewObj.UnstructuredContent())
+		st.Engines["Service"].Groups = []pipeline.GroupState{{Name: "g", Rows: 2}}
+		Expect(dropViews(st, map[schema.GroupVersionKind]bool{view: true})).NotTo(Succeed())
+
+		// later steps of a chain may hold objects derived from the views
+		st.Engines["Service"].Objects = append(st.Engines["Service"].Objects, viewObj.UnstructuredContent())
+		st.Engines["Service"].Groups = nil
+		st.Engines["step"] = &pipeline.EngineState{
+			Objects: []map[string]any{object.NewViewObject("step").UnstructuredContent()},
+		}
+		Expect(dropViews(st, map[schema.GroupVersionKind]bool{view: true})).NotTo(Succeed())
+
+		// chains with no view objects in the state are fine
+		st.Engines["Service"].Objects = []map[string]any{newPod("pod1").UnstructuredContent()}
+		Expect(dropViews(st, map[schema.GroupVersionKind]bool{view: true})).To(Succeed())
+	})
+
+	It("should emit the deletes missed while the controller was down", func() {
+		b := NewFileStateBackend(GinkgoT().TempDir())
+		opts := Options{StateBackend: b, StateSyncPeriod: interval}
+
+		mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger},
+			newPod("pod1"), newPod("pod2"))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = New(mgr, config, opts)
+		Expect(err).NotTo(HaveOccurred())
+		go func(ctx context.Context) { mgr.Start(ctx) }(ctx) //nolint:errcheck
+
+		tracker := mgr.GetObjectTracker()
+		Eventually(func() bool {
+			_, err1 := tracker.Get(svcGVR, "default", "pod1")
+			_, err2 := tracker.Get(svcGVR, "default", "pod2")
+			return err1 == nil && err2 == nil
+		}, timeout, retryInterval).Should(BeTrue())
+
+		Eventually(func() bool {
+			data, err := b.Load(ctx, "test")
+			if err != nil || data == nil {
+				return false
+			}
+			st := pipeline.State{}
+			if err := yaml.Unmarshal(data, &st); err != nil {
+				return false
+			}
+			return len(st.Engines["Service"].Objects) == 2
+		}, timeout, retryInterval).Should(BeTrue())
+		cancel()
+
+		// restart: pod2 was deleted while we were down but the target still exists
+		ctx, cancel = context.WithCancel(logr.NewContext(context.Background(), logger))
+		mgr, err = manager.NewFakeManager(runtimeManager.Options{Logger: logger}, newPod("pod1"))
+		Expect(err).NotTo(HaveOccurred())
+		tracker = mgr.GetObjectTracker()
+		Expect(tracker.Add(newService("pod1"))).NotTo(HaveOccurred())
+		Expect(tracker.Add(newService("pod2"))).NotTo(HaveOccurred())
+
+		c, err := New(mgr, config, opts)
+		Expect(err).NotTo(HaveOccurred())
+		go func(ctx context.Context) { mgr.Start(ctx) }(ctx) //nolint:errcheck
+
+		Eventually(func() bool {
+			_, err := tracker.Get(svcGVR, "default", "pod2")
+			return apierrors.IsNotFound(err)
+		}, timeout, retryInterval).Should(BeTrue())
+
+		// pod1 was not re-created
+		_, err = tracker.Get(svcGVR, "default", "pod1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.ReportErrors()).To(BeEmpty())
+
+	})
+
+	It("should restore a state larger than the watcher buffer", func() {
+		b := NewFileStateBackend(GinkgoT().TempDir())
+		opts := Options{StateBackend: b, StateSyncPeriod: interval}
+		n := WatcherBufferSize + 100
+
+		pods := make([]client.Object, n)
+		for i := range pods {
+			pod := newPod(fmt.Sprintf("pod%d", i))
+			// the pipeline copies the metadata: make sure the pods are the same on restart
+			pod.SetResourceVersion("1")
+			pods[i] = pod
+		}
+		mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger}, pods...)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = New(mgr, config, opts)
+		Expect(err).NotTo(HaveOccurred())
+		go func(ctx context.Context) { mgr.Start(ctx) }(ctx) //nolint:errcheck
+
+		Eventually(func() bool {
+			data, err := b.Load(ctx, "test")
+			if err != nil || data == nil {
+				return false
+			}
+			st := pipeline.State{}
+			if err := json.Unmarshal(data, &st); err != nil {
+				return false
+			}
+			return len(st.Engines["Service"].Objects) == n
+		}, 20*timeout, retryInterval).Should(BeTrue())
+		cancel()
+
+		// restart: pod0 was deleted while we were down
+		ctx, cancel = context.WithCancel(logr.NewContext(context.Background(), logger))
+		mgr, err = manager.NewFakeManager(runtimeManager.Options{Logger: logger}, pods[1:]...)
+		Expect(err).NotTo(HaveOccurred())
+		tracker := mgr.GetObjectTracker()
+		for i := range n {
+			Expect(tracker.Add(newService(fmt.Sprintf("pod%d", i)))).NotTo(HaveOccurred())
+		}
+
+		c, err := New(mgr, config, opts)
+		Expect(err).NotTo(HaveOccurred())
+		go func(ctx context.Context) { mgr.Start(ctx) }(ctx) //nolint:errcheck
+
+		Eventually(func() bool {
+			_, err := tracker.Get(svcGVR, "default", "pod0")
+			return apierrors.IsNotFound(err)
+		}, 20*timeout, retryInterval).Should(BeTrue())
+		Expect(c.ReportErrors()).To(BeEmpty())
+	})
+})
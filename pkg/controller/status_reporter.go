@@ -2,6 +2,7 @@ package controller
 
 import (
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/time/rate"
@@ -22,8 +23,10 @@ func getDefaultRateLimiter() rate.Sometimes {
 	return rate.Sometimes{First: 3, Interval: 2 * time.Second}
 }
 
-// errorReporter is the error stack implementatoin
+// errorReporter is the error stack implementatoin. Errors are pushed by the controller while the
+// status is read by the operator, so the stack is protected by a mutex.
 type errorReporter struct {
+	mu          sync.Mutex
 	errorStack  []error
 	ratelimiter rate.Sometimes
 	errorChan   chan error
@@ -39,18 +42,24 @@ func (s *errorReporter) PushError(err error) error {
 }
 
 func (s *errorReporter) PushCriticalError(err error) error {
-	s.critical = true
 	return s.Push(err, true)
 }
 
 func (s *errorReporter) Push(err error, critical bool) error {
-	// ask a status update if trigger is set
+	// ask a status update if trigger is set: the lock is released by then
 	defer s.ratelimiter.Do(func() {
 		if s.errorChan != nil {
 			s.errorChan <- err
 		}
 	})
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if critical {
+		s.critical = true
+	}
+
 	if len(s.errorStack) == ErrorReporterStackSize {
 		copy(s.errorStack, s.errorStack[1:])
 		s.errorStack[len(s.errorStack)-1] = err
@@ -61,32 +70,42 @@ func (s *errorReporter) Push(err error, critical bool) error {
 }
 
 func (s *errorReporter) Pop() {
-	if s.IsEmpty() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.errorStack) == 0 {
 		return
 	}
 	s.errorStack = s.errorStack[:len(s.errorStack)-1]
 }
 
 func (s *errorReporter) Top() error {
-	if s.IsEmpty() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.errorStack) == 0 {
 		return nil
 	}
 	return s.errorStack[len(s.errorStack)-1]
 }
 
 func (s *errorReporter) Size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return len(s.errorStack)
 }
 
 func (s *errorReporter) IsEmpty() bool {
-	return len(s.errorStack) == 0
+	return s.Size() == 0
 }
 
 func (s *errorReporter) IsCritical() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.critical
 }
 
 func (s *errorReporter) Report() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	errs := []string{}
 	for _, err := range s.errorStack {
 		errs = append(errs, trim(err.Error()))
@@ -3,6 +3,7 @@ package controller
 import (
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -71,6 +72,31 @@ var _ = Describe("StatusReporter", func() {
 		Expect(r.Size()).To(Equal(ErrorReporterStackSize))
 		Expect(r.Top()).To(Equal(errs[ErrorReporterStackSize+9]))
 	})
+
+	It("should be safe for concurrent use", func() {
+		r := NewErrorReporter(make(chan error, 3))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					r.PushError(fmt.Errorf("%d", j))
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					_ = r.Report()
+					_ = r.IsEmpty()
+				}
+			}()
+		}
+		wg.Wait()
+
+		Expect(r.Size()).To(Equal(ErrorReporterStackSize))
+	})
 })
 
 func tryReadErrorChannel(ch chan error, d time.Duration) (error, bool) {
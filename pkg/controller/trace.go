@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"sync"
+
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/pipeline"
+)
+
+// traceBuffer is a ring buffer that keeps the traces of the last requests processed by the
+// controller.
+type traceBuffer struct {
+	traces []*pipeline.Trace
+	next   int
+	full   bool
+	mu     sync.Mutex
+}
+
+// SetTraceSize enables tracing the pipeline evaluation for the last n requests processed by the
+// controller. Setting the size to zero disables tracing and drops the recorded traces.
+func (c *Controller) SetTraceSize(n int) {
+	c.traces.mu.Lock()
+	defer c.traces.mu.Unlock()
+
+	if n < 0 {
+		n = 0
+	}
+	old := c.traces.list()
+	if len(old) > n {
+		old = old[len(old)-n:]
+	}
+	c.traces.traces = make([]*pipeline.Trace, n)
+	c.traces.next, c.traces.full = 0, false
+	for _, t := range old {
+		c.traces.push(t)
+	}
+}
+
+// GetTraceSize returns the number of traces kept by the controller, zero if tracing is disabled.
+func (c *Controller) GetTraceSize() int {
+	c.traces.mu.Lock()
+	defer c.traces.mu.Unlock()
+	return len(c.traces.traces)
+}
+
+// GetTraces returns the recorded traces, oldest first.
+func (c *Controller) GetTraces() []*pipeline.Trace {
+	c.traces.mu.Lock()
+	defer c.traces.mu.Unlock()
+	return c.traces.list()
+}
+
+// evaluate processes a delta through the pipeline, recording a trace if tracing is enabled.
+func (c *Controller) evaluate(delta cache.Delta) ([]cache.Delta, error) {
+	p, ok := c.pipeline.(pipeline.TracingEvaluator)
+	if !ok || c.GetTraceSize() == 0 {
+		return c.pipeline.Evaluate(delta)
+	}
+
+	deltas, t, err := p.EvaluateWithTrace(delta)
+
+	c.traces.mu.Lock()
+	defer c.traces.mu.Unlock()
+	if len(c.traces.traces) > 0 {
+		c.traces.push(t)
+	}
+
+	return deltas, err
+}
+
+func (b *traceBuffer) push(t *pipeline.Trace) {
+	b.traces[b.next] = t
+	b.next = (b.next + 1) % len(b.traces)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+func (b *traceBuffer) list() []*pipeline.Trace {
+	if !b.full {
+		return append([]*pipeline.Trace{}, b.traces[:b.next]...)
+	}
+	return append(append([]*pipeline.Trace{}, b.traces[b.next:]...), b.traces[:b.next]...)
+}
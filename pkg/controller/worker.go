@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/object"
+)
+
+// WorkerQueueSize is the number of jobs that can wait in the queue of a worker. Once the queue of
+// a worker is full the controller stops taking new requests until the worker catches up.
+const WorkerQueueSize int = 64
+
+// job is a unit of work on a single object run by a worker: either fetching the source object of a
+// request or writing a delta into the target. The result is processed by the controller.
+type job struct {
+	key  retryKey
+	run  func(ctx context.Context) error      // run by the worker
+	done func(ctx context.Context, err error) // run by the controller with the result of run
+	err  error
+}
+
+// worker runs the jobs dispatched to it in order.
+type worker struct {
+	queue chan *job
+}
+
+// run runs the queued jobs and reports the results to the controller until the context is closed.
+func (w *worker) run(ctx context.Context, c *Controller) {
+	for {
+		select {
+		case j := <-w.queue:
+			j.err = j.run(ctx)
+			c.results.push(j)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// resultQueue collects the finished jobs for the controller. The queue is unbounded so that a
+// worker never blocks on reporting a result while the controller is blocked on dispatching a job
+// to it. The number of results is still bounded by the jobs dispatched while the controller is
+// busy.
+type resultQueue struct {
+	mu    sync.Mutex
+	jobs  []*job
+	ready chan struct{}
+}
+
+func (q *resultQueue) push(j *job) {
+	q.mu.Lock()
+	q.jobs = append(q.jobs, j)
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *resultQueue) pop() (*job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.jobs) == 0 {
+		return nil, false
+	}
+	j := q.jobs[0]
+	q.jobs = q.jobs[1:]
+	return j, true
+}
+
+// startWorkers starts the workers that fetch the source objects and write the target.
+func (c *Controller) startWorkers(ctx context.Context, n int) {
+	c.results.ready = make(chan struct{}, 1)
+	c.workers = make([]*worker, n)
+	for i := range c.workers {
+		c.workers[i] = &worker{queue: make(chan *job, WorkerQueueSize)}
+		go c.workers[i].run(ctx, c)
+	}
+}
+
+// complete processes the results of the finished jobs reported by the workers.
+func (c *Controller) complete(ctx context.Context) {
+	for {
+		j, ok := c.results.pop()
+		if !ok {
+			break
+		}
+		c.inflight[j.key]--
+		if c.inflight[j.key] <= 0 {
+			delete(c.inflight, j.key)
+		}
+		j.done(ctx, j.err)
+	}
+	c.finalizePending(ctx)
+}
+
+// drain waits until the requests being fetched by the workers have been processed, so that a
+// request processed by the controller itself is evaluated after the requests received earlier.
+func (c *Controller) drain(ctx context.Context) {
+	for c.fetching() {
+		select {
+		case <-c.results.ready:
+			c.complete(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// fetching returns true if there are requests being fetched by the workers.
+func (c *Controller) fetching() bool {
+	for k := range c.inflight {
+		if !k.write {
+			return true
+		}
+	}
+	return false
+}
+
+// dispatch queues a job to the worker of the object. Blocks while the queue of the worker is full.
+func (c *Controller) dispatch(ctx context.Context, j *job) {
+	select {
+	case c.workers[workerOf(j.key, len(c.workers))].queue <- j:
+		c.inflight[j.key]++
+	case <-ctx.Done():
+	}
+}
+
+// dispatchRequest fetches the source object of a request on the worker of the object and
+// evaluates the pipeline on the result. The pipeline is always evaluated by the controller.
+func (c *Controller) dispatchRequest(ctx context.Context, key retryKey, r *retry) {
+	req := r.req
+	var delta cache.Delta
+	c.dispatch(ctx, &job{
+		key: key,
+		run: func(ctx context.Context) error {
+			d, err := fetchRequest(ctx, c, req)
+			delta = d
+			return err
+		},
+		done: func(ctx context.Context, err error) {
+			if err == nil {
+				err = evaluateRequest(ctx, c, req, delta)
+			}
+			c.processed(ctx, key, r, err)
+		},
+	})
+}
+
+// dispatchWrite writes a delta into the target on the worker of the target object.
+func (c *Controller) dispatchWrite(ctx context.Context, key retryKey, r *retry) {
+	// the target may modify the object while the pipeline still refers to it
+	d := r.delta
+	d.Object = object.DeepCopy(d.Object)
+	if d.OldObject != nil {
+		d.OldObject = object.DeepCopy(d.OldObject)
+	}
+	r.delta = d
+
+	c.dispatch(ctx, &job{
+		key: key,
+		run: func(ctx context.Context) error { return c.target.Write(ctx, d) },
+		done: func(ctx context.Context, err error) {
+			if err := c.written(ctx, key, r, err); err != nil {
+				c.log.Error(c.PushError(err), "error", "delta", r.delta.String())
+			}
+		},
+	})
+}
+
+// workerOf returns the index of the worker to run the jobs of the object with the given key.
+func workerOf(key retryKey, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key.String())) //nolint:errcheck
+	return int(h.Sum32() % uint32(n))
+}
@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	runtimeManager "sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/yaml"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	viewv1a1 "hsnlab/dcontroller/pkg/api/view/v1alpha1"
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/manager"
+	"hsnlab/dcontroller/pkg/object"
+	"hsnlab/dcontroller/pkg/reconciler"
+)
+
+// slowTarget blocks the writes of the given object until released and records the writes. If
+// set, blocked is signaled when a write is blocked.
+type slowTarget struct {
+	reconciler.Target
+	slow    string
+	release chan struct{}
+	blocked chan struct{}
+	mu      sync.Mutex
+	writes  []string
+}
+
+func (t *slowTarget) Write(ctx context.Context, delta cache.Delta) error {
+	if delta.Object.GetName() == t.slow {
+		if t.blocked != nil {
+			t.blocked <- struct{}{}
+		}
+		<-t.release
+	}
+	x, _, _ := unstructured.NestedInt64(delta.Object.Object, "spec", "x")
+	t.mu.Lock()
+	t.writes = append(t.writes, fmt.Sprintf("%s:%d", delta.Object.GetName(), x))
+	t.mu.Unlock()
+	return t.Target.Write(ctx, delta)
+}
+
+func (t *slowTarget) get() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string{}, t.writes...)
+}
+
+var _ = Describe("Workers", func() {
+	const workers = 4
+
+	newController := func(mgr *manager.FakeManager, n *int32) (*Controller, error) {
+		var p opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(`
+'@aggregate':
+  - '@project':
+      metadata:
+        name: $.metadata.name
+        namespace: $.metadata.namespace
+      spec: $.spec`), &p)).NotTo(HaveOccurred())
+		return New(mgr, opv1a1.Controller{
+			Name:     "test",
+			Sources:  []opv1a1.Source{{Resource: opv1a1.Resource{Kind: "view"}}},
+			Pipeline: p,
+			Target:   opv1a1.Target{Resource: opv1a1.Resource{Kind: "target"}, Type: "Updater"},
+			Workers:  n,
+		}, Options{})
+	}
+
+	// workersOf returns the workers that fetch and write an object
+	workersOf := func(name string) (int, int) {
+		src, dst := viewv1a1.GroupVersion.WithKind("view"), viewv1a1.GroupVersion.WithKind("target")
+		return workerOf(retryKey{gvk: src, namespace: "default", name: name}, workers),
+			workerOf(retryKey{write: true, gvk: dst, namespace: "default", name: name}, workers)
+	}
+
+	// otherWorker returns the name of an object that is both fetched and written by a worker
+	// other than the one writing the given object
+	otherWorker := func(name string) string {
+		_, w := workersOf(name)
+		for i := 0; ; i++ {
+			other := fmt.Sprintf("obj-%d", i)
+			if f, o := workersOf(other); f != w && o != w {
+				return other
+			}
+		}
+	}
+
+	// sameWorker returns the names of n objects that are written by the worker writing the given
+	// object
+	sameWorker := func(name string, n int) []string {
+		_, w := workersOf(name)
+		ret := []string{}
+		for i := 0; len(ret) < n; i++ {
+			other := fmt.Sprintf("obj-%d", i)
+			if _, o := workersOf(other); o == w {
+				ret = append(ret, other)
+			}
+		}
+		return ret
+	}
+
+	It("should not block the writes of other objects on a slow write", func() {
+		mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger})
+		Expect(err).NotTo(HaveOccurred())
+		n := int32(workers)
+		c, err := newController(mgr, &n)
+		Expect(err).NotTo(HaveOccurred())
+		target := &slowTarget{Target: c.target, slow: "slow", release: make(chan struct{})}
+		c.target = target
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func(ctx context.Context) { mgr.Start(ctx) }(ctx)
+
+		vcache := mgr.GetCompositeCache().GetViewCache()
+		slow := object.NewViewObject("view")
+		object.SetName(slow, "default", "slow")
+		Expect(vcache.Add(slow)).To(Succeed())
+
+		// updates of the slow object are queued behind the blocked write
+		for i := 1; i <= 3; i++ {
+			time.Sleep(20 * time.Millisecond)
+			newObj := object.DeepCopy(slow)
+			Expect(unstructured.SetNestedField(newObj.Object, int64(i), "spec", "x")).To(Succeed())
+			Expect(vcache.Update(slow, newObj)).To(Succeed())
+			slow = newObj
+		}
+
+		fast := object.NewViewObject("view")
+		object.SetName(fast, "default", otherWorker("slow"))
+		Expect(vcache.Add(fast)).To(Succeed())
+		Eventually(target.get, timeout, retryInterval).Should(Equal([]string{fast.GetName() + ":0"}))
+
+		// the writes of the slow object are processed in order once released
+		close(target.release)
+		Eventually(target.get, timeout, retryInterval).Should(Equal([]string{
+			fast.GetName() + ":0", "slow:0", "slow:1", "slow:2", "slow:3",
+		}))
+	})
+
+	It("should stop taking requests when the queue of a worker is full", func() {
+		mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger})
+		Expect(err).NotTo(HaveOccurred())
+		n := int32(workers)
+		c, err := newController(mgr, &n)
+		Expect(err).NotTo(HaveOccurred())
+		target := &slowTarget{Target: c.target, slow: "slow", release: make(chan struct{}),
+			blocked: make(chan struct{}, 1)}
+		c.target = target
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func(ctx context.Context) { mgr.Start(ctx) }(ctx)
+
+		evaluated := func() float64 {
+			return testutil.ToFloat64(pipelineDeltas.WithLabelValues("", "test", string(cache.Added)))
+		}
+		start := evaluated()
+
+		vcache := mgr.GetCompositeCache().GetViewCache()
+		slow := object.NewViewObject("view")
+		object.SetName(slow, "default", "slow")
+		Expect(vcache.Add(slow)).To(Succeed())
+		Eventually(target.blocked, timeout).Should(Receive())
+
+		// the writes of these objects are queued behind the blocked write until the queue is full
+		queued := sameWorker("slow", WorkerQueueSize+1)
+		for _, name := range queued {
+			obj := object.NewViewObject("view")
+			object.SetName(obj, "default", name)
+			Expect(vcache.Add(obj)).To(Succeed())
+		}
+		Eventually(evaluated, timeout, retryInterval).Should(Equal(start + float64(len(queued)+1)))
+
+		// the controller is blocked on dispatching the last write: no other object is processed
+		fast := object.NewViewObject("view")
+		object.SetName(fast, "default", otherWorker("slow"))
+		Expect(vcache.Add(fast)).To(Succeed())
+		Consistently(target.get, 5*retryInterval, retryInterval).Should(BeEmpty())
+
+		close(target.release)
+		Eventually(func() int { return len(target.get()) }, timeout, retryInterval).
+			Should(Equal(len(queued) + 2))
+		Expect(target.get()).To(ContainElement(fast.GetName() + ":0"))
+	})
+
+	It("should reject an invalid number of workers", func() {
+		mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger})
+		Expect(err).NotTo(HaveOccurred())
+		n := int32(0)
+		_, err = newController(mgr, &n)
+		Expect(err).To(HaveOccurred())
+	})
+})
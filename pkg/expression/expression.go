@@ -16,9 +16,24 @@ const ExpressionDumpMaxLevel = 10
 type Unstructured = map[string]any
 type GVK = schema.GroupVersionKind
 
+// EvalCtx is the context of an expression evaluation. Object is the object the JSONPath root "$"
+// refers to and Subject is the local subject "$$" of @map, @filter, etc. OldObject is the
+// previous version of the object, available via the "$old" root (pipelines set it to the copy of
+// the object in their cache, which holds only the fields the pipeline refers to), and Event is
+// the type of the event being processed, available via "$event". Trace, if set, is called with
+// the result of each (sub-)expression evaluated successfully.
 type EvalCtx struct {
 	Object, Subject any
+	OldObject       any
+	Event           string
 	Log             logr.Logger
+	Trace           func(e *Expression, result any)
+}
+
+// WithSubject returns a copy of the context with the local subject set to the given value.
+func (ctx EvalCtx) WithSubject(subject any) EvalCtx {
+	ctx.Subject = subject
+	return ctx
 }
 
 type Expression struct {
@@ -28,6 +43,14 @@ type Expression struct {
 }
 
 func (e *Expression) Evaluate(ctx EvalCtx) (any, error) {
+	v, err := e.evaluate(ctx)
+	if err == nil && ctx.Trace != nil {
+		ctx.Trace(e, v)
+	}
+	return v, err
+}
+
+func (e *Expression) evaluate(ctx EvalCtx) (any, error) {
 	if len(e.Op) == 0 {
 		return nil, NewInvalidArgumentsError(fmt.Sprintf("empty operator in expession %q", e.String()))
 	}
@@ -233,7 +256,7 @@ func (e *Expression) Evaluate(ctx EvalCtx) (any, error) {
 
 			vs := []any{}
 			for _, input := range list {
-				res, err := cond.Evaluate(EvalCtx{Object: ctx.Object, Subject: input, Log: ctx.Log})
+				res, err := cond.Evaluate(ctx.WithSubject(input))
 				if err != nil {
 					return nil, err
 				}
@@ -281,7 +304,7 @@ func (e *Expression) Evaluate(ctx EvalCtx) (any, error) {
 
 			v := false
 			for _, input := range list {
-				res, err := exp.Evaluate(EvalCtx{Object: ctx.Object, Subject: input, Log: ctx.Log})
+				res, err := exp.Evaluate(ctx.WithSubject(input))
 				if err != nil {
 					return nil, err
 				}
@@ -329,7 +352,7 @@ func (e *Expression) Evaluate(ctx EvalCtx) (any, error) {
 
 			v := false
 			for _, input := range list {
-				res, err := exp.Evaluate(EvalCtx{Object: ctx.Object, Subject: input, Log: ctx.Log})
+				res, err := exp.Evaluate(ctx.WithSubject(input))
 				if err != nil {
 					return nil, err
 				}
@@ -377,7 +400,7 @@ func (e *Expression) Evaluate(ctx EvalCtx) (any, error) {
 
 			v := true
 			for _, input := range list {
-				res, err := exp.Evaluate(EvalCtx{Object: ctx.Object, Subject: input, Log: ctx.Log})
+				res, err := exp.Evaluate(ctx.WithSubject(input))
 				if err != nil {
 					return nil, err
 				}
@@ -420,7 +443,7 @@ func (e *Expression) Evaluate(ctx EvalCtx) (any, error) {
 
 			vs := []any{}
 			for _, input := range list {
-				res, err := exp.Evaluate(EvalCtx{Object: ctx.Object, Subject: input, Log: ctx.Log})
+				res, err := exp.Evaluate(ctx.WithSubject(input))
 				if err != nil {
 					return nil, err
 				}
@@ -524,7 +524,91 @@ var _ = Describe("Expressions", func() {
 		})
 	})
 
+	Describe("Evaluating expressions on the old object and the event type", func() {
+		var ctx EvalCtx
+
+		BeforeEach(func() {
+			old := object.DeepCopy(obj1)
+			object.SetContent(old, Unstructured{"spec": Unstructured{"a": int64(0)}})
+			ctx = EvalCtx{Object: obj1.UnstructuredContent(), OldObject: old.UnstructuredContent(),
+				Event: "Updated", Log: logger}
+		})
+
+		It("should evaluate a JSONPath expression on the old object", func() {
+			var exp Expression
+			err := json.Unmarshal([]byte(`"$old.spec.a"`), &exp)
+			Expect(err).NotTo(HaveOccurred())
+
+			res, err := exp.Evaluate(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(int64(0)))
+		})
+
+		It("should evaluate a root ref on the old object", func() {
+			var exp Expression
+			err := json.Unmarshal([]byte(`"$old."`), &exp)
+			Expect(err).NotTo(HaveOccurred())
+
+			res, err := exp.Evaluate(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal(ctx.OldObject))
+		})
+
+		It("should evaluate to nil when there is no old object", func() {
+			var exp Expression
+			err := json.Unmarshal([]byte(`"$old.spec.a"`), &exp)
+			Expect(err).NotTo(HaveOccurred())
+
+			ctx.OldObject = nil
+			res, err := exp.Evaluate(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(BeNil())
+		})
+
+		It("should compare the new and the old object", func() {
+			var exp Expression
+			err := json.Unmarshal([]byte(`{"@and":[{"@eq":["$event","Updated"]},{"@not":{"@eq":["$.spec.a","$old.spec.a"]}}]}`), &exp)
+			Expect(err).NotTo(HaveOccurred())
+
+			res, err := exp.Evaluate(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(BeTrue())
+		})
+
+		It("should pass the old object into the local context of @map", func() {
+			var exp Expression
+			err := json.Unmarshal([]byte(`{"@map":[{"@sum":["$$","$old.spec.a"]},[1,2]]}`), &exp)
+			Expect(err).NotTo(HaveOccurred())
+
+			res, err := exp.Evaluate(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(Equal([]any{int64(1), int64(2)}))
+		})
+	})
+
 	Describe("Evaluating compound expressions", func() {
+		It("should report the result of each sub-expression to the trace hook", func() {
+			jsonData := `{"@lt": ["$.spec.a", 2]}`
+			var exp Expression
+			err := json.Unmarshal([]byte(jsonData), &exp)
+			Expect(err).NotTo(HaveOccurred())
+
+			trace := []string{}
+			ctx := EvalCtx{Object: obj1.UnstructuredContent(), Log: logger,
+				Trace: func(e *Expression, res any) {
+					trace = append(trace, fmt.Sprintf("%s=%v", e.String(), res))
+				}}
+			res, err := exp.Evaluate(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(BeTrue())
+
+			// sub-expressions are reported before the expressions that contain them
+			Expect(trace).To(HaveLen(4))
+			Expect(trace[0]).To(HaveSuffix("=1"))
+			Expect(trace[1]).To(HaveSuffix("=2"))
+			Expect(trace[3]).To(Equal(exp.String() + "=true"))
+		})
+
 		It("should deserialize and evaluate a nil expression", func() {
 			jsonData := `{"@isnil": 1}`
 			var exp Expression
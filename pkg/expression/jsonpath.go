@@ -3,24 +3,57 @@ package expression
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/ohler55/ojg/jp"
 )
 
+const (
+	// OldObjectRoot is the JSONPath root that refers to the previous version of the object.
+	OldObjectRoot = "$old"
+	// EventRoot is the key that evaluates to the type of the event being processed.
+	EventRoot = "$event"
+)
+
+// OldObjectPath rewrites a JSONPath that refers to the previous version of the object via the
+// "$old" root into a regular JSONPath on the old object. Returns false if the key does not refer
+// to the old object.
+func OldObjectPath(key string) (string, bool) {
+	if !strings.HasPrefix(key, OldObjectRoot) {
+		return "", false
+	}
+	rest := key[len(OldObjectRoot):]
+	if len(rest) > 0 && rest[0] != '.' && rest[0] != '[' {
+		// e.g., "$older"
+		return "", false
+	}
+	return "$" + rest, true
+}
+
 func (e *Expression) GetJSONPath(ctx EvalCtx, key string) (any, error) {
 	if len(key) == 0 || key[0] != '$' {
 		return key, nil
 	}
 
+	if key == EventRoot {
+		return ctx.Event, nil
+	}
+
+	// $... is object
+	subject := ctx.Object
+
+	// $old... is the previous version of the object
+	if k, ok := OldObjectPath(key); ok {
+		key = k
+		subject = ctx.OldObject
+	}
+
 	// handle root ref "$." that is not handled by ojg/jp for some reason
 	if key == "$." {
 		key = "$" // $ "$" will be stripped, plain "" is accepted as a root ref
 	} else if key == "$$." {
 		key = "$$" // $ "$$" will be stripped, plain "" is accepted as a root ref
 	}
-
-	// $... is object
-	subject := ctx.Object
 	// $$... is local subject (@map, @filter, etc.)
 	if len(key) >= 2 && key[0] == '$' && key[1] == '$' && ctx.Subject != nil {
 		// remove first $
@@ -113,6 +146,17 @@ func SetJSONPathExp(key string, value, target any) error {
 	return je.Set(target, value)
 }
 
+// DeleteJSONPathExp removes the key (possibly represented with a JSONPath expression) from the
+// given data structure. Removing a nonexistent key is not an error.
+func DeleteJSONPathExp(key string, target any) error {
+	je, err := jp.ParseString(key)
+	if err != nil {
+		return err
+	}
+
+	return je.Del(target)
+}
+
 // lit := []Expression{}
 // for _, arg := range args {
 // 	lit = append(lit, Expression{Op: "@any", Literal: arg, Raw: util.Stringify(arg)})
@@ -6,9 +6,13 @@ import (
 	"fmt"
 
 	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/json"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
 	ctrlCache "sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -21,6 +25,7 @@ var _ client.Client = &compositeClient{}
 
 type compositeClient struct {
 	compositeCache *ccache.CompositeCache // cache client: must be set up after the client has been created!
+	patchMeta      *object.PatchMetaResolver
 	log            logr.Logger
 	client.Client
 }
@@ -32,7 +37,22 @@ func NewCompositeClient(config *rest.Config, options client.Options) (client.Cli
 	if err != nil {
 		return nil, err
 	}
-	return &compositeClient{Client: defaultClient, log: logr.New(nil)}, nil
+
+	// CRDs are read directly from the API server for resolving the patch metadata
+	apiReader, err := client.New(config, client.Options{
+		HTTPClient: options.HTTPClient,
+		Scheme:     options.Scheme,
+		Mapper:     options.Mapper,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &compositeClient{
+		Client:    defaultClient,
+		patchMeta: object.NewPatchMetaResolver(options.Scheme, options.Mapper, apiReader),
+		log:       logr.New(nil),
+	}, nil
 }
 
 func (c *compositeClient) setCache(cache ctrlCache.Cache) error {
@@ -107,6 +127,10 @@ func (c *compositeClient) Update(ctx context.Context, obj client.Object, opts ..
 
 func (c *compositeClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
 	gvk := obj.GetObjectKind().GroupVersionKind()
+	if patch.Type() == types.StrategicMergePatchType && c.mergesLocally(gvk) {
+		return c.strategicMergePatch(ctx, obj, patch, opts...)
+	}
+
 	if gvk.Group == viewv1a1.GroupVersion.Group {
 		if c.compositeCache == nil {
 			return errors.New("cache is not set")
@@ -117,23 +141,21 @@ func (c *compositeClient) Patch(ctx context.Context, obj client.Object, patch cl
 			return errors.New("object must be an object.Object")
 		}
 
-		if patch.Type() != types.JSONPatchType && patch.Type() != types.MergePatchType {
-			c.log.Info("strategic merge patch not supported in views, falling back to a merge-patch")
-		}
-
-		j, err := patch.Data(obj)
+		newContent, err := c.viewPatchContent(obj, patch)
 		if err != nil {
-			return fmt.Errorf("cannot decode JSON patch: %w", err)
-		}
-
-		newContent := map[string]any{}
-		if err := json.Unmarshal(j, &newContent); err != nil {
-			return fmt.Errorf("cannot parse JSON patch: %w", err)
+			return err
 		}
 
 		oldObj := object.NewViewObject(gvk.Kind)
 		if err := c.compositeCache.GetViewCache().Get(ctx, client.ObjectKeyFromObject(patchObj), oldObj); err != nil {
-			return err
+			// views do not track field ownership: apply creates the object or merges into it
+			if !apierrors.IsNotFound(err) || patch.Type() != types.ApplyPatchType {
+				return err
+			}
+			newObj := object.NewViewObject(gvk.Kind)
+			object.SetContent(newObj, newContent)
+			object.SetName(newObj, patchObj.GetNamespace(), patchObj.GetName())
+			return c.compositeCache.GetViewCache().Add(newObj)
 		}
 
 		newObj := oldObj.DeepCopy()
@@ -147,6 +169,106 @@ func (c *compositeClient) Patch(ctx context.Context, obj client.Object, patch cl
 	return c.Client.Patch(ctx, obj, patch, opts...)
 }
 
+// viewPatchContent returns the content of a patch on a view object. Views implement patches
+// locally as merge patches.
+func (c *compositeClient) viewPatchContent(obj client.Object, patch client.Patch) (map[string]any, error) {
+	if patch.Type() != types.JSONPatchType && patch.Type() != types.MergePatchType &&
+		patch.Type() != types.ApplyPatchType {
+		c.log.Info("unknown patch type in views, falling back to a merge-patch", "type", patch.Type())
+	}
+
+	j, err := patch.Data(obj)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode JSON patch: %w", err)
+	}
+
+	content := map[string]any{}
+	if err := json.Unmarshal(j, &content); err != nil {
+		return nil, fmt.Errorf("cannot parse JSON patch: %w", err)
+	}
+
+	return content, nil
+}
+
+// mergesLocally returns true if strategic merge patches on a resource must be applied locally.
+// The API server implements strategic merge patches for the native types registered in the
+// scheme, but not for views and custom resources.
+func (c *compositeClient) mergesLocally(gvk schema.GroupVersionKind) bool {
+	return gvk.Group == viewv1a1.GroupVersion.Group || !c.Scheme().Recognizes(gvk)
+}
+
+// strategicMergePatch applies a strategic merge patch locally, using the patch metadata of the
+// object's resource to merge lists. The result is written back as an update (views) or as a
+// merge patch with the resource version of the merged object as a precondition (custom
+// resources). The patch is re-applied on a conflict, so that a stale cache never causes a lost
+// update.
+func (c *compositeClient) strategicMergePatch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if obj.GetObjectKind().GroupVersionKind().Group == viewv1a1.GroupVersion.Group {
+		oldObj, newObj, err := c.strategicMerge(ctx, obj, patch)
+		if err != nil {
+			return err
+		}
+		return c.compositeCache.GetViewCache().Update(oldObj, newObj)
+	}
+
+	var newObj object.Object
+	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var oldObj object.Object
+		var err error
+		if oldObj, newObj, err = c.strategicMerge(ctx, obj, patch); err != nil {
+			return err
+		}
+		return c.Client.Patch(ctx, newObj, client.MergeFromWithOptions(oldObj,
+			client.MergeFromWithOptimisticLock{}), opts...)
+	}); err != nil {
+		return err
+	}
+
+	// return the result like the default client does
+	if o, ok := obj.(object.Object); ok {
+		o.SetUnstructuredContent(newObj.UnstructuredContent())
+	}
+
+	return nil
+}
+
+// strategicMerge returns the current version of the object and the result of applying the
+// strategic merge patch to it.
+func (c *compositeClient) strategicMerge(ctx context.Context, obj client.Object, patch client.Patch) (object.Object, object.Object, error) {
+	if c.compositeCache == nil {
+		return nil, nil, errors.New("cache is not set")
+	}
+
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	j, err := patch.Data(obj)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot decode strategic merge patch: %w", err)
+	}
+
+	patchObj := object.New()
+	if err := json.Unmarshal(j, &patchObj.Object); err != nil {
+		return nil, nil, fmt.Errorf("cannot parse strategic merge patch: %w", err)
+	}
+
+	meta, err := c.patchMeta.Lookup(ctx, gvk)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	oldObj := object.New()
+	oldObj.SetGroupVersionKind(gvk)
+	if err := c.Get(ctx, client.ObjectKeyFromObject(obj), oldObj); err != nil {
+		return nil, nil, err
+	}
+
+	newObj, err := object.ApplyStrategicMergePatch(oldObj, patchObj, meta)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot apply strategic merge patch: %w", err)
+	}
+
+	return oldObj, newObj, nil
+}
+
 func (c *compositeClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
 	gvk := obj.GetObjectKind().GroupVersionKind()
 	if gvk.Group != viewv1a1.GroupVersion.Group {
@@ -173,3 +295,105 @@ func (c *compositeClient) Get(ctx context.Context, key client.ObjectKey, obj cli
 func (c *compositeClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
 	return c.compositeCache.List(ctx, list, opts...)
 }
+
+// Status returns a writer for the status subresource. The status of views is written into the
+// view cache, and strategic merge patches on the status of native objects are applied locally
+// like for the main resource. Other writes are served by the default client.
+func (c *compositeClient) Status() client.SubResourceWriter {
+	return &compositeStatusWriter{compositeClient: c}
+}
+
+var _ client.SubResourceWriter = &compositeStatusWriter{}
+
+type compositeStatusWriter struct {
+	*compositeClient
+}
+
+func (w *compositeStatusWriter) Create(ctx context.Context, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if gvk.Group == viewv1a1.GroupVersion.Group {
+		return errors.New("cannot create the status subresource of a view")
+	}
+	return w.Client.Status().Create(ctx, obj, subResource, opts...)
+}
+
+func (w *compositeStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if gvk.Group == viewv1a1.GroupVersion.Group {
+		if w.compositeCache == nil {
+			return errors.New("cache is not set")
+		}
+
+		newObj, ok := obj.(object.Object)
+		if !ok {
+			return errors.New("object must be an object.Object")
+		}
+
+		oldObj := object.NewViewObject(gvk.Kind)
+		if err := w.compositeCache.GetViewCache().Get(ctx, client.ObjectKeyFromObject(newObj), oldObj); err != nil {
+			return err
+		}
+
+		return w.compositeCache.GetViewCache().Update(oldObj, withStatus(oldObj, newObj))
+	}
+	return w.Client.Status().Update(ctx, obj, opts...)
+}
+
+func (w *compositeStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	view := gvk.Group == viewv1a1.GroupVersion.Group
+
+	if patch.Type() == types.StrategicMergePatchType && !view && w.mergesLocally(gvk) {
+		// custom resources: merge locally and retry on conflict
+		return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			oldObj, newObj, err := w.strategicMerge(ctx, obj, patch)
+			if err != nil {
+				return err
+			}
+			return w.Client.Status().Patch(ctx, withStatus(oldObj, newObj),
+				client.MergeFromWithOptions(oldObj, client.MergeFromWithOptimisticLock{}), opts...)
+		})
+	}
+
+	if !view {
+		return w.Client.Status().Patch(ctx, obj, patch, opts...)
+	}
+
+	var oldObj, newObj object.Object
+	if patch.Type() == types.StrategicMergePatchType {
+		var err error
+		if oldObj, newObj, err = w.strategicMerge(ctx, obj, patch); err != nil {
+			return err
+		}
+	} else {
+		if w.compositeCache == nil {
+			return errors.New("cache is not set")
+		}
+		content, err := w.viewPatchContent(obj, patch)
+		if err != nil {
+			return err
+		}
+		oldObj = object.NewViewObject(gvk.Kind)
+		if err := w.compositeCache.GetViewCache().Get(ctx, client.ObjectKeyFromObject(obj), oldObj); err != nil {
+			return err
+		}
+		newObj = oldObj.DeepCopy()
+		if err := object.Patch(newObj, content); err != nil {
+			return err
+		}
+	}
+
+	// only the status is written
+	return w.compositeCache.GetViewCache().Update(oldObj, withStatus(oldObj, newObj))
+}
+
+// withStatus returns a copy of an object with the status taken from another object.
+func withStatus(obj, from object.Object) object.Object {
+	ret := object.DeepCopy(obj)
+	if status, ok := from.UnstructuredContent()["status"]; ok {
+		ret.UnstructuredContent()["status"] = runtime.DeepCopyJSONValue(status)
+	} else {
+		delete(ret.UnstructuredContent(), "status")
+	}
+	return ret
+}
@@ -8,15 +8,20 @@ import (
 
 	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 	"sigs.k8s.io/controller-runtime/pkg/config"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -69,10 +74,12 @@ func NewFakeManager(opts manager.Options, objs ...client.Object) (*FakeManager,
 	fakeRuntimeClient := fake.NewClientBuilder().
 		WithObjectTracker(tracker).
 		WithObjects(objs...).
+		WithInterceptorFuncs(interceptor.Funcs{Patch: typedStrategicMergePatch}).
 		Build()
 	fakeRuntimeManager := NewFakeRuntimeManager(compositeCache, &compositeClient{
 		Client:         fakeRuntimeClient,
 		compositeCache: compositeCache,
+		patchMeta:      object.NewPatchMetaResolver(scheme, nil, nil),
 	}, logger)
 
 	mgr, err := New(nil, Options{Options: opts, Manager: fakeRuntimeManager})
@@ -90,6 +97,50 @@ func NewFakeManager(opts manager.Options, objs ...client.Object) (*FakeManager,
 	}, nil
 }
 
+// typedStrategicMergePatch applies strategic merge patches on unstructured native objects using the
+// patch metadata of the typed object, like the API server does. The fake client cannot apply
+// strategic merge patches on unstructured objects.
+func typedStrategicMergePatch(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok || patch.Type() != types.StrategicMergePatchType {
+		return c.Patch(ctx, obj, patch, opts...)
+	}
+
+	gvk := u.GroupVersionKind()
+	typed, err := c.Scheme().New(gvk)
+	if err != nil {
+		return c.Patch(ctx, obj, patch, opts...)
+	}
+
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+
+	cur := &unstructured.Unstructured{}
+	cur.SetGroupVersionKind(gvk)
+	if err := c.Get(ctx, client.ObjectKeyFromObject(obj), cur); err != nil {
+		return err
+	}
+	old, err := json.Marshal(cur.Object)
+	if err != nil {
+		return err
+	}
+
+	merged, err := strategicpatch.StrategicMergePatch(old, data, typed)
+	if err != nil {
+		return err
+	}
+	content := map[string]any{}
+	if err := json.Unmarshal(merged, &content); err != nil {
+		return err
+	}
+	u.SetUnstructuredContent(content)
+	u.SetGroupVersionKind(gvk)
+
+	return c.Update(ctx, u)
+}
+
 func (m *FakeManager) GetManager() manager.Manager               { return m.Manager }
 func (m *FakeManager) GetRuntimeManager() manager.Manager        { return m.fakeRuntimeManager }
 func (m *FakeManager) GetRuntimeCache() *ccache.FakeRuntimeCache { return m.fakeRuntimeCache }
@@ -1,11 +1,13 @@
 package object
 
 import (
+	"errors"
 	"fmt"
+	"maps"
 	"reflect"
+	"slices"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
 )
 
@@ -120,27 +122,427 @@ func deepCopy(value any) any {
 	}
 }
 
-// ApplyStrategicMergePatch is a partial local re-implementation of strategic merge patches.
-func ApplyStrategicMergePatch(original, patch *unstructured.Unstructured) (*unstructured.Unstructured, error) {
-	originalData, err := runtime.Encode(unstructured.UnstructuredJSONScheme, original)
+// ApplyStrategicMergePatch applies a strategic merge patch to an object and returns the result.
+// The patch metadata (see PatchMetaResolver) specifies how to merge lists: lists with a merge key
+// are merged elementwise, e.g., containers by name, and the rest is replaced. The original object
+// is not modified.
+func ApplyStrategicMergePatch(original, patch Object, meta strategicpatch.LookupPatchMeta) (Object, error) {
+	o, ok := deepCopy(original.UnstructuredContent()).(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid object")
+	}
+	p, ok := deepCopy(patch.UnstructuredContent()).(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid patch")
+	}
+
+	res, err := strategicpatch.StrategicMergeMapPatchUsingLookupPatchMeta(o, p, meta)
 	if err != nil {
 		return nil, err
 	}
 
-	patchData, err := runtime.Encode(unstructured.UnstructuredJSONScheme, patch)
-	if err != nil {
+	return &unstructured.Unstructured{Object: res}, nil
+}
+
+// AddedMarker marks the list elements of a patch that were added to the target by the patch.
+const AddedMarker = "$added"
+
+// PriorMarker is the key of the maps of a patch that holds the values the patch has overwritten,
+// keyed by the field name.
+const PriorMarker = "$prior"
+
+// MarkPatch returns a copy of the patch content in which the list elements with a merge key that
+// are not in the object yet are marked with the AddedMarker, and the values of the fields the
+// patch overwrites are recorded under the PriorMarker, so that RevertStrategicMergePatch can later
+// remove the added elements entirely and restore the overwritten values. The marks of the fields
+// set by the last patch of the same actor are kept.
+func MarkPatch(obj Object, patch, last map[string]any, meta strategicpatch.LookupPatchMeta) (map[string]any, error) {
+	p, ok := deepCopy(patch).(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid patch")
+	}
+
+	if err := markMap(obj.UnstructuredContent(), p, last, meta); err != nil {
 		return nil, err
 	}
 
-	patchedData, err := strategicpatch.StrategicMergePatch(originalData, patchData, &unstructured.Unstructured{})
-	if err != nil {
+	return p, nil
+}
+
+func markMap(o, p, last map[string]any, meta strategicpatch.LookupPatchMeta) error {
+	lastPriors, _ := last[PriorMarker].(map[string]any)
+	priors := map[string]any{}
+	defer func() {
+		if len(priors) > 0 {
+			p[PriorMarker] = priors
+		}
+	}()
+
+	for k, pv := range p {
+		switch x := pv.(type) {
+		case map[string]any:
+			sub, _, err := meta.LookupPatchMetadataForStruct(k)
+			if err != nil {
+				return err
+			}
+			om, _ := o[k].(map[string]any)
+			lm, _ := last[k].(map[string]any)
+			if err := markMap(om, x, lm, sub); err != nil {
+				return err
+			}
+
+		case []any:
+			sub, pm, err := meta.LookupPatchMetadataForSlice(k)
+			if err != nil {
+				return err
+			}
+			mergeKey := pm.GetPatchMergeKey()
+			if !slices.Contains(pm.GetPatchStrategies(), "merge") || mergeKey == "" {
+				continue
+			}
+			ol, _ := o[k].([]any)
+			ll, _ := last[k].([]any)
+			for _, v := range x {
+				pe, ok := v.(map[string]any)
+				if !ok {
+					continue
+				}
+				oe := findElement(ol, mergeKey, pe[mergeKey])
+				le := findElement(ll, mergeKey, pe[mergeKey])
+				if oe == nil || (le != nil && le[AddedMarker] == true) {
+					pe[AddedMarker] = true
+					continue
+				}
+				if err := markMap(oe, pe, le, sub); err != nil {
+					return err
+				}
+				// the merge key is never reverted
+				if ps, ok := pe[PriorMarker].(map[string]any); ok {
+					delete(ps, mergeKey)
+					if len(ps) == 0 {
+						delete(pe, PriorMarker)
+					}
+				}
+			}
+
+		default:
+			ov, ok := o[k]
+			if !ok {
+				continue
+			}
+			if lv, ok := last[k]; ok && reflect.DeepEqual(ov, lv) {
+				// the value was set by the last patch: keep the value it has overwritten
+				if prior, ok := lastPriors[k]; ok {
+					priors[k] = deepCopy(prior)
+				}
+				continue
+			}
+			priors[k] = deepCopy(ov)
+		}
+	}
+
+	return nil
+}
+
+// RevertStrategicMergePatch removes the content of a strategic merge patch from an object and
+// returns the result. Only the fields that still have the value set by the patch are reverted, so
+// changes made by others since the patch was applied are left alone: the fields are restored to
+// the value recorded by MarkPatch, or removed if the patch has added them. List elements are matched by
+// the merge key from the patch metadata: the elements marked as added by MarkPatch
+// are removed if they still contain the content of the patch, otherwise only the patched fields
+// are removed (and the element itself if nothing but the merge key is left). Lists with no merge
+// key are removed only if they are unchanged. The identity of the object (the GVK, the name and the
+// namespace) is kept intact. The original object is not modified.
+func RevertStrategicMergePatch(original, patch Object, meta strategicpatch.LookupPatchMeta) (Object, error) {
+	o, ok := deepCopy(original.UnstructuredContent()).(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid object")
+	}
+
+	if err := revertMap(o, patch.UnstructuredContent(), meta); err != nil {
 		return nil, err
 	}
 
-	patched := &unstructured.Unstructured{}
-	if err := runtime.DecodeInto(unstructured.UnstructuredJSONScheme, patchedData, patched); err != nil {
+	// never remove the identity of the object
+	ret := &unstructured.Unstructured{Object: o}
+	ret.SetGroupVersionKind(original.GroupVersionKind())
+	SetName(ret, original.GetNamespace(), original.GetName())
+
+	return ret, nil
+}
+
+// revertMap removes the fields of the patch from a map in place, restoring the values the patch
+// has overwritten.
+func revertMap(o, p map[string]any, meta strategicpatch.LookupPatchMeta) error {
+	priors, _ := p[PriorMarker].(map[string]any)
+	for k, pv := range p {
+		if k == PriorMarker {
+			continue
+		}
+
+		ov, ok := o[k]
+		if !ok {
+			// fields removed by the patch
+			if prior, ok := priors[k]; ok && pv == nil {
+				o[k] = deepCopy(prior)
+			}
+			continue
+		}
+
+		switch x := pv.(type) {
+		case map[string]any:
+			om, ok := ov.(map[string]any)
+			if !ok || len(om) == 0 {
+				continue
+			}
+			sub, _, err := meta.LookupPatchMetadataForStruct(k)
+			if err != nil {
+				return err
+			}
+			if err := revertMap(om, x, sub); err != nil {
+				return err
+			}
+			if len(om) == 0 {
+				delete(o, k)
+			}
+
+		case []any:
+			ol, ok := ov.([]any)
+			if !ok || len(ol) == 0 {
+				continue
+			}
+			sub, pm, err := meta.LookupPatchMetadataForSlice(k)
+			if err != nil {
+				return err
+			}
+			rl, err := revertList(ol, x, sub, pm)
+			if err != nil {
+				return err
+			}
+			if len(rl) == 0 {
+				delete(o, k)
+			} else {
+				o[k] = rl
+			}
+
+		default:
+			if !reflect.DeepEqual(ov, pv) {
+				continue
+			}
+			if prior, ok := priors[k]; ok {
+				o[k] = deepCopy(prior)
+			} else {
+				delete(o, k)
+			}
+		}
+	}
+
+	return nil
+}
+
+// revertList removes the elements of the patch from a list.
+func revertList(o, p []any, meta strategicpatch.LookupPatchMeta, pm strategicpatch.PatchMeta) ([]any, error) {
+	if !slices.Contains(pm.GetPatchStrategies(), "merge") {
+		// replaced lists are reverted only if unchanged
+		if contains(o, p) {
+			return nil, nil
+		}
+		return o, nil
+	}
+
+	mergeKey := pm.GetPatchMergeKey()
+	if mergeKey == "" {
+		// sets of primitives
+		ret := []any{}
+		for _, v := range o {
+			if !slices.ContainsFunc(p, func(pv any) bool { return reflect.DeepEqual(v, pv) }) {
+				ret = append(ret, v)
+			}
+		}
+		return ret, nil
+	}
+
+	ret := []any{}
+	for _, v := range o {
+		om, ok := v.(map[string]any)
+		if !ok {
+			ret = append(ret, v)
+			continue
+		}
+		pe := findElement(p, mergeKey, om[mergeKey])
+		if _, ok := om[mergeKey]; !ok || pe == nil {
+			ret = append(ret, v)
+			continue
+		}
+
+		pe = maps.Clone(pe)
+		added := pe[AddedMarker] == true
+		delete(pe, AddedMarker)
+		if added && contains(om, pe) {
+			continue
+		}
+
+		// keep the merge key: the element is removed if nothing else is left
+		delete(pe, mergeKey)
+		if err := revertMap(om, pe, meta); err != nil {
+			return nil, err
+		}
+		if len(om) > 1 {
+			ret = append(ret, om)
+		}
+	}
+
+	return ret, nil
+}
+
+// DroppedPatchContent returns the content of the last patch that is no longer set by the next
+// patch, with the marks of the last patch, so that it can be reverted with
+// RevertStrategicMergePatch before the next patch is applied. Returns nil if nothing is dropped.
+func DroppedPatchContent(last, next map[string]any, meta strategicpatch.LookupPatchMeta) (map[string]any, error) {
+	ret, err := droppedMap(last, next, meta)
+	if err != nil || len(ret) == 0 {
 		return nil, err
 	}
+	return ret, nil
+}
+
+func droppedMap(last, next map[string]any, meta strategicpatch.LookupPatchMeta) (map[string]any, error) {
+	ret := map[string]any{}
+	lastPriors, _ := last[PriorMarker].(map[string]any)
+	priors := map[string]any{}
 
-	return patched, nil
+	for k, lv := range last {
+		if k == PriorMarker || k == AddedMarker {
+			continue
+		}
+
+		nv, ok := next[k]
+		if !ok {
+			ret[k] = deepCopy(lv)
+			if prior, ok := lastPriors[k]; ok {
+				priors[k] = deepCopy(prior)
+			}
+			continue
+		}
+
+		switch x := lv.(type) {
+		case map[string]any:
+			nm, ok := nv.(map[string]any)
+			if !ok {
+				continue
+			}
+			sub, _, err := meta.LookupPatchMetadataForStruct(k)
+			if err != nil {
+				return nil, err
+			}
+			d, err := droppedMap(x, nm, sub)
+			if err != nil {
+				return nil, err
+			}
+			if len(d) > 0 {
+				ret[k] = d
+			}
+
+		case []any:
+			nl, ok := nv.([]any)
+			if !ok {
+				continue
+			}
+			sub, pm, err := meta.LookupPatchMetadataForSlice(k)
+			if err != nil {
+				return nil, err
+			}
+			// replaced lists are overwritten by the next patch
+			if !slices.Contains(pm.GetPatchStrategies(), "merge") {
+				continue
+			}
+			d, err := droppedList(x, nl, sub, pm.GetPatchMergeKey())
+			if err != nil {
+				return nil, err
+			}
+			if len(d) > 0 {
+				ret[k] = d
+			}
+		}
+	}
+
+	if len(priors) > 0 {
+		ret[PriorMarker] = priors
+	}
+
+	return ret, nil
+}
+
+func droppedList(last, next []any, meta strategicpatch.LookupPatchMeta, mergeKey string) ([]any, error) {
+	ret := []any{}
+	for _, v := range last {
+		lm, ok := v.(map[string]any)
+		if mergeKey == "" || !ok {
+			// sets of primitives
+			if !slices.ContainsFunc(next, func(nv any) bool { return reflect.DeepEqual(v, nv) }) {
+				ret = append(ret, deepCopy(v))
+			}
+			continue
+		}
+
+		ne := findElement(next, mergeKey, lm[mergeKey])
+		if ne == nil {
+			ret = append(ret, deepCopy(lm))
+			continue
+		}
+		d, err := droppedMap(lm, ne, meta)
+		if err != nil {
+			return nil, err
+		}
+		if len(d) > 0 {
+			d[mergeKey] = lm[mergeKey]
+			ret = append(ret, d)
+		}
+	}
+	return ret, nil
+}
+
+// findElement returns the element of a list with the given merge key value.
+func findElement(l []any, mergeKey string, value any) map[string]any {
+	if value == nil {
+		return nil
+	}
+	for _, v := range l {
+		if m, ok := v.(map[string]any); ok && reflect.DeepEqual(m[mergeKey], value) {
+			return m
+		}
+	}
+	return nil
+}
+
+// contains checks whether the value o contains the value p: maps must contain all the keys of p
+// with the values contained, lists must be of the same length with the elements contained. This
+// allows the object to have extra fields, e.g., the defaults set by the API server.
+func contains(o, p any) bool {
+	switch x := p.(type) {
+	case map[string]any:
+		om, ok := o.(map[string]any)
+		if !ok {
+			return false
+		}
+		for k, v := range x {
+			if ov, ok := om[k]; !ok || !contains(ov, v) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		ol, ok := o.([]any)
+		if !ok || len(ol) != len(x) {
+			return false
+		}
+		for i := range x {
+			if !contains(ol[i], x[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(o, p)
+	}
 }
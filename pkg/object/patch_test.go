@@ -1,8 +1,18 @@
 package object
 
 import (
+	"context"
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 var _ = Describe("Object patching", func() {
@@ -131,3 +141,419 @@ var _ = Describe("Object patching", func() {
 		})
 	})
 })
+
+var _ = Describe("Strategic merge patching", func() {
+	var (
+		ctx     context.Context
+		widget  = schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+		podGVK  = schema.GroupVersionKind{Group: "", Version: "v1", Kind: "Pod"}
+		listMap = "map"
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	newObj := func(gvk schema.GroupVersionKind, content map[string]any) Object {
+		obj := New()
+		obj.SetUnstructuredContent(content)
+		obj.SetGroupVersionKind(gvk)
+		obj.SetName("test")
+		obj.SetNamespace("default")
+		return obj
+	}
+
+	It("should merge the lists of built-in types by the merge key", func() {
+		r := NewPatchMetaResolver(GetBaseScheme(), nil, nil)
+		m, err := r.Lookup(ctx, podGVK)
+		Expect(err).NotTo(HaveOccurred())
+
+		pod := newObj(podGVK, map[string]any{"spec": map[string]any{
+			"containers": []any{
+				map[string]any{"name": "nginx", "image": "nginx", "ports": []any{
+					map[string]any{"containerPort": int64(80)},
+				}},
+				map[string]any{"name": "sidecar", "image": "busybox"},
+			},
+		}})
+		patch := newObj(podGVK, map[string]any{"spec": map[string]any{
+			"containers": []any{
+				map[string]any{"name": "nginx", "image": "nginx:latest", "ports": []any{
+					map[string]any{"containerPort": int64(80), "protocol": "TCP"},
+				}},
+			},
+		}})
+
+		res, err := ApplyStrategicMergePatch(pod, patch, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.UnstructuredContent()["spec"]).To(Equal(map[string]any{
+			"containers": []any{
+				map[string]any{"name": "nginx", "image": "nginx:latest", "ports": []any{
+					map[string]any{"containerPort": int64(80), "protocol": "TCP"},
+				}},
+				map[string]any{"name": "sidecar", "image": "busybox"},
+			},
+		}))
+
+		// the original is not modified
+		cs, ok, err := unstructured.NestedSlice(pod.UnstructuredContent(), "spec", "containers")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(cs[0].(map[string]any)["image"]).To(Equal("nginx"))
+	})
+
+	It("should use the list markers of CRDs", func() {
+		crd := &apiextensionsv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "widgets.example.com"},
+			Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+				Group: "example.com",
+				Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "widgets", Kind: "Widget"},
+				Scope: apiextensionsv1.NamespaceScoped,
+				Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{
+					Name: "v1", Served: true, Storage: true,
+					Schema: &apiextensionsv1.CustomResourceValidation{
+						OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+							Type: "object",
+							Properties: map[string]apiextensionsv1.JSONSchemaProps{
+								"spec": {
+									Type: "object",
+									Properties: map[string]apiextensionsv1.JSONSchemaProps{
+										"ports": {
+											Type:         "array",
+											XListType:    &listMap,
+											XListMapKeys: []string{"port"},
+											Items: &apiextensionsv1.JSONSchemaPropsOrArray{
+												Schema: &apiextensionsv1.JSONSchemaProps{Type: "object"},
+											},
+										},
+										"endpoints": {
+											Type:         "array",
+											XListType:    &listMap,
+											XListMapKeys: []string{"port", "protocol"},
+											Items: &apiextensionsv1.JSONSchemaPropsOrArray{
+												Schema: &apiextensionsv1.JSONSchemaProps{Type: "object"},
+											},
+										},
+										"hosts": {
+											Type: "array",
+											Items: &apiextensionsv1.JSONSchemaPropsOrArray{
+												Schema: &apiextensionsv1.JSONSchemaProps{Type: "string"},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				}},
+			},
+		}
+
+		scheme := GetBaseScheme()
+		Expect(apiextensionsv1.AddToScheme(scheme)).To(Succeed())
+		reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(crd).Build()
+		mapper := meta.NewDefaultRESTMapper(nil)
+		mapper.Add(widget, meta.RESTScopeNamespace)
+
+		r := NewPatchMetaResolver(GetBaseScheme(), mapper, reader)
+		m, err := r.Lookup(ctx, widget)
+		Expect(err).NotTo(HaveOccurred())
+
+		obj := newObj(widget, map[string]any{"spec": map[string]any{
+			"ports": []any{
+				map[string]any{"port": int64(80), "name": "http"},
+				map[string]any{"port": int64(443), "name": "https"},
+			},
+			"endpoints": []any{
+				map[string]any{"port": int64(53), "protocol": "UDP"},
+				map[string]any{"port": int64(53), "protocol": "TCP"},
+			},
+			"hosts": []any{"a", "b"},
+		}})
+		patch := newObj(widget, map[string]any{"spec": map[string]any{
+			"ports":     []any{map[string]any{"port": int64(443), "name": "tls"}},
+			"endpoints": []any{map[string]any{"port": int64(53), "protocol": "TCP", "name": "dns"}},
+			"hosts":     []any{"c"},
+		}})
+
+		res, err := ApplyStrategicMergePatch(obj, patch, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.UnstructuredContent()["spec"]).To(Equal(map[string]any{
+			"ports": []any{
+				map[string]any{"port": int64(80), "name": "http"},
+				map[string]any{"port": int64(443), "name": "tls"},
+			},
+			// list maps with composite keys and atomic lists are replaced
+			"endpoints": []any{map[string]any{"port": int64(53), "protocol": "TCP", "name": "dns"}},
+			"hosts":     []any{"c"},
+		}))
+
+		// schema changes are picked up after the cached metadata expires
+		ports := crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"].Properties["ports"]
+		ports.XListType, ports.XListMapKeys = nil, nil
+		crd.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"].Properties["ports"] = ports
+		Expect(reader.Update(ctx, crd)).To(Succeed())
+
+		m, err = r.Lookup(ctx, widget)
+		Expect(err).NotTo(HaveOccurred())
+		spec, _, err := m.LookupPatchMetadataForStruct("spec")
+		Expect(err).NotTo(HaveOccurred())
+		_, pm, err := spec.LookupPatchMetadataForSlice("ports")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pm.GetPatchMergeKey()).To(Equal("port"))
+
+		r.metas[widget] = patchMetaEntry{meta: m, expires: time.Now()}
+		m, err = r.Lookup(ctx, widget)
+		Expect(err).NotTo(HaveOccurred())
+		spec, _, err = m.LookupPatchMetadataForStruct("spec")
+		Expect(err).NotTo(HaveOccurred())
+		_, pm, err = spec.LookupPatchMetadataForSlice("ports")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pm.GetPatchMergeKey()).To(BeEmpty())
+	})
+
+	It("should replace the lists of views", func() {
+		r := NewPatchMetaResolver(GetBaseScheme(), nil, nil)
+		m, err := r.Lookup(ctx, NewViewObject("view").GroupVersionKind())
+		Expect(err).NotTo(HaveOccurred())
+
+		obj := NewViewObject("view")
+		SetContent(obj, map[string]any{"a": []any{int64(1), int64(2)}, "b": map[string]any{"c": "x"}})
+		patch := NewViewObject("view")
+		SetContent(patch, map[string]any{"a": []any{int64(3)}, "b": map[string]any{"d": "y"}})
+
+		res, err := ApplyStrategicMergePatch(obj, patch, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.UnstructuredContent()).To(Equal(map[string]any{
+			"apiVersion": "view.dcontroller.io/v1alpha1",
+			"kind":       "view",
+			"a":          []any{int64(3)},
+			"b":          map[string]any{"c": "x", "d": "y"},
+		}))
+	})
+})
+
+var _ = Describe("Reverting strategic merge patches", func() {
+	podGVK := schema.GroupVersionKind{Group: "", Version: "v1", Kind: "Pod"}
+
+	newPod := func(content map[string]any) Object {
+		obj := New()
+		obj.SetUnstructuredContent(content)
+		obj.SetGroupVersionKind(podGVK)
+		obj.SetName("test")
+		obj.SetNamespace("default")
+		return obj
+	}
+
+	It("should remove only the fields and the list elements set by the patch", func() {
+		m, err := NewPatchMetaResolver(GetBaseScheme(), nil, nil).Lookup(context.Background(), podGVK)
+		Expect(err).NotTo(HaveOccurred())
+
+		pod := newPod(map[string]any{"spec": map[string]any{
+			"restartPolicy": "Never",
+			"hostname":      "changed",
+			"containers": []any{
+				map[string]any{"name": "nginx", "image": "nginx", "env": []any{
+					map[string]any{"name": "KEY", "value": "value"},
+					map[string]any{"name": "OTHER", "value": "other"},
+				}},
+				map[string]any{"name": "sidecar", "image": "busybox"},
+				map[string]any{"name": "modified", "image": "other"},
+			},
+		}})
+		patch := New()
+		patch.SetUnstructuredContent(map[string]any{"spec": map[string]any{
+			"restartPolicy": "Never",
+			"hostname":      "original",
+			"containers": []any{
+				map[string]any{"name": "nginx", "env": []any{
+					map[string]any{"name": "KEY", "value": "value"},
+				}},
+				map[string]any{"name": "sidecar", "image": "busybox"},
+				map[string]any{"name": "modified", "image": "busybox"},
+			},
+		}})
+
+		res, err := RevertStrategicMergePatch(pod, patch, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.UnstructuredContent()["spec"]).To(Equal(map[string]any{
+			"hostname": "changed",
+			"containers": []any{
+				map[string]any{"name": "nginx", "image": "nginx", "env": []any{
+					map[string]any{"name": "OTHER", "value": "other"},
+				}},
+				map[string]any{"name": "modified", "image": "other"},
+			},
+		}))
+		Expect(res.GetName()).To(Equal("test"))
+
+		// the original is not modified
+		Expect(pod.UnstructuredContent()["spec"]).To(HaveKey("restartPolicy"))
+	})
+
+	It("should remove the list elements added by the patch", func() {
+		m, err := NewPatchMetaResolver(GetBaseScheme(), nil, nil).Lookup(context.Background(), podGVK)
+		Expect(err).NotTo(HaveOccurred())
+
+		pod := newPod(map[string]any{"spec": map[string]any{
+			"containers": []any{map[string]any{"name": "nginx", "image": "nginx"}},
+		}})
+		patch := map[string]any{"spec": map[string]any{
+			"containers": []any{
+				map[string]any{"name": "nginx", "env": []any{map[string]any{"name": "KEY", "value": "value"}}},
+				map[string]any{"name": "sidecar", "image": "busybox"},
+			},
+		}}
+
+		content, err := MarkPatch(pod, patch, nil, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(content).To(Equal(map[string]any{"spec": map[string]any{
+			"containers": []any{
+				map[string]any{"name": "nginx", "env": []any{
+					map[string]any{"name": "KEY", "value": "value", AddedMarker: true},
+				}},
+				map[string]any{"name": "sidecar", "image": "busybox", AddedMarker: true},
+			},
+		}}))
+		Expect(patch["spec"].(map[string]any)["containers"].([]any)[1]).NotTo(HaveKey(AddedMarker))
+
+		// the patched object, with the defaults set by the API server
+		patched := newPod(map[string]any{"spec": map[string]any{
+			"containers": []any{
+				map[string]any{"name": "nginx", "image": "nginx", "env": []any{
+					map[string]any{"name": "KEY", "value": "value"},
+				}},
+				map[string]any{"name": "sidecar", "image": "busybox", "imagePullPolicy": "Always"},
+			},
+		}})
+
+		// the marks of the last patch are kept
+		content2, err := MarkPatch(patched, patch, content, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(content2).To(Equal(content))
+
+		res, err := RevertStrategicMergePatch(patched, &unstructured.Unstructured{Object: content2}, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.UnstructuredContent()["spec"]).To(Equal(map[string]any{
+			"containers": []any{map[string]any{"name": "nginx", "image": "nginx"}},
+		}))
+	})
+
+	It("should restore the values overwritten by the patch", func() {
+		m, err := NewPatchMetaResolver(GetBaseScheme(), nil, nil).Lookup(context.Background(), podGVK)
+		Expect(err).NotTo(HaveOccurred())
+
+		pod := newPod(map[string]any{"spec": map[string]any{
+			"restartPolicy": "OnFailure",
+			"hostname":      "original",
+		}})
+		patch := map[string]any{"spec": map[string]any{
+			"restartPolicy": "Always",
+			"hostname":      "original",
+			"subdomain":     "added",
+		}}
+
+		content, err := MarkPatch(pod, patch, nil, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(content["spec"]).To(HaveKeyWithValue(PriorMarker, map[string]any{
+			"restartPolicy": "OnFailure",
+			"hostname":      "original",
+		}))
+
+		patched := newPod(map[string]any{"spec": map[string]any{
+			"restartPolicy": "Always",
+			"hostname":      "original",
+			"subdomain":     "added",
+		}})
+
+		// the values overwritten by the first patch are kept
+		content2, err := MarkPatch(patched, patch, content, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(content2).To(Equal(content))
+
+		res, err := RevertStrategicMergePatch(patched, &unstructured.Unstructured{Object: content2}, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.UnstructuredContent()["spec"]).To(Equal(map[string]any{
+			"restartPolicy": "OnFailure",
+			"hostname":      "original",
+		}))
+	})
+
+	It("should find the content dropped from the last patch", func() {
+		m, err := NewPatchMetaResolver(GetBaseScheme(), nil, nil).Lookup(context.Background(), podGVK)
+		Expect(err).NotTo(HaveOccurred())
+
+		last := map[string]any{"spec": map[string]any{
+			PriorMarker:     map[string]any{"restartPolicy": "OnFailure"},
+			"restartPolicy": "Always",
+			"hostname":      "host",
+			"containers": []any{
+				map[string]any{"name": "nginx", "image": "nginx:1", "env": []any{
+					map[string]any{"name": "KEY", "value": "value", AddedMarker: true},
+				}},
+				map[string]any{"name": "sidecar", "image": "busybox", AddedMarker: true},
+			},
+		}}
+		next := map[string]any{"spec": map[string]any{
+			"hostname": "other",
+			"containers": []any{
+				map[string]any{"name": "nginx", "image": "nginx:2"},
+			},
+		}}
+
+		dropped, err := DroppedPatchContent(last, next, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dropped).To(Equal(map[string]any{"spec": map[string]any{
+			PriorMarker:     map[string]any{"restartPolicy": "OnFailure"},
+			"restartPolicy": "Always",
+			"containers": []any{
+				map[string]any{"name": "nginx", "env": []any{
+					map[string]any{"name": "KEY", "value": "value", AddedMarker: true},
+				}},
+				map[string]any{"name": "sidecar", "image": "busybox", AddedMarker: true},
+			},
+		}}))
+
+		// the object patched with the last patch
+		pod := newPod(map[string]any{"spec": map[string]any{
+			"restartPolicy": "Always",
+			"hostname":      "host",
+			"containers": []any{
+				map[string]any{"name": "nginx", "image": "nginx:1", "env": []any{
+					map[string]any{"name": "KEY", "value": "value"},
+				}},
+				map[string]any{"name": "sidecar", "image": "busybox"},
+			},
+		}})
+		res, err := RevertStrategicMergePatch(pod, &unstructured.Unstructured{Object: dropped}, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.UnstructuredContent()["spec"]).To(Equal(map[string]any{
+			"restartPolicy": "OnFailure",
+			"hostname":      "host",
+			"containers": []any{
+				map[string]any{"name": "nginx", "image": "nginx:1"},
+			},
+		}))
+
+		dropped, err = DroppedPatchContent(next, next, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dropped).To(BeNil())
+	})
+
+	It("should remove replaced lists only if unchanged", func() {
+		m := NewPatchMetaFromSchema(nil)
+
+		obj := NewViewObject("view")
+		SetContent(obj, map[string]any{"a": []any{int64(1), int64(2)}, "b": []any{int64(3)}})
+		patch := NewViewObject("view")
+		SetContent(patch, map[string]any{"a": []any{int64(1), int64(2)}, "b": []any{int64(4)}})
+
+		res, err := RevertStrategicMergePatch(obj, patch, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.UnstructuredContent()).To(Equal(map[string]any{
+			"apiVersion": "view.dcontroller.io/v1alpha1",
+			"kind":       "view",
+			"b":          []any{int64(3)},
+		}))
+	})
+})
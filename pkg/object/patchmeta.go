@@ -0,0 +1,197 @@
+package object
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	viewv1a1 "hsnlab/dcontroller/pkg/api/view/v1alpha1"
+)
+
+// PatchMetaResolver finds the strategic merge patch metadata, i.e., the patch strategies and the
+// merge keys of lists, of a resource:
+//   - for the types registered in the scheme (usually the built-in Kubernetes types) the metadata
+//     comes from the patchStrategy and patchMergeKey struct tags,
+//   - for custom resources the metadata is derived from the x-kubernetes-list-type and
+//     x-kubernetes-list-map-keys markers of the OpenAPI schema in the CRD,
+//   - views and all other resources have no schema, so lists are replaced.
+//
+// The metadata is cached per GVK. The metadata of custom resources expires after
+// PatchMetaTTL so that the changes in the CRD schemas are eventually picked up.
+type PatchMetaResolver struct {
+	scheme *runtime.Scheme
+	mapper meta.RESTMapper
+	reader client.Reader
+	metas  map[schema.GroupVersionKind]patchMetaEntry
+	mu     sync.Mutex
+}
+
+// PatchMetaTTL is the time after which the cached patch metadata of custom resources is reloaded
+// from the CRD.
+const PatchMetaTTL = time.Minute
+
+// patchMetaEntry is a cached patch metadata. A zero expiry means that the entry never expires.
+type patchMetaEntry struct {
+	meta    strategicpatch.LookupPatchMeta
+	expires time.Time
+}
+
+// NewPatchMetaResolver creates a new patch metadata resolver. The REST mapper and the reader are
+// used to load CRDs, if any of them is nil then custom resources are treated as schemaless.
+func NewPatchMetaResolver(scheme *runtime.Scheme, mapper meta.RESTMapper, reader client.Reader) *PatchMetaResolver {
+	return &PatchMetaResolver{
+		scheme: scheme,
+		mapper: mapper,
+		reader: reader,
+		metas:  map[schema.GroupVersionKind]patchMetaEntry{},
+	}
+}
+
+// Lookup returns the patch metadata for a GVK.
+func (r *PatchMetaResolver) Lookup(ctx context.Context, gvk schema.GroupVersionKind) (strategicpatch.LookupPatchMeta, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if e, ok := r.metas[gvk]; ok && (e.expires.IsZero() || now.Before(e.expires)) {
+		return e.meta, nil
+	}
+
+	m, err := r.lookup(ctx, gvk)
+	if err != nil {
+		return nil, err
+	}
+
+	e := patchMetaEntry{meta: m}
+	if gvk.Group != viewv1a1.GroupVersion.Group && (r.scheme == nil || !r.scheme.Recognizes(gvk)) {
+		// the schema of custom resources may change
+		e.expires = now.Add(PatchMetaTTL)
+	}
+	r.metas[gvk] = e
+
+	return m, nil
+}
+
+func (r *PatchMetaResolver) lookup(ctx context.Context, gvk schema.GroupVersionKind) (strategicpatch.LookupPatchMeta, error) {
+	if gvk.Group == viewv1a1.GroupVersion.Group {
+		return NewPatchMetaFromSchema(nil), nil
+	}
+
+	if r.scheme != nil && r.scheme.Recognizes(gvk) {
+		obj, err := r.scheme.New(gvk)
+		if err != nil {
+			return nil, err
+		}
+		return strategicpatch.NewPatchMetaFromStruct(obj)
+	}
+
+	if r.mapper == nil || r.reader == nil {
+		return NewPatchMetaFromSchema(nil), nil
+	}
+
+	mapping, err := r.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find REST mapping for %s: %w", gvk.String(), err)
+	}
+	if mapping == nil {
+		return NewPatchMetaFromSchema(nil), nil
+	}
+
+	obj := New()
+	obj.SetGroupVersionKind(apiextensionsv1.SchemeGroupVersion.WithKind("CustomResourceDefinition"))
+	key := client.ObjectKey{Name: mapping.Resource.Resource + "." + gvk.Group}
+	if err := r.reader.Get(ctx, key, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			// not a CRD, e.g., an aggregated API
+			return NewPatchMetaFromSchema(nil), nil
+		}
+		return nil, fmt.Errorf("cannot get CRD %s: %w", key.Name, err)
+	}
+
+	crd := apiextensionsv1.CustomResourceDefinition{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), &crd); err != nil {
+		return nil, fmt.Errorf("invalid CRD %s: %w", key.Name, err)
+	}
+
+	for _, v := range crd.Spec.Versions {
+		if v.Name == gvk.Version && v.Schema != nil {
+			return NewPatchMetaFromSchema(v.Schema.OpenAPIV3Schema), nil
+		}
+	}
+
+	return NewPatchMetaFromSchema(nil), nil
+}
+
+// schemaPatchMeta is the patch metadata derived from an OpenAPI v3 schema. Lists of type "map"
+// with a single list map key are merged using the key as the merge key, lists of type "set" are
+// merged as sets of values, while atomic lists and the lists of unknown fields are replaced.
+// Strategic merge patches support only a single merge key, so lists of type "map" with composite
+// keys are treated as atomic lists and replaced.
+type schemaPatchMeta struct {
+	name   string
+	schema *apiextensionsv1.JSONSchemaProps
+}
+
+var _ strategicpatch.LookupPatchMeta = schemaPatchMeta{}
+
+// NewPatchMetaFromSchema returns the patch metadata for an OpenAPI v3 schema, or the metadata of
+// a schemaless object if the schema is nil.
+func NewPatchMetaFromSchema(s *apiextensionsv1.JSONSchemaProps) strategicpatch.LookupPatchMeta {
+	return schemaPatchMeta{schema: s}
+}
+
+func (s schemaPatchMeta) LookupPatchMetadataForStruct(key string) (strategicpatch.LookupPatchMeta, strategicpatch.PatchMeta, error) {
+	return schemaPatchMeta{name: key, schema: s.property(key)}, strategicpatch.PatchMeta{}, nil
+}
+
+func (s schemaPatchMeta) LookupPatchMetadataForSlice(key string) (strategicpatch.LookupPatchMeta, strategicpatch.PatchMeta, error) {
+	pm := strategicpatch.PatchMeta{}
+	prop := s.property(key)
+	if prop == nil {
+		return schemaPatchMeta{name: key}, pm, nil
+	}
+
+	if prop.XListType != nil {
+		switch *prop.XListType {
+		case "map":
+			if len(prop.XListMapKeys) == 1 {
+				pm.SetPatchStrategies([]string{"merge"})
+				pm.SetPatchMergeKey(prop.XListMapKeys[0])
+			}
+		case "set":
+			pm.SetPatchStrategies([]string{"merge"})
+		}
+	}
+
+	var items *apiextensionsv1.JSONSchemaProps
+	if prop.Items != nil {
+		items = prop.Items.Schema
+	}
+
+	return schemaPatchMeta{name: key, schema: items}, pm, nil
+}
+
+func (s schemaPatchMeta) Name() string { return s.name }
+
+// property returns the schema of a field, or nil if the field is not known.
+func (s schemaPatchMeta) property(key string) *apiextensionsv1.JSONSchemaProps {
+	if s.schema == nil {
+		return nil
+	}
+	if p, ok := s.schema.Properties[key]; ok {
+		return &p
+	}
+	if s.schema.AdditionalProperties != nil {
+		return s.schema.AdditionalProperties.Schema
+	}
+	return nil
+}
@@ -21,6 +21,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	dcontroller "hsnlab/dcontroller/pkg/controller"
 	"hsnlab/dcontroller/pkg/manager"
 	"hsnlab/dcontroller/pkg/util"
 )
@@ -36,6 +37,21 @@ type Controller interface {
 	GetManager() runtimeManager.Manager
 }
 
+// ControllerOptions can be used to customize the operator controller.
+type ControllerOptions struct {
+	runtimeManager.Options
+
+	// StateBackend, if set, is passed to each operator to persist the state of its controllers
+	// across restarts.
+	StateBackend dcontroller.StateBackend
+
+	// EnableTraceEndpoint exposes the pipeline traces of the controllers at TraceEndpoint on the
+	// metrics server. The endpoint allows to read the traces and to change the trace settings, so
+	// it is disabled by default: when enabled, consider protecting the metrics server with a
+	// FilterProvider.
+	EnableTraceEndpoint bool
+}
+
 type opEntry struct {
 	op        *Operator
 	cancel    context.CancelFunc
@@ -48,13 +64,15 @@ type controller struct {
 	operators   map[types.NamespacedName]*opEntry
 	mu          sync.Mutex
 	options     runtimeManager.Options
+	state       dcontroller.StateBackend
 	ctx         context.Context
 	started     bool
 	logger, log logr.Logger
 }
 
 // NewController creates a new Kubernetes controller that handles the Operator CRDs.
-func NewController(config *rest.Config, options runtimeManager.Options) (Controller, error) {
+func NewController(config *rest.Config, opts ControllerOptions) (Controller, error) {
+	options := opts.Options
 	logger := options.Logger
 	if logger.GetSink() == nil {
 		logger = logr.Discard()
@@ -75,6 +93,7 @@ func NewController(config *rest.Config, options runtimeManager.Options) (Control
 		Client:    mgr.GetClient(),
 		mgr:       mgr,
 		options:   options,
+		state:     opts.StateBackend,
 		operators: make(map[types.NamespacedName]*opEntry),
 		logger:    logger,
 		log:       logger.WithName("opcontroller"),
@@ -101,6 +120,13 @@ func NewController(config *rest.Config, options runtimeManager.Options) (Control
 
 	controller.log.Info("watching operaror objects")
 
+	// Expose the pipeline traces on the metrics server (no-op if the metrics server is disabled)
+	if opts.EnableTraceEndpoint {
+		if err := mgr.AddMetricsServerExtraHandler(TraceEndpoint, controller.traceHandler()); err != nil {
+			return nil, fmt.Errorf("failed to register trace endpoint: %w", err)
+		}
+	}
+
 	return controller, nil
 }
 
@@ -211,6 +237,7 @@ func (c *controller) addOperator(spec *opv1a1.Operator) (*Operator, error) {
 	operator := New(spec.GetName(), mgr, &spec.Spec, Options{
 		ErrorChannel: errorChan,
 		Logger:       c.logger,
+		StateBackend: c.state,
 	})
 
 	c.mu.Lock()
@@ -238,6 +265,7 @@ func (c *controller) deleteOperator(k types.NamespacedName) {
 	}
 
 	delete(c.operators, k)
+	unregisterMetrics(k.Name)
 }
 
 func (c *controller) getOperatorEntry(key types.NamespacedName) *opEntry {
@@ -0,0 +1,66 @@
+package operator
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	runtimeManager "sigs.k8s.io/controller-runtime/pkg/manager"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	dcontroller "hsnlab/dcontroller/pkg/controller"
+)
+
+func TestOperator(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Operator")
+}
+
+var _ = Describe("Operator controller", func() {
+	It("should pass the state backend to the operators", func() {
+		state := dcontroller.NewFileStateBackend(GinkgoT().TempDir())
+
+		// the managers are never started so there is no need for an API server
+		c, err := NewController(&rest.Config{Host: "http://127.0.0.1:1"}, ControllerOptions{
+			Options: runtimeManager.Options{
+				HealthProbeBindAddress: "0",
+				Metrics:                metricsserver.Options{BindAddress: "0"},
+			},
+			StateBackend: state,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		spec := &opv1a1.Operator{}
+		spec.SetName("test-operator")
+		op, err := c.(*controller).addOperator(spec)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() { c.(*controller).deleteOperator(client.ObjectKeyFromObject(spec)) })
+
+		Expect(op.state).To(BeIdenticalTo(state))
+	})
+
+	It("should expose the trace endpoint only when enabled", func() {
+		for _, enabled := range []bool{false, true} {
+			c, err := NewController(&rest.Config{Host: "http://127.0.0.1:1"}, ControllerOptions{
+				Options: runtimeManager.Options{
+					HealthProbeBindAddress: "0",
+					Metrics:                metricsserver.Options{BindAddress: ":0"},
+				},
+				EnableTraceEndpoint: enabled,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// registering the endpoint again fails if the controller has registered it
+			err = c.GetManager().AddMetricsServerExtraHandler(TraceEndpoint, http.NotFoundHandler())
+			if enabled {
+				Expect(err).To(HaveOccurred())
+			} else {
+				Expect(err).NotTo(HaveOccurred())
+			}
+		}
+	})
+})
@@ -0,0 +1,102 @@
+package operator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// TraceEndpoint is the path of the HTTP debug endpoint on the metrics server of the manager that
+// exposes the pipeline traces of the controllers.
+//
+//   - GET /debug/traces lists the controllers and their trace size.
+//   - GET /debug/traces?operator=<op>&controller=<ctrl> returns the recorded traces of a controller.
+//   - PUT /debug/traces?operator=<op>&controller=<ctrl>&size=<n> records the traces of the last n
+//     requests processed by the controller. Setting the size to zero disables tracing.
+const TraceEndpoint = "/debug/traces"
+
+// TraceInfo describes the trace settings of a controller.
+type TraceInfo struct {
+	Operator   string `json:"operator"`
+	Controller string `json:"controller"`
+	Size       int    `json:"size"`
+}
+
+func (c *controller) traceHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		opName, ctrlName := q.Get("operator"), q.Get("controller")
+
+		if opName == "" && ctrlName == "" {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			writeJSON(w, c.listTraceInfo())
+			return
+		}
+
+		e := c.getOperatorEntry(types.NamespacedName{Name: opName})
+		if e == nil {
+			http.Error(w, fmt.Sprintf("operator %q not found", opName), http.StatusNotFound)
+			return
+		}
+		ctrl := e.op.GetController(ctrlName)
+		if ctrl == nil {
+			http.Error(w, fmt.Sprintf("controller %q not found in operator %q", ctrlName, opName),
+				http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, ctrl.GetTraces())
+		case http.MethodPut, http.MethodPost:
+			size, err := strconv.Atoi(q.Get("size"))
+			if err != nil || size < 0 {
+				http.Error(w, fmt.Sprintf("invalid trace size %q", q.Get("size")), http.StatusBadRequest)
+				return
+			}
+			c.log.Info("setting trace size", "operator", opName, "controller", ctrlName, "size", size)
+			ctrl.SetTraceSize(size)
+			writeJSON(w, TraceInfo{Operator: opName, Controller: ctrlName, Size: size})
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (c *controller) listTraceInfo() []TraceInfo {
+	c.mu.Lock()
+	ops := make([]*Operator, 0, len(c.operators))
+	for _, e := range c.operators {
+		ops = append(ops, e.op)
+	}
+	c.mu.Unlock()
+
+	sort.Slice(ops, func(i, j int) bool { return ops[i].name < ops[j].name })
+
+	ret := []TraceInfo{}
+	for _, op := range ops {
+		for _, ctrl := range op.controllers {
+			ret = append(ret, TraceInfo{
+				Operator:   op.name,
+				Controller: ctrl.GetName(),
+				Size:       ctrl.GetTraceSize(),
+			})
+		}
+	}
+
+	return ret
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
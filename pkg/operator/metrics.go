@@ -0,0 +1,63 @@
+package operator
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	runtimeManager "sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"hsnlab/dcontroller/pkg/cache"
+	dcontroller "hsnlab/dcontroller/pkg/controller"
+)
+
+var viewObjectsDesc = prometheus.NewDesc(
+	"dcontroller_view_objects",
+	"Number of objects in the view cache of the operator.",
+	[]string{"operator", "view", "version"}, nil,
+)
+
+// viewCollector collects the number of objects in the view caches of the operators at scrape
+// time.
+type viewCollector struct {
+	mu     sync.Mutex
+	caches map[string]*cache.ViewCache
+}
+
+var views = &viewCollector{caches: map[string]*cache.ViewCache{}}
+
+func init() {
+	metrics.Registry.MustRegister(views)
+}
+
+func (v *viewCollector) Describe(ch chan<- *prometheus.Desc) { ch <- viewObjectsDesc }
+
+func (v *viewCollector) Collect(ch chan<- prometheus.Metric) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for op, c := range v.caches {
+		for gvk, n := range c.Count() {
+			ch <- prometheus.MustNewConstMetric(viewObjectsDesc, prometheus.GaugeValue, float64(n),
+				op, gvk.Kind, gvk.Version)
+		}
+	}
+}
+
+// registerMetrics adds the view cache of an operator to the metrics.
+func registerMetrics(name string, mgr runtimeManager.Manager) {
+	cc, ok := mgr.GetCache().(*cache.CompositeCache)
+	if !ok {
+		return
+	}
+	views.mu.Lock()
+	views.caches[name] = cc.GetViewCache()
+	views.mu.Unlock()
+}
+
+// unregisterMetrics removes the metrics of an operator and its controllers.
+func unregisterMetrics(name string) {
+	views.mu.Lock()
+	delete(views.caches, name)
+	views.mu.Unlock()
+	dcontroller.DeleteMetrics(name)
+}
@@ -26,6 +26,10 @@ type Options struct {
 
 	// Logger is a standard logger.
 	Logger logr.Logger
+
+	// StateBackend, if set, is used to persist the state of the controllers across restarts. The
+	// state of each controller is saved under the key <operator-name>-<controller-name>.
+	StateBackend dcontroller.StateBackend
 }
 
 type Operator struct {
@@ -35,6 +39,7 @@ type Operator struct {
 	controllers []*dcontroller.Controller // maybe nil
 	ctx         context.Context
 	errorChan   chan error
+	state       dcontroller.StateBackend
 	logger, log logr.Logger
 }
 
@@ -51,10 +56,13 @@ func New(name string, mgr runtimeManager.Manager, spec *opv1a1.OperatorSpec, opt
 		spec:        spec,
 		controllers: []*dcontroller.Controller{},
 		errorChan:   opts.ErrorChannel,
+		state:       opts.StateBackend,
 		logger:      logger,
 		log:         logger.WithName("operator").WithValues("name", name),
 	}
 
+	registerMetrics(name, mgr)
+
 	// Create the controllers for the operator (manager.Start() will automatically start them)
 	for _, config := range spec.Controllers {
 		if err := op.AddController(config); err != nil {
@@ -96,7 +104,11 @@ func (op *Operator) GetController(name string) *dcontroller.Controller {
 // AddController adds a new controller to the operator.
 func (op *Operator) AddController(config opv1a1.Controller) error {
 	c, err := dcontroller.New(op.mgr, config, dcontroller.Options{
-		ErrorChan: op.errorChan,
+		ErrorChan:    op.errorChan,
+		StateBackend: op.state,
+		StateKey:     op.name + "-" + config.Name,
+		FieldManager: "dcontroller-" + op.name + "-" + config.Name,
+		Operator:     op.name,
 	})
 
 	// the controller returned is always valid: this makes sure we will receive the
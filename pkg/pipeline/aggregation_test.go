@@ -229,6 +229,80 @@ var _ = Describe("Aggregations", func() {
 		})
 	})
 
+	Describe("Evaluating set and unset aggregations", func() {
+		It("should add fields while keeping the rest of the object", func() {
+			jsonData := `
+'@aggregate':
+  - '@set':
+      $.metadata.annotations.note: $.c
+      $.spec.b.d:
+        '@sum': [$.spec.a, $.spec.b.c]`
+			ag := newAggregation(eng, []byte(jsonData))
+
+			res, err := ag.Evaluate(cache.Delta{Type: cache.Added, Object: objs[0]})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(HaveLen(1))
+			Expect(res[0].Type).To(Equal(cache.Added))
+			obj := res[0].Object
+			Expect(obj.GetName()).To(Equal("name"))
+			Expect(obj.GetNamespace()).To(Equal("default"))
+			Expect(obj.GetAnnotations()).To(Equal(map[string]string{"note": "c"}))
+			Expect(obj.UnstructuredContent()["spec"]).To(Equal(unstruct{
+				"a": int64(1),
+				"b": unstruct{"c": int64(2), "d": int64(3)},
+			}))
+			Expect(obj.UnstructuredContent()["c"]).To(Equal("c"))
+		})
+
+		It("should evaluate all expressions on the original document", func() {
+			jsonData := `
+'@aggregate':
+  - '@set':
+      $.spec.a: $.spec.b.c
+      $.spec.b.c: $.spec.a`
+			ag := newAggregation(eng, []byte(jsonData))
+
+			res, err := ag.Evaluate(cache.Delta{Type: cache.Added, Object: objs[0]})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(HaveLen(1))
+			Expect(res[0].Object.UnstructuredContent()["spec"]).To(Equal(unstruct{
+				"a": int64(2),
+				"b": unstruct{"c": int64(1)},
+			}))
+		})
+
+		It("should remove fields", func() {
+			jsonData := `
+'@aggregate':
+  - '@unset': [$.spec.b, $.c, $.nonexistent]`
+			ag := newAggregation(eng, []byte(jsonData))
+
+			res, err := ag.Evaluate(cache.Delta{Type: cache.Added, Object: objs[0]})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(res).To(HaveLen(1))
+			obj := res[0].Object
+			Expect(obj.GetName()).To(Equal("name"))
+			Expect(obj.UnstructuredContent()["spec"]).To(Equal(unstruct{"a": int64(1)}))
+			Expect(obj.UnstructuredContent()).NotTo(HaveKey("c"))
+		})
+
+		It("should err for an unset that drops .metadata.name", func() {
+			jsonData := `{"@aggregate":[{"@unset":"$.metadata.name"}]}`
+			ag := newAggregation(eng, []byte(jsonData))
+
+			_, err := ag.Evaluate(cache.Delta{Type: cache.Added, Object: objs[0]})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should err for a set that makes .metadata.name invalid", func() {
+			jsonData := `{"@aggregate":[{"@set":{"$.metadata.name":12}}]}`
+			ag := newAggregation(eng, []byte(jsonData))
+
+			_, err := ag.Evaluate(cache.Delta{Type: cache.Added, Object: objs[0]})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
 	Describe("Evaluating aggregations on native Unstructured objects", func() {
 		It("should evaluate a simple projection expression", func() {
 			jsonData := `{"@aggregate":[{"@project":{"metadata":"$.metadata"}}]}`
@@ -0,0 +1,201 @@
+package pipeline
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	viewv1a1 "hsnlab/dcontroller/pkg/api/view/v1alpha1"
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/object"
+	"hsnlab/dcontroller/pkg/util"
+)
+
+var _ Evaluator = &Chain{}
+var _ SnapshotEvaluator = &Chain{}
+var _ TracingEvaluator = &Chain{}
+var _ StatefulEvaluator = &Chain{}
+
+// Chain is a sequence of pipelines, each writing into a named intermediate view that can be
+// consumed by subsequent steps. The last step writes into the target view.
+type Chain struct {
+	steps []*chainStep
+	log   logr.Logger
+}
+
+type chainStep struct {
+	name   string
+	inputs map[gvk]bool
+	*Pipeline
+}
+
+// NewChain creates a chained pipeline from the set of base objects and a list of steps that
+// writes into a given target.
+func NewChain(target string, sources []Source, config []opv1a1.Step, log logr.Logger) (*Chain, error) {
+	// the inputs available to the steps by name
+	// objects of the lookup resources are fed into all steps
+	scope, base, lookups := map[string]Source{}, []Source{}, []Source{}
+	for _, s := range sources {
+		if s.Lookup {
+			lookups = append(lookups, s)
+			continue
+		}
+		scope[s.Name()] = s
+		base = append(base, s)
+	}
+
+	c := &Chain{steps: []*chainStep{}, log: log}
+	for i, stepConfig := range config {
+		last := i == len(config)-1
+		name := stepConfig.Name
+		if name == "" && !last {
+			return nil, fmt.Errorf("invalid controller configuration: step %d: "+
+				"name is mandatory for intermediate steps", i)
+		}
+		if _, ok := scope[name]; ok && name != "" {
+			return nil, fmt.Errorf("invalid controller configuration: step %d: "+
+				"name %q is already used by a source or a previous step", i, name)
+		}
+
+		var inputs []Source
+		switch {
+		case len(stepConfig.Sources) > 0:
+			inputs = make([]Source, len(stepConfig.Sources))
+			for j, n := range stepConfig.Sources {
+				s, ok := scope[n]
+				if !ok {
+					return nil, fmt.Errorf("invalid controller configuration: step %d: "+
+						"unknown source %q", i, n)
+				}
+				inputs[j] = s
+			}
+		case i == 0:
+			inputs = base
+		default:
+			inputs = []Source{scope[c.steps[i-1].name]}
+		}
+
+		view := target
+		if !last {
+			view = name
+		}
+
+		inputs = append(slices.Clone(inputs), lookups...)
+		p, err := newSinglePipeline(view, inputs, stepConfig.Join, stepConfig.Aggregation,
+			log.WithValues("step", view))
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %w", i, err)
+		}
+
+		step := &chainStep{name: view, inputs: map[gvk]bool{}, Pipeline: p}
+		for _, s := range inputs {
+			step.inputs[s.GVK] = true
+		}
+		c.steps = append(c.steps, step)
+
+		if !last {
+			g := viewv1a1.NewGVK(name)
+			for _, s := range sources {
+				if s.GVK == g {
+					return nil, fmt.Errorf("invalid controller configuration: step %d: "+
+						"intermediate view %q conflicts with source %q", i, name, s.Name())
+				}
+			}
+			scope[name] = Source{GVK: g}
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Chain) String() string {
+	ss := make([]string, len(c.steps))
+	for i, s := range c.steps {
+		ss[i] = fmt.Sprintf("%s:%s", s.name, s.Pipeline.String())
+	}
+	return fmt.Sprintf("chain:[%s]", strings.Join(ss, ","))
+}
+
+// Evaluate processes a chained pipeline on the given delta. The delta is fed into each step that
+// consumes the source of the delta, and the deltas produced by the step are fed into the
+// subsequent steps that consume the step's output. Returns the deltas output by the last step.
+func (c *Chain) Evaluate(delta cache.Delta) ([]cache.Delta, error) {
+	c.log.V(2).Info("processing event", "event-type", delta.Type, "object", ObjectKey(delta.Object))
+
+	res, err := c.propagate([]cache.Delta{delta}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c.log.V(1).Info("eval ready", "event-type", delta.Type,
+		"object", ObjectKey(delta.Object), "result", util.Stringify(res))
+
+	return res, nil
+}
+
+// EvaluateWithTrace processes a chained pipeline on the given delta and records a trace of the
+// evaluation of all steps.
+func (c *Chain) EvaluateWithTrace(delta cache.Delta) ([]cache.Delta, *Trace, error) {
+	t := NewTrace(delta)
+	for _, step := range c.steps {
+		step.engine.Trace(t)
+	}
+	defer func() {
+		for _, step := range c.steps {
+			step.engine.Trace(nil)
+		}
+	}()
+
+	res, err := c.Evaluate(delta)
+	t.Finish(res, err)
+
+	return res, t, err
+}
+
+// EvaluateSnapshot processes a complete snapshot of a base view: the snapshot is fed into each
+// step that consumes the view, and the resultant deltas are propagated to the subsequent steps.
+func (c *Chain) EvaluateSnapshot(gvk gvk, objs []object.Object) ([]cache.Delta, error) {
+	return c.propagate([]cache.Delta{}, func(step *chainStep) ([]cache.Delta, error) {
+		if !step.inputs[gvk] {
+			return []cache.Delta{}, nil
+		}
+		return step.EvaluateSnapshot(gvk, objs)
+	})
+}
+
+// propagate feeds the available deltas through the steps and returns the output of the last step.
+// The optional snapshot function is called on each step before processing the deltas.
+func (c *Chain) propagate(available []cache.Delta, snapshot func(*chainStep) ([]cache.Delta, error)) ([]cache.Delta, error) {
+	res := []cache.Delta{}
+	for _, step := range c.steps {
+		res = []cache.Delta{}
+		if snapshot != nil {
+			ds, err := snapshot(step)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, ds...)
+		}
+
+		for _, d := range available {
+			if d.Object == nil || !step.inputs[d.Object.GetObjectKind().GroupVersionKind()] {
+				continue
+			}
+
+			ds, err := step.Evaluate(d)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, ds...)
+		}
+
+		// different inputs may yield updates to the same object
+		res = collapseDeltas(res)
+		available = append(available, res...)
+	}
+
+	return res, nil
+}
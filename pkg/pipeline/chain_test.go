@@ -0,0 +1,183 @@
+package pipeline
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/yaml"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	viewv1a1 "hsnlab/dcontroller/pkg/api/view/v1alpha1"
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/object"
+)
+
+var _ = Describe("Chained pipelines", func() {
+	var dep1, pod1, rs1 object.Object
+	var sources []Source
+
+	BeforeEach(func() {
+		dep1 = object.NewViewObject("dep")
+		object.SetContent(dep1, unstruct{"spec": unstruct{"replicas": int64(3)}})
+		object.SetName(dep1, "default", "dep1")
+
+		pod1 = object.NewViewObject("pod")
+		object.SetContent(pod1, unstruct{"spec": unstruct{"parent": "dep1"}})
+		object.SetName(pod1, "default", "pod1")
+
+		rs1 = object.NewViewObject("rs")
+		object.SetContent(rs1, unstruct{"spec": unstruct{"dep": "dep1"}})
+		object.SetName(rs1, "default", "rs1")
+
+		sources = NewSources(viewv1a1.GroupVersion.WithKind("pod"),
+			viewv1a1.GroupVersion.WithKind("dep"), viewv1a1.GroupVersion.WithKind("rs"))
+	})
+
+	newChain := func(data string) (Evaluator, error) {
+		var p opv1a1.Pipeline
+		err := yaml.Unmarshal([]byte(data), &p)
+		Expect(err).NotTo(HaveOccurred())
+		return NewPipeline("view", sources, p, logger)
+	}
+
+	It("should evaluate a two-step chain incrementally", func() {
+		c, err := newChain(`
+'@steps':
+  - name: poddep
+    sources: [pod, dep]
+    '@join':
+      '@eq': [$.dep.metadata.name, $.pod.spec.parent]
+    '@aggregate':
+      - '@project':
+          metadata:
+            name: $.pod.metadata.name
+            namespace: $.pod.metadata.namespace
+          dep: $.dep.metadata.name
+          replicas: $.dep.spec.replicas
+  - sources: [poddep, rs]
+    '@join':
+      '@eq': [$.poddep.dep, $.rs.spec.dep]
+    '@aggregate':
+      - '@project':
+          metadata:
+            name:
+              '@concat': [$.poddep.metadata.name, "--", $.rs.metadata.name]
+            namespace: $.rs.metadata.namespace
+          replicas: $.poddep.replicas`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c).To(BeAssignableToTypeOf(&Chain{}))
+
+		deltas, err := c.Evaluate(cache.Delta{Type: cache.Added, Object: dep1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(BeEmpty())
+
+		deltas, err = c.Evaluate(cache.Delta{Type: cache.Added, Object: rs1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(BeEmpty())
+
+		deltas, err = c.Evaluate(cache.Delta{Type: cache.Added, Object: pod1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Type).To(Equal(cache.Added))
+		Expect(deltas[0].Object.UnstructuredContent()).To(Equal(unstruct{
+			"apiVersion": "view.dcontroller.io/v1alpha1",
+			"kind":       "view",
+			"metadata": unstruct{
+				"name":      "pod1--rs1",
+				"namespace": "default",
+			},
+			"replicas": int64(3),
+		}))
+
+		// an update to a source of the first step propagates through the intermediate view
+		dep1 = object.DeepCopy(dep1)
+		object.SetContent(dep1, unstruct{"spec": unstruct{"replicas": int64(5)}})
+		object.SetName(dep1, "default", "dep1")
+		deltas, err = c.Evaluate(cache.Delta{Type: cache.Updated, Object: dep1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Type).To(Equal(cache.Updated))
+		Expect(deltas[0].Object.GetName()).To(Equal("pod1--rs1"))
+		Expect(deltas[0].Object.UnstructuredContent()["replicas"]).To(Equal(int64(5)))
+
+		// a delete in the last step's own source
+		deltas, err = c.Evaluate(cache.Delta{Type: cache.Deleted, Object: rs1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Type).To(Equal(cache.Deleted))
+		Expect(deltas[0].Object.GetName()).To(Equal("pod1--rs1"))
+	})
+
+	It("should chain aggregations over the previous step by default", func() {
+		sources = NewSources(viewv1a1.GroupVersion.WithKind("pod"))
+		c, err := newChain(`
+'@steps':
+  - name: selected
+    '@aggregate':
+      - '@select':
+          '@eq': [$.spec.parent, dep1]
+  - '@aggregate':
+      - '@project':
+          metadata: $.metadata
+          parent: $.spec.parent`)
+		Expect(err).NotTo(HaveOccurred())
+
+		deltas, err := c.Evaluate(cache.Delta{Type: cache.Added, Object: pod1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Type).To(Equal(cache.Added))
+		Expect(deltas[0].Object.GetObjectKind().GroupVersionKind()).To(Equal(viewv1a1.NewGVK("view")))
+		Expect(deltas[0].Object.UnstructuredContent()["parent"]).To(Equal("dep1"))
+
+		pod2 := object.DeepCopy(pod1)
+		object.SetContent(pod2, unstruct{"spec": unstruct{"parent": "dep2"}})
+		object.SetName(pod2, "default", "pod2")
+		deltas, err = c.Evaluate(cache.Delta{Type: cache.Added, Object: pod2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(BeEmpty())
+	})
+
+	It("should reject invalid chains", func() {
+		_, err := newChain(`
+'@steps':
+  - '@join':
+      '@eq': [$.dep.metadata.name, $.pod.spec.parent]
+  - '@aggregate':
+      - '@project':
+          metadata: $.metadata`)
+		Expect(err).To(HaveOccurred()) // unnamed intermediate step
+
+		_, err = newChain(`
+'@steps':
+  - name: pod
+    '@join':
+      '@eq': [$.dep.metadata.name, $.pod.spec.parent]
+  - '@aggregate':
+      - '@project':
+          metadata: $.metadata`)
+		Expect(err).To(HaveOccurred()) // name clashes with a source
+
+		_, err = newChain(`
+'@steps':
+  - name: x
+    sources: [pod, svc]
+    '@join':
+      '@eq': [$.svc.metadata.name, $.pod.spec.parent]`)
+		Expect(err).To(HaveOccurred()) // unknown source
+
+		_, err = newChain(`
+'@steps':
+  - name: x
+    '@aggregate':
+      - '@project':
+          metadata: $.metadata`)
+		Expect(err).To(HaveOccurred()) // multiple sources without a join
+
+		_, err = newChain(`
+'@join':
+  '@eq': [$.dep.metadata.name, $.pod.spec.parent]
+'@steps':
+  - '@join':
+      '@eq': [$.dep.metadata.name, $.pod.spec.parent]`)
+		Expect(err).To(HaveOccurred()) // steps combined with a top-level join
+	})
+})
@@ -1,6 +1,8 @@
 package pipeline
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"slices"
@@ -21,19 +23,47 @@ var ObjectKey = toolscache.MetaObjectToName
 
 // defaultEngine is the default implementation of the pipeline engine.
 type defaultEngine struct {
-	targetView    string               // the views/objects to work on
-	baseviews     []gvk                // the view to put the output objects into
-	baseViewStore map[gvk]*cache.Store // internal view cache
+	targetView    string                           // the view to put the output objects into
+	baseviews     []Source                         // the views/objects to work on
+	lookups       []gvk                            // the resources available to @lookup stages
+	baseViewStore map[gvk]*cache.Store             // internal view cache
+	lookupStore   map[gvk]*cache.Store             // cache for the objects of the lookup resources
+	lookupDeps    map[objectRef]map[objectRef]bool // looked-up object -> dependent inputs
+	lookupRefs    map[objectRef]map[objectRef]bool // input -> looked-up objects
+	projections   map[gvk]Projection               // the fields stored for each base view
+	owner         *expression.Expression           // the owner of the output objects
+	groups        map[string]*group                // the groups of @count and @distinct stages
+	groupsBefore  map[string]*group                // the groups changed since the last flush
+	event         cache.Delta                      // the delta being evaluated, for $event and $old
+	trace         *Trace                           // trace to record the evaluation into
 	log           logr.Logger
 }
 
-func NewDefaultEngine(targetView string, baseviews []gvk, log logr.Logger) Engine {
-	return &defaultEngine{
+func NewDefaultEngine(targetView string, sources []Source, log logr.Logger) Engine {
+	eng := &defaultEngine{
 		targetView:    targetView,
-		baseviews:     baseviews,
+		baseviews:     []Source{},
+		lookups:       []gvk{},
 		baseViewStore: make(map[gvk]*cache.Store),
+		lookupStore:   make(map[gvk]*cache.Store),
+		lookupDeps:    make(map[objectRef]map[objectRef]bool),
+		lookupRefs:    make(map[objectRef]map[objectRef]bool),
+		projections:   make(map[gvk]Projection),
+		groups:        make(map[string]*group),
+		groupsBefore:  make(map[string]*group),
 		log:           log,
 	}
+
+	for _, s := range sources {
+		if s.Lookup {
+			eng.lookups = append(eng.lookups, s.GVK)
+			eng.lookupStore[s.GVK] = cache.NewStore()
+		} else {
+			eng.baseviews = append(eng.baseviews, s)
+		}
+	}
+
+	return eng
 }
 
 func (eng *defaultEngine) Log() logr.Logger { return eng.log }
@@ -42,6 +72,10 @@ func (eng *defaultEngine) View() string     { return eng.targetView }
 func (eng *defaultEngine) WithObjects(objs ...object.Object) {
 	for _, o := range objs {
 		gvk := o.GetObjectKind().GroupVersionKind()
+		if eng.IsLookup(gvk) {
+			eng.lookupStore[gvk].Add(eng.project(o)) //nolint:errcheck
+			continue
+		}
 		eng.initViewStore(gvk)
 		eng.baseViewStore[gvk].Add(o) //nolint:errcheck
 	}
@@ -49,18 +83,21 @@ func (eng *defaultEngine) WithObjects(objs ...object.Object) {
 
 func (eng *defaultEngine) IsValidEvent(delta cache.Delta) bool {
 	if delta.Object == nil {
+		eng.traceDrop("input", nil, "nil object in event")
 		return false
 	}
 
 	gvk := delta.Object.GetObjectKind().GroupVersionKind()
 	eng.initViewStore(gvk)
 
-	if delta.Type == cache.Added || delta.Type == cache.Updated ||
-		delta.Type == cache.Upserted || delta.Type == cache.Replaced {
+	if delta.Type == cache.Added || delta.Type == cache.Updated || delta.Type == cache.Upserted ||
+		delta.Type == cache.Replaced || delta.Type == cache.Sync {
 		obj, ok, err := eng.baseViewStore[gvk].GetByKey(ObjectKey(delta.Object).String())
-		if err == nil && ok {
+		if err == nil && ok && object.DeepEqual(eng.project(delta.Object), obj) {
 			// duplicate0>not-valid
-			return !object.DeepEqual(delta.Object, obj)
+			eng.traceDrop("input", delta.Object.UnstructuredContent(),
+				"duplicate event: the object is unchanged")
+			return false
 		}
 	}
 
@@ -75,6 +112,9 @@ func (eng *defaultEngine) EvaluateAggregation(a *Aggregation, delta cache.Delta)
 	gvk := delta.Object.GetObjectKind().GroupVersionKind()
 	eng.initViewStore(gvk)
 
+	// store only the fields the aggregation refers to
+	delta.Object = eng.project(delta.Object)
+
 	if !eng.IsValidEvent(delta) {
 		eng.log.V(4).Info("aggregation: ignoring duplicate event", "GVK", gvk,
 			"event-type", delta.Type)
@@ -84,11 +124,23 @@ func (eng *defaultEngine) EvaluateAggregation(a *Aggregation, delta cache.Delta)
 	// find out whether an upsert is an update/replace or an add
 	delta = eng.handleUpsertEvent(delta)
 
+	eng.setEvent(delta)
+	defer eng.setEvent(cache.Delta{})
+
 	ds, err := eng.evaluateAggregation(a, delta)
 	if err != nil {
 		return nil, err
 	}
 
+	// grouping stages emit the net change of the groups
+	if groupStageOf(a) != nil {
+		gs, err := eng.flushGroups(a)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, gs...)
+	}
+
 	eng.log.V(4).Info("aggregation: ready", "event-type", delta.Type, "result", util.Stringify(ds))
 
 	return ds, nil
@@ -103,7 +155,7 @@ func (eng *defaultEngine) evaluateAggregation(a *Aggregation, delta cache.Delta)
 	case cache.Added:
 		eng.log.V(6).Info("aggregation: add using new object", "object", delta.Object)
 
-		objs, err := eng.evalAggregation(a, object.DeepCopy(delta.Object))
+		objs, err := eng.evalAggregation(a, object.DeepCopy(delta.Object), 1)
 		if err != nil {
 			return nil, NewAggregationError(
 				fmt.Errorf("processing event %q: could not evaluate aggregation for new object %s: %w",
@@ -126,43 +178,24 @@ func (eng *defaultEngine) evaluateAggregation(a *Aggregation, delta cache.Delta)
 		eng.log.V(6).Info("aggregate: replacing event with a Delete followed by an Add",
 			"event-type", delta.Type, "object", delta.Object)
 
+		// the previous output is retracted as if the object was deleted
+		event := eng.event
+		eng.setEvent(cache.Delta{Type: cache.Deleted, Object: delta.Object})
 		delDeltas, err := eng.evaluateAggregation(a, cache.Delta{Type: cache.Deleted, Object: delta.Object})
+		eng.setEvent(event)
 		if err != nil {
 			return nil, NewAggregationError(err)
 		}
-		delDelta := cache.NilDelta
-		if len(delDeltas) == 1 {
-			delDelta = delDeltas[0]
-		}
-
 		addDeltas, err := eng.evaluateAggregation(a, cache.Delta{Type: cache.Added, Object: delta.Object})
 		if err != nil {
 			return nil, NewAggregationError(err)
 		}
-		addDelta := cache.NilDelta
-		if len(addDeltas) == 1 {
-			addDelta = addDeltas[0]
-		}
 
-		// consolidate: objects both in the deleted and added cache are updated
-		switch {
-		case delDelta.IsUnchanged() && addDelta.IsUnchanged():
-			// nothing happened: object wasn't in the view and it still isn't
-			// ds = []cache.Delta{{Type: cache.Updated, Object: nil}}
-			ds = []cache.Delta{}
-		case delDelta.IsUnchanged() && !addDelta.IsUnchanged():
-			// object added into the view
-			ds = []cache.Delta{addDelta}
-		case !delDelta.IsUnchanged() && addDelta.IsUnchanged():
-			// object removed from the view
-			ds = []cache.Delta{delDelta}
-		case ObjectKey(delDelta.Object) == ObjectKey(addDelta.Object):
-			// object updated
-			ds = []cache.Delta{{Type: cache.Updated, Object: addDelta.Object}}
-		default:
-			// aggregation affects the name and the name has changed!
-			ds = []cache.Delta{delDelta, addDelta}
-		}
+		// consolidate: objects both in the deleted and added set are updated, this also covers
+		// the case when the aggregation affects the name and the name has changed, and one-to-many
+		// stages that emit multiple objects
+		as, ms, dels := diffDeltas(delDeltas, addDeltas)
+		ds = append(append(dels, ms...), as...)
 
 	case cache.Deleted:
 		old, ok, err := eng.baseViewStore[gvk].GetByKey(ObjectKey(delta.Object).String())
@@ -172,17 +205,20 @@ func (eng *defaultEngine) evaluateAggregation(a *Aggregation, delta cache.Delta)
 		if !ok {
 			eng.log.V(4).Info("aggregation: ignoring delete event for an unknown object",
 				"event-type", delta.Type, "object", ObjectKey(delta.Object))
+			eng.traceDrop("@aggregate", delta.Object.UnstructuredContent(),
+				"delete event for an unknown object")
 			return nil, nil
 		}
 
 		eng.log.V(6).Info("aggregation: delete using existing object", "object", old)
 
-		objs, err := eng.evalAggregation(a, object.DeepCopy(old))
+		objs, err := eng.evalAggregation(a, object.DeepCopy(old), -1)
 		if err != nil {
 			return nil, NewAggregationError(
 				fmt.Errorf("processing event %q: could not evaluate aggregation for deleted object %s: %w",
 					delta.Type, ObjectKey(delta.Object), err))
 		}
+		eng.clearLookupDeps(newObjectRef(old))
 
 		if err := eng.baseViewStore[gvk].Delete(old); err != nil {
 			return nil, NewAggregationError(
@@ -205,15 +241,46 @@ func (eng *defaultEngine) evaluateAggregation(a *Aggregation, delta cache.Delta)
 	return ds, nil
 }
 
-func (eng *defaultEngine) evalAggregation(a *Aggregation, obj object.Object) ([]object.Object, error) {
+// evalAggregation evaluates the stages of an aggregation on an object. The change is 1 if the
+// object is being added and -1 if it is being removed: grouping stages use it to update the counts
+// of their groups, in which case the aggregation itself produces no output.
+func (eng *defaultEngine) evalAggregation(a *Aggregation, obj object.Object, change int64) ([]object.Object, error) {
+	input := newObjectRef(obj)
+
+	// the owner is evaluated on the input, which the stages may modify
+	owner, err := eng.ownerReference(obj.UnstructuredContent())
+	if err != nil {
+		return nil, err
+	}
+
 	args := []unstruct{obj.UnstructuredContent()}
-	for _, s := range a.Expressions {
+	for i, s := range a.Expressions {
+		if isGroupOp(s.Op) {
+			if i != len(a.Expressions)-1 {
+				return nil, NewAggregationError(fmt.Errorf("%s must be the last stage", s.Op))
+			}
+			return []object.Object{}, eng.evalGroup(&s, args, change)
+		}
+
 		sres := []unstruct{}
 		for _, u := range args {
-			ret, err := eng.evalStage(&s, u)
+			eng.traceStart(s.Op, u)
+			ret, err := eng.evalStage(&s, u, input)
 			if err != nil {
+				eng.traceEnd(nil, "", err)
 				return nil, err
 			}
+			dropped := ""
+			if len(ret) == 0 {
+				dropped = fmt.Sprintf("%s stage produced no output", s.Op)
+				switch s.Op {
+				case "@select":
+					dropped = "@select condition evaluated to false"
+				case existsInOp, notExistsInOp:
+					dropped = semiJoinDropReason(&s)
+				}
+			}
+			eng.traceEnd(ret, dropped, nil)
 			sres = append(sres, ret...)
 		}
 		args = sres
@@ -223,8 +290,15 @@ func (eng *defaultEngine) evalAggregation(a *Aggregation, obj object.Object) ([]
 	for _, u := range args {
 		obj, err := Normalize(eng, u)
 		if err != nil {
+			eng.traceStart("normalize", u)
+			eng.traceEnd(nil, "invalid aggregation result", err)
 			return nil, err
 		}
+		if owner != nil {
+			if err := setOwnerReference(obj, owner); err != nil {
+				return nil, NewAggregationError(fmt.Errorf("owner: %w", err))
+			}
+		}
 		ret = append(ret, obj)
 	}
 
@@ -233,7 +307,7 @@ func (eng *defaultEngine) evalAggregation(a *Aggregation, obj object.Object) ([]
 	return ret, nil
 }
 
-func (eng *defaultEngine) evalStage(e *expression.Expression, u unstruct) ([]unstruct, error) {
+func (eng *defaultEngine) evalStage(e *expression.Expression, u unstruct, input objectRef) ([]unstruct, error) {
 	if e.Arg == nil {
 		return nil, NewAggregationError(
 			fmt.Errorf("no expression found in aggregation stage %s", e.String()))
@@ -242,7 +316,7 @@ func (eng *defaultEngine) evalStage(e *expression.Expression, u unstruct) ([]uns
 	switch e.Op {
 	// @select is one-to-one or one-to-zero
 	case "@select":
-		res, err := e.Arg.Evaluate(expression.EvalCtx{Object: u, Log: eng.log})
+		res, err := e.Arg.Evaluate(eng.evalCtx(u))
 		if err != nil {
 			return nil, err
 		}
@@ -266,7 +340,7 @@ func (eng *defaultEngine) evalStage(e *expression.Expression, u unstruct) ([]uns
 
 	// @project is one-to-one
 	case "@project":
-		res, err := e.Arg.Evaluate(expression.EvalCtx{Object: u, Log: eng.log})
+		res, err := e.Arg.Evaluate(eng.evalCtx(u))
 		if err != nil {
 			return nil, err
 		}
@@ -280,13 +354,141 @@ func (eng *defaultEngine) evalStage(e *expression.Expression, u unstruct) ([]uns
 
 		return []unstruct{v}, nil
 
+	// @set is one-to-one: modifies the document in place
+	case "@set":
+		vs, err := eng.evalSet(e, u)
+		if err != nil {
+			return nil, err
+		}
+
+		eng.log.V(5).Info("eval ready", "aggregation", e.String(), "result", vs)
+
+		return vs, nil
+
+	// @unset is one-to-one: modifies the document in place
+	case "@unset":
+		vs, err := eng.evalUnset(e, u)
+		if err != nil {
+			return nil, err
+		}
+
+		eng.log.V(5).Info("eval ready", "aggregation", e.String(), "result", vs)
+
+		return vs, nil
+
+	// @lookup is one-to-one
+	case "@lookup":
+		vs, err := eng.evalLookup(e, u, input)
+		if err != nil {
+			return nil, err
+		}
+
+		eng.log.V(5).Info("eval ready", "aggregation", e.String(), "result", vs)
+
+		return vs, nil
+
+	// @exists-in and @not-exists-in are one-to-one or one-to-zero
+	case existsInOp, notExistsInOp:
+		vs, err := eng.evalSemiJoin(e, u, input)
+		if err != nil {
+			return nil, err
+		}
+
+		eng.log.V(5).Info("eval ready", "aggregation", e.String(), "result", vs)
+
+		return vs, nil
+
+	// custom stages can be one-to-many
 	default:
-		return nil, NewAggregationError(
-			errors.New("unknown aggregation stage"))
+		vs, err := eng.evalCustomStage(e, u)
+		if err != nil {
+			return nil, err
+		}
+
+		eng.log.V(5).Info("eval ready", "aggregation", e.String(), "result", vs)
+
+		return vs, nil
+	}
+}
+
+// evalSet evaluates the expressions of a @set stage on the current document and writes the
+// results into the document at the given JSONPath keys, keeping all other fields intact.
+func (eng *defaultEngine) evalSet(e *expression.Expression, u unstruct) ([]unstruct, error) {
+	if e.Arg.Op != "@dict" {
+		return nil, NewAggregationError(errors.New("@set: argument must be a map"))
+	}
+	m, ok := e.Arg.Literal.(map[string]expression.Expression)
+	if !ok {
+		return nil, NewAggregationError(errors.New("@set: argument must be a map literal"))
+	}
+
+	// evaluate all expressions on the original document first
+	ctx := eng.evalCtx(u)
+	keys := make([]string, 0, len(m))
+	vals := map[string]any{}
+	for k, exp := range m {
+		res, err := exp.Evaluate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+		vals[k] = res
+	}
+
+	slices.Sort(keys)
+	for _, k := range keys {
+		exp := m[k]
+		if err := exp.SetJSONPath(ctx, k, vals[k], u); err != nil {
+			return nil, NewAggregationError(fmt.Errorf("@set: could not set key %q: %w", k, err))
+		}
+	}
+
+	return []unstruct{u}, nil
+}
+
+// evalUnset removes the given JSONPath keys from the current document.
+func (eng *defaultEngine) evalUnset(e *expression.Expression, u unstruct) ([]unstruct, error) {
+	keys := []string{}
+	switch e.Arg.Op {
+	case "@string":
+		k, err := asLiteralString(*e.Arg)
+		if err != nil {
+			return nil, NewAggregationError(fmt.Errorf("@unset: %w", err))
+		}
+		keys = append(keys, k)
+	case "@list":
+		es, ok := e.Arg.Literal.([]expression.Expression)
+		if !ok {
+			return nil, NewAggregationError(errors.New("@unset: argument must be a list literal"))
+		}
+		for _, exp := range es {
+			k, err := asLiteralString(exp)
+			if err != nil {
+				return nil, NewAggregationError(fmt.Errorf("@unset: %w", err))
+			}
+			keys = append(keys, k)
+		}
+	default:
+		return nil, NewAggregationError(errors.New("@unset: argument must be a key or a list of keys"))
 	}
+
+	for _, k := range keys {
+		if err := expression.DeleteJSONPathExp(k, u); err != nil {
+			return nil, NewAggregationError(fmt.Errorf("@unset: could not remove key %q: %w", k, err))
+		}
+	}
+
+	return []unstruct{u}, nil
 }
 
 func (eng *defaultEngine) EvaluateJoin(j *Join, delta cache.Delta) ([]cache.Delta, error) {
+	// store only the fields the pipeline refers to
+	delta.Object = eng.project(delta.Object)
+
+	eng.initViewStore(delta.Object.GetObjectKind().GroupVersionKind())
+	eng.setEvent(eng.handleUpsertEvent(delta))
+	defer eng.setEvent(cache.Delta{})
+
 	ds, err := eng.evaluateJoin(j, delta)
 	if err != nil {
 		return ds, err
@@ -334,7 +536,10 @@ func (eng *defaultEngine) evaluateJoin(j *Join, delta cache.Delta) ([]cache.Delt
 		eng.log.V(2).Info("join: replacing event with a Delete followed by an Add",
 			"event-type", delta.Type, "object", delta.Object)
 
+		event := eng.event
+		eng.setEvent(cache.Delta{Type: cache.Deleted, Object: delta.Object})
 		delDeltas, err := eng.evaluateJoin(j, cache.Delta{Type: cache.Deleted, Object: delta.Object})
+		eng.setEvent(event)
 		if err != nil {
 			return nil, NewJoinError(err)
 		}
@@ -358,6 +563,8 @@ func (eng *defaultEngine) evaluateJoin(j *Join, delta cache.Delta) ([]cache.Delt
 		if !ok {
 			eng.log.V(4).Info("join: ignoring delete event for an unknown object",
 				"event-type", delta.Type, "object", ObjectKey(delta.Object))
+			eng.traceDrop("@join", delta.Object.UnstructuredContent(),
+				"delete event for an unknown object")
 			return []cache.Delta{}, nil
 		}
 
@@ -396,37 +603,50 @@ func (eng *defaultEngine) evalJoin(j *Join, obj object.Object) ([]object.Object,
 		// temporary view name: Normalize will eventually recast the object into the target view
 		newObj := object.NewViewObject("__tmp_join_view")
 		input := newObj.UnstructuredContent()
-		ids := []string{}
-		for _, v := range current {
+		ids, missing := []string{}, []string{}
+		for i, v := range current {
 			if v == nil {
+				missing = append(missing, eng.baseviews[i].Name())
 				continue
 			}
-			// this may break when working on native K8s objects in different groups
-			// that have the same kind (don't do join on native objects!)
-			kind := v.GetObjectKind().GroupVersionKind().Kind
-			input[kind] = v.UnstructuredContent()
-			ids = append(ids, fmt.Sprintf("%s:%s:%s", kind, v.GetNamespace(), v.GetName()))
+			// objects are keyed by the alias of the source or, by default, the kind
+			name := eng.baseviews[i].Name()
+			input[name] = v.UnstructuredContent()
+			ids = append(ids, fmt.Sprintf("%s:%s/%s", name, v.GetNamespace(), v.GetName()))
 		}
 
-		// set id: this is needed so that we can disambiguate objects in diffDeltas
-		slices.Sort(ids)
-		input["metadata"] = map[string]any{"name": strings.Join(ids, "--")}
-
 		// evalutate conditional expression on the input
-		res, err := j.Expression.Evaluate(expression.EvalCtx{Object: input, Log: eng.log})
+		eng.traceStart("@join", input)
+		res, err := j.Expression.Evaluate(eng.evalCtx(input))
 		if err != nil {
+			eng.traceEnd(nil, "", err)
 			return nil, false, expression.NewExpressionError(&j.Expression, err)
 		}
 
 		arg, err := expression.AsBool(res)
 		if err != nil {
+			eng.traceEnd(res, "", err)
 			return nil, false, expression.NewExpressionError(&j.Expression, err)
 		}
 
 		if !arg {
+			reason := "join condition evaluated to false"
+			if len(missing) > 0 {
+				reason = fmt.Sprintf("%s (no objects yet in %s)", reason, strings.Join(missing, ","))
+			}
+			eng.traceEnd(false, reason, nil)
 			return nil, false, nil
 		}
 
+		// set id: this is needed so that we can disambiguate objects in diffDeltas
+		meta, err := eng.joinID(j, input, ids)
+		if err != nil {
+			eng.traceEnd(nil, "", err)
+			return nil, false, err
+		}
+		input["metadata"] = meta
+		eng.traceEnd(input, "", nil)
+
 		// just to make sure
 		// newObj.SetUnstructuredContent(input)
 		object.SetContent(newObj, input)
@@ -443,9 +663,71 @@ func (eng *defaultEngine) evalJoin(j *Join, obj object.Object) ([]object.Object,
 	return res, nil
 }
 
+// joinID generates the metadata of a join result: either the user-defined ID expression is
+// evaluated on the join input, or the name is set to a hash of the sorted keys of the joined
+// objects. The latter is stable across updates and fits into the Kubernetes name length limit.
+func (eng *defaultEngine) joinID(j *Join, input unstruct, ids []string) (unstruct, error) {
+	if j.ID == nil {
+		slices.Sort(ids)
+		h := sha256.Sum256([]byte(strings.Join(ids, ",")))
+		return unstruct{"name": hex.EncodeToString(h[:])}, nil
+	}
+
+	res, err := j.ID.Evaluate(eng.evalCtx(input))
+	if err != nil {
+		return nil, expression.NewExpressionError(j.ID, err)
+	}
+
+	name, namespace, err := asObjectName(res)
+	if err != nil {
+		return nil, NewInvalidObjectError(fmt.Sprintf("invalid join ID: %s", err))
+	}
+
+	meta := unstruct{"name": name}
+	if namespace != "" {
+		meta["namespace"] = namespace
+	}
+
+	return meta, nil
+}
+
+// asObjectName converts the result of an ID or key expression into a name and a namespace. The
+// result must be either a string, used as the name, or a map with a string "name" and an optional
+// "namespace" key.
+func asObjectName(res any) (string, string, error) {
+	if name, err := expression.AsString(res); err == nil {
+		if name == "" {
+			return "", "", errors.New("empty name")
+		}
+		return name, "", nil
+	}
+
+	id, err := expression.AsObject(res)
+	if err != nil {
+		return "", "", fmt.Errorf("must evaluate to a string or a map: %w", err)
+	}
+
+	name, ok := id["name"].(string)
+	if !ok || name == "" {
+		return "", "", errors.New("must specify a non-empty string name")
+	}
+
+	namespace := ""
+	if ns, ok := id["namespace"]; ok && ns != nil {
+		namespace, ok = ns.(string)
+		if !ok {
+			return "", "", errors.New("namespace must be a string")
+		}
+	}
+
+	return name, namespace, nil
+}
+
 // product takes an object and a condition expression, generates the Cartesian product of the
 // object stored in all the baseviews, applies the expression to each combination, and if it
-// evalutates to true then it adds the combined object to the result set
+// evalutates to true then it adds the combined object to the result set. Only combinations that
+// contain the object in at least one position are generated: this makes sure self-joins (several
+// baseviews of the same GVK) produce each pair exactly once.
 type joinEvalFunc = func(object.Object, []object.Object) (object.Object, bool, error)
 
 func (eng *defaultEngine) product(obj object.Object, eval joinEvalFunc) ([]object.Object, error) {
@@ -464,6 +746,11 @@ func (eng *defaultEngine) product(obj object.Object, eval joinEvalFunc) ([]objec
 
 func (eng *defaultEngine) recurseProd(obj object.Object, current []object.Object, ret *([]object.Object), eval joinEvalFunc, depth int) error {
 	if depth == len(eng.baseviews) {
+		// skip combinations that do not contain the object
+		if !slices.Contains(current, obj) {
+			return nil
+		}
+
 		newObj, ok, err := eval(obj, current)
 		if err != nil {
 			return err
@@ -474,25 +761,28 @@ func (eng *defaultEngine) recurseProd(obj object.Object, current []object.Object
 		return nil
 	}
 
-	// skip object's view
-	gvk := obj.GetObjectKind().GroupVersionKind()
-	if gvk == eng.baseviews[depth] {
-		next := make([]object.Object, len(current))
-		copy(next, current)
-		next = append(next, obj)
-		return eng.recurseProd(obj, next, ret, eval, depth+1)
-	}
+	viewGVK := eng.baseviews[depth].GVK
+	store, ok := eng.baseViewStore[viewGVK]
 
-	store, ok := eng.baseViewStore[eng.baseviews[depth]]
-	if !ok {
+	var candidates []object.Object
+	switch {
+	case obj.GetObjectKind().GroupVersionKind() == viewGVK:
+		// object's view: the object itself may or may not be in the store
+		if ok {
+			key := ObjectKey(obj)
+			candidates = slices.DeleteFunc(store.List(), func(o object.Object) bool {
+				return ObjectKey(o) == key
+			})
+		}
+		candidates = append(candidates, obj)
+	case !ok:
 		// no element seen yet: go on with an empty object
-		next := make([]object.Object, len(current))
-		copy(next, current)
-		next = append(next, nil)
-		return eng.recurseProd(obj, next, ret, eval, depth+1)
+		candidates = []object.Object{nil}
+	default:
+		candidates = store.List()
 	}
 
-	for _, o := range store.List() {
+	for _, o := range candidates {
 		next := make([]object.Object, len(current))
 		copy(next, current)
 		next = append(next, o)
@@ -505,15 +795,44 @@ func (eng *defaultEngine) recurseProd(obj object.Object, current []object.Object
 	return nil
 }
 
+// setEvent records the delta being evaluated: expressions can access the type of the event via
+// the $event root and the previous version of the object via the $old root. If the previous
+// version is not available in an update then the version in the cache is used, which holds only
+// the projected fields (see Projection): the controller always relies on the cache. Note that
+// updates first retract the previous output by evaluating the cached version as a Deleted event.
+func (eng *defaultEngine) setEvent(delta cache.Delta) {
+	if delta.Object != nil && delta.OldObject == nil && delta.Type == cache.Updated {
+		if store, ok := eng.baseViewStore[delta.Object.GetObjectKind().GroupVersionKind()]; ok {
+			if old, exists, err := store.Get(delta.Object); err == nil && exists {
+				delta.OldObject = object.DeepCopy(old)
+			}
+		}
+	}
+	eng.event = delta
+}
+
+// evalCtx returns the context to evaluate expressions on the given document.
+func (eng *defaultEngine) evalCtx(u unstruct) expression.EvalCtx {
+	ctx := expression.EvalCtx{Object: u, Event: string(eng.event.Type), Log: eng.log}
+	if eng.event.OldObject != nil {
+		ctx.OldObject = eng.event.OldObject.UnstructuredContent()
+	}
+	if eng.trace != nil {
+		ctx.Trace = eng.traceExpression
+	}
+	return ctx
+}
+
 func (eng *defaultEngine) initViewStore(gvk gvk) {
 	if _, ok := eng.baseViewStore[gvk]; !ok {
 		eng.baseViewStore[gvk] = cache.NewStore()
 	}
 }
 
-// find out whether an upsert is an add or an update/replace
+// find out whether an upsert is an add or an update: replace and sync events (e.g., from a
+// relist) are handled the same way, since the object may or may not have been seen before
 func (eng *defaultEngine) handleUpsertEvent(delta cache.Delta) cache.Delta {
-	if delta.Type != cache.Upserted {
+	if delta.Type != cache.Upserted && delta.Type != cache.Replaced && delta.Type != cache.Sync {
 		return delta
 	}
 
@@ -522,7 +841,7 @@ func (eng *defaultEngine) handleUpsertEvent(delta cache.Delta) cache.Delta {
 		return cache.Delta{Type: cache.Added, Object: delta.Object}
 	}
 
-	return cache.Delta{Type: cache.Updated, Object: delta.Object}
+	return cache.Delta{Type: cache.Updated, Object: delta.Object, OldObject: delta.OldObject}
 }
 
 // helpers
@@ -536,8 +855,8 @@ func diffDeltas(dels, adds []cache.Delta) ([]cache.Delta, []cache.Delta, []cache
 	}
 
 	for _, delta := range adds {
-		if containsDelta(dels, delta) {
-			m = append(m, cache.Delta{Type: cache.Updated, Object: delta.Object})
+		if i := indexDelta(dels, delta); i >= 0 {
+			m = append(m, cache.Delta{Type: cache.Updated, Object: delta.Object, OldObject: dels[i].Object})
 		} else {
 			a = append(a, cache.Delta{Type: cache.Added, Object: delta.Object})
 		}
@@ -547,12 +866,17 @@ func diffDeltas(dels, adds []cache.Delta) ([]cache.Delta, []cache.Delta, []cache
 }
 
 func containsDelta(ds []cache.Delta, delta cache.Delta) bool {
-	return slices.ContainsFunc(ds, func(n cache.Delta) bool {
+	return indexDelta(ds, delta) >= 0
+}
+
+func indexDelta(ds []cache.Delta, delta cache.Delta) int {
+	return slices.IndexFunc(ds, func(n cache.Delta) bool {
 		if delta.Object == nil || n.Object == nil {
 			return false
 		}
 		return delta.Object.GetObjectKind().GroupVersionKind() ==
 			n.Object.GetObjectKind().GroupVersionKind() &&
+			delta.Object.GetNamespace() == n.Object.GetNamespace() &&
 			delta.Object.GetName() == n.Object.GetName()
 	})
 }
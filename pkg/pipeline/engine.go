@@ -8,21 +8,73 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/expression"
 	"hsnlab/dcontroller/pkg/object"
 )
 
 type gvk = schema.GroupVersionKind
 
+// Source is a base view of a pipeline: objects of the given GVK are fed into the join under the
+// Alias, or under the Kind if no alias is given. Lookup sources are not fed into the join: they
+// are only used to resolve @lookup aggregation stages.
+type Source struct {
+	GVK    gvk
+	Alias  string
+	Lookup bool
+}
+
+// NewSources creates a list of sources from a set of GVKs, using the Kind as the name of each
+// source.
+func NewSources(gvks ...gvk) []Source {
+	ret := make([]Source, len(gvks))
+	for i, g := range gvks {
+		ret[i] = Source{GVK: g}
+	}
+	return ret
+}
+
+// Name returns the name of the source in the join input.
+func (s Source) Name() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	return s.GVK.Kind
+}
+
 type Engine interface {
 	// EvaluateJoin evaluates a join expression.
 	EvaluateJoin(j *Join, delta cache.Delta) ([]cache.Delta, error)
 	// EvaluateAggregation evaluates an aggregation pipeline.
 	EvaluateAggregation(a *Aggregation, delta cache.Delta) ([]cache.Delta, error)
+	// EvaluateLookup processes a delta on an object used in @lookup stages and re-evaluates the
+	// aggregation pipeline on the objects that depend on it.
+	EvaluateLookup(a *Aggregation, delta cache.Delta) ([]cache.Delta, error)
+	// EvaluateSnapshot processes a complete snapshot of a base view through the join and the
+	// aggregation (either of which may be nil) and returns the minimal set of output deltas.
+	EvaluateSnapshot(j *Join, a *Aggregation, gvk gvk, objs []object.Object) ([]cache.Delta, error)
+	// IsLookup returns true if objects of the given GVK are used in @lookup stages.
+	IsLookup(gvk gvk) bool
 	// IsValidEvent returns false for some invalid events, like null-events or duplicate
 	// events.
 	IsValidEvent(cache.Delta) bool
+	// GetState returns a serializable copy of the internal state of the engine.
+	GetState() (*EngineState, error)
+	// SetState replaces the internal state of the engine with a previously saved state.
+	SetState(*EngineState) error
+	// SetProjection restricts the fields of the objects of a base view that are stored in the
+	// engine to the given projection. A nil projection stores the objects as is.
+	SetProjection(gvk gvk, p Projection)
+	// SetOwner sets the expression that yields the owner of the output objects, evaluated on
+	// the input of the aggregation. A nil expression disables owner references.
+	SetOwner(e *expression.Expression)
+	// Trace sets a trace to record the evaluation into, or disables tracing if nil.
+	Trace(t *Trace)
 	// View returns the target view of the engine.
 	View() string
+	// StoreSizes returns the number of entries in each internal store of the engine.
+	StoreSizes() map[string]int
+	// HasObject returns true if the object is in the internal stores of the engine.
+	HasObject(obj object.Object) bool
 	// WithObjects sets some base objects in the cache for testing.
 	WithObjects(objects ...object.Object)
 	// Log returns a logger.
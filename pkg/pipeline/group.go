@@ -0,0 +1,283 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	toolscache "k8s.io/client-go/tools/cache"
+
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/expression"
+	"hsnlab/dcontroller/pkg/object"
+)
+
+const (
+	countOp    = "@count"
+	distinctOp = "@distinct"
+)
+
+// groupStage is a parsed @count or @distinct aggregation stage:
+//
+//	'@count':
+//	  key: $.svc.metadata          # the name and the namespace of the output object
+//	  field: $.spec.pods           # optional, default is $.count
+//
+//	'@distinct':
+//	  key: $.svc.metadata
+//	  value: $.pod.spec.nodeName   # the value to collect
+//	  field: $.spec.nodes          # optional, default is $.values
+//
+// The documents are grouped by the key and a single object is emitted per group, containing the
+// number of documents in the group (@count) or the sorted list of the distinct values (@distinct).
+// Grouping stages must be the last stage of the aggregation. The groups are maintained
+// incrementally with reference counts: when a document is retracted, e.g., because a join row
+// disappears, the counts are decremented and the group is removed with its last document.
+type groupStage struct {
+	op         string
+	key, value *expression.Expression
+	field      string
+}
+
+// group is the state of a group: the number of documents in the group and, for @distinct, the
+// number of documents carrying each distinct value, keyed by the JSON encoding of the value.
+type group struct {
+	name, namespace string
+	rows            int64
+	values          map[string]int64
+}
+
+func (g *group) copy() *group {
+	if g == nil {
+		return nil
+	}
+	ret := &group{name: g.name, namespace: g.namespace, rows: g.rows, values: map[string]int64{}}
+	for k, v := range g.values {
+		ret.values[k] = v
+	}
+	return ret
+}
+
+func groupKey(namespace, name string) string {
+	return toolscache.ObjectName{Namespace: namespace, Name: name}.String()
+}
+
+func isGroupOp(op string) bool { return op == countOp || op == distinctOp }
+
+// groupStageOf returns the grouping stage of an aggregation, or nil if the aggregation does not
+// end with a @count or @distinct stage.
+func groupStageOf(a *Aggregation) *expression.Expression {
+	if a == nil || len(a.Expressions) == 0 {
+		return nil
+	}
+	if e := &a.Expressions[len(a.Expressions)-1]; isGroupOp(e.Op) {
+		return e
+	}
+	return nil
+}
+
+func parseGroup(e *expression.Expression) (*groupStage, error) {
+	if e.Arg == nil || e.Arg.Op != "@dict" {
+		return nil, NewAggregationError(fmt.Errorf("%s: argument must be a map", e.Op))
+	}
+
+	m, ok := e.Arg.Literal.(map[string]expression.Expression)
+	if !ok {
+		return nil, NewAggregationError(fmt.Errorf("%s: argument must be a map literal", e.Op))
+	}
+
+	s := &groupStage{op: e.Op, field: "$.count"}
+	if e.Op == distinctOp {
+		s.field = "$.values"
+	}
+	for k, v := range m {
+		switch k {
+		case "key":
+			s.key = &v
+		case "value":
+			s.value = &v
+		case "field":
+			str, err := asLiteralString(v)
+			if err != nil {
+				return nil, NewAggregationError(fmt.Errorf("%s: field: %w", e.Op, err))
+			}
+			s.field = str
+		default:
+			return nil, NewAggregationError(fmt.Errorf("%s: unknown field %q", e.Op, k))
+		}
+	}
+
+	switch {
+	case s.key == nil:
+		return nil, NewAggregationError(fmt.Errorf("%s: key must be specified", e.Op))
+	case s.op == distinctOp && s.value == nil:
+		return nil, NewAggregationError(fmt.Errorf("%s: value must be specified", e.Op))
+	case s.op == countOp && s.value != nil:
+		return nil, NewAggregationError(fmt.Errorf("%s: unknown field \"value\"", e.Op))
+	}
+
+	return s, nil
+}
+
+// evalGroup adds the documents to their groups (change is 1) or retracts them (change is -1). The
+// output of the affected groups is emitted by flushGroups once the delta has been processed.
+func (eng *defaultEngine) evalGroup(e *expression.Expression, docs []unstruct, change int64) error {
+	s, err := parseGroup(e)
+	if err != nil {
+		return err
+	}
+
+	for _, u := range docs {
+		eng.traceStart(s.op, u)
+
+		ctx := eng.evalCtx(u)
+		res, err := s.key.Evaluate(ctx)
+		if err != nil {
+			eng.traceEnd(nil, "", err)
+			return err
+		}
+		name, namespace, err := asObjectName(res)
+		if err != nil {
+			err = NewAggregationError(fmt.Errorf("%s: invalid key: %w", s.op, err))
+			eng.traceEnd(nil, "", err)
+			return err
+		}
+
+		value := ""
+		if s.value != nil {
+			res, err := s.value.Evaluate(ctx)
+			if err != nil {
+				eng.traceEnd(nil, "", err)
+				return err
+			}
+			if res != nil {
+				b, err := json.Marshal(res)
+				if err != nil {
+					err = NewAggregationError(fmt.Errorf("%s: invalid value: %w", s.op, err))
+					eng.traceEnd(nil, "", err)
+					return err
+				}
+				value = string(b)
+			}
+		}
+
+		key := eng.updateGroup(name, namespace, value, change)
+		eng.traceEnd(unstruct{"group": key, "change": change}, "", nil)
+	}
+
+	return nil
+}
+
+func (eng *defaultEngine) updateGroup(name, namespace, value string, change int64) string {
+	key := groupKey(namespace, name)
+
+	g := eng.groups[key]
+	if _, ok := eng.groupsBefore[key]; !ok {
+		eng.groupsBefore[key] = g.copy()
+	}
+
+	if g == nil {
+		if change < 0 {
+			eng.log.V(4).Info("group: ignoring retraction from an unknown group", "group", key)
+			return key
+		}
+		g = &group{name: name, namespace: namespace, values: map[string]int64{}}
+		eng.groups[key] = g
+	}
+
+	g.rows += change
+	if value != "" {
+		g.values[value] += change
+		if g.values[value] <= 0 {
+			delete(g.values, value)
+		}
+	}
+	if g.rows <= 0 {
+		delete(eng.groups, key)
+	}
+
+	return key
+}
+
+// flushGroups emits a delta for each group that has changed since the last flush: groups that
+// appear are added, groups that lose their last document are deleted and the rest are updated.
+func (eng *defaultEngine) flushGroups(a *Aggregation) ([]cache.Delta, error) {
+	if len(eng.groupsBefore) == 0 {
+		return []cache.Delta{}, nil
+	}
+	defer func() { eng.groupsBefore = map[string]*group{} }()
+
+	s, err := parseGroup(groupStageOf(a))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(eng.groupsBefore))
+	for k := range eng.groupsBefore {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	ret := []cache.Delta{}
+	for _, k := range keys {
+		oldObj, err := eng.renderGroup(s, eng.groupsBefore[k])
+		if err != nil {
+			return nil, err
+		}
+		newObj, err := eng.renderGroup(s, eng.groups[k])
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case oldObj == nil && newObj == nil:
+		case oldObj == nil:
+			ret = append(ret, cache.Delta{Type: cache.Added, Object: newObj})
+		case newObj == nil:
+			ret = append(ret, cache.Delta{Type: cache.Deleted, Object: oldObj})
+		case !object.DeepEqual(oldObj, newObj):
+			ret = append(ret, cache.Delta{Type: cache.Updated, Object: newObj, OldObject: oldObj})
+		}
+	}
+
+	return ret, nil
+}
+
+// renderGroup generates the output object of a group, or nil if the group is empty.
+func (eng *defaultEngine) renderGroup(s *groupStage, g *group) (object.Object, error) {
+	if g == nil {
+		return nil, nil
+	}
+
+	meta := unstruct{"name": g.name}
+	if g.namespace != "" {
+		meta["namespace"] = g.namespace
+	}
+	u := unstruct{"metadata": meta}
+
+	var v any = g.rows
+	if s.op == distinctOp {
+		keys := make([]string, 0, len(g.values))
+		for k := range g.values {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+
+		vs := []any{}
+		for _, k := range keys {
+			var value any
+			if err := utiljson.Unmarshal([]byte(k), &value); err != nil {
+				return nil, NewAggregationError(fmt.Errorf("%s: invalid value: %w", s.op, err))
+			}
+			vs = append(vs, value)
+		}
+		v = vs
+	}
+
+	if err := expression.SetJSONPathExp(s.field, v, u); err != nil {
+		return nil, NewAggregationError(fmt.Errorf("%s: could not set field %q: %w", s.op, s.field, err))
+	}
+
+	return Normalize(eng, u)
+}
@@ -0,0 +1,213 @@
+package pipeline
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	viewv1a1 "hsnlab/dcontroller/pkg/api/view/v1alpha1"
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/object"
+)
+
+var _ = Describe("Grouping stages", func() {
+	var svcGVK = viewv1a1.GroupVersion.WithKind("svc")
+	var podGVK = viewv1a1.GroupVersion.WithKind("pod")
+	var svc1, svc2 object.Object
+
+	const countPipeline = `
+'@join':
+  '@eq': [$.svc.spec.app, $.pod.metadata.labels.app]
+'@aggregate':
+  - '@count':
+      key: $.svc.metadata
+      field: $.spec.pods`
+
+	const distinctPipeline = `
+'@join':
+  '@eq': [$.svc.spec.app, $.pod.metadata.labels.app]
+'@aggregate':
+  - '@distinct':
+      key: $.svc.metadata
+      value: $.pod.spec.nodeName
+      field: $.spec.nodes`
+
+	newSvc := func(name, app string) object.Object {
+		svc := object.NewViewObject("svc")
+		object.SetName(svc, "default", name)
+		Expect(unstructured.SetNestedField(svc.Object, app, "spec", "app")).To(Succeed())
+		return svc
+	}
+
+	newPod := func(name, app, node string) object.Object {
+		pod := object.NewViewObject("pod")
+		object.SetName(pod, "default", name)
+		pod.SetLabels(map[string]string{"app": app})
+		Expect(unstructured.SetNestedField(pod.Object, node, "spec", "nodeName")).To(Succeed())
+		return pod
+	}
+
+	newGroupPipeline := func(data string, gvks ...gvk) Evaluator {
+		if len(gvks) == 0 {
+			gvks = []gvk{svcGVK, podGVK}
+		}
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(data), &config)).NotTo(HaveOccurred())
+		p, err := NewPipeline("view", NewSources(gvks...), config, logger)
+		Expect(err).NotTo(HaveOccurred())
+		return p
+	}
+
+	eval := func(p Evaluator, t cache.DeltaType, obj object.Object) []cache.Delta {
+		deltas, err := p.Evaluate(cache.Delta{Type: t, Object: obj})
+		Expect(err).NotTo(HaveOccurred())
+		return deltas
+	}
+
+	expectGroup := func(ds []cache.Delta, t cache.DeltaType, name string, value any, fields ...string) {
+		GinkgoHelper()
+		Expect(ds).To(HaveLen(1))
+		Expect(ds[0].Type).To(Equal(t))
+		Expect(ds[0].Object.GetObjectKind().GroupVersionKind()).To(Equal(viewv1a1.GroupVersion.WithKind("view")))
+		Expect(ds[0].Object.GetNamespace()).To(Equal("default"))
+		Expect(ds[0].Object.GetName()).To(Equal(name))
+		v, ok, err := unstructured.NestedFieldNoCopy(ds[0].Object.Object, fields...)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(v).To(Equal(value))
+	}
+
+	BeforeEach(func() {
+		svc1 = newSvc("svc1", "a")
+		svc2 = newSvc("svc2", "b")
+	})
+
+	It("should count the join rows per key", func() {
+		p := newGroupPipeline(countPipeline)
+
+		Expect(eval(p, cache.Added, svc1)).To(BeEmpty())
+		Expect(eval(p, cache.Added, svc2)).To(BeEmpty())
+
+		pod1 := newPod("pod1", "a", "n1")
+		expectGroup(eval(p, cache.Added, pod1), cache.Added, "svc1", int64(1), "spec", "pods")
+		expectGroup(eval(p, cache.Added, newPod("pod2", "a", "n1")), cache.Updated, "svc1", int64(2), "spec", "pods")
+		expectGroup(eval(p, cache.Added, newPod("pod3", "a", "n2")), cache.Updated, "svc1", int64(3), "spec", "pods")
+
+		// a retracted join row decrements the count
+		ds := eval(p, cache.Deleted, pod1)
+		expectGroup(ds, cache.Updated, "svc1", int64(2), "spec", "pods")
+		old, _, err := unstructured.NestedInt64(ds[0].OldObject.Object, "spec", "pods")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(old).To(Equal(int64(3)))
+
+		// a row moving between groups updates both
+		ds = eval(p, cache.Updated, newPod("pod2", "b", "n1"))
+		Expect(ds).To(HaveLen(2))
+		Expect(ds[0].Type).To(Equal(cache.Updated))
+		Expect(ds[0].Object.GetName()).To(Equal("svc1"))
+		Expect(ds[1].Type).To(Equal(cache.Added))
+		Expect(ds[1].Object.GetName()).To(Equal("svc2"))
+
+		// an update that does not affect the join leaves the count unchanged
+		Expect(eval(p, cache.Updated, newPod("pod3", "a", "n3"))).To(BeEmpty())
+
+		// the group is removed with its last row
+		expectGroup(eval(p, cache.Deleted, svc2), cache.Deleted, "svc2", int64(1), "spec", "pods")
+		expectGroup(eval(p, cache.Deleted, newPod("pod3", "a", "n3")), cache.Deleted, "svc1", int64(1), "spec", "pods")
+	})
+
+	It("should emit a single delta when several join rows change at once", func() {
+		p := newGroupPipeline(countPipeline)
+		Expect(eval(p, cache.Added, newPod("pod1", "a", "n1"))).To(BeEmpty())
+		Expect(eval(p, cache.Added, newPod("pod2", "a", "n1"))).To(BeEmpty())
+
+		expectGroup(eval(p, cache.Added, svc1), cache.Added, "svc1", int64(2), "spec", "pods")
+
+		// the service is moved to another set of pods
+		Expect(eval(p, cache.Added, newPod("pod3", "b", "n1"))).To(BeEmpty())
+		expectGroup(eval(p, cache.Updated, newSvc("svc1", "b")), cache.Updated, "svc1", int64(1), "spec", "pods")
+
+		expectGroup(eval(p, cache.Deleted, svc1), cache.Deleted, "svc1", int64(1), "spec", "pods")
+	})
+
+	It("should collect the distinct values per key", func() {
+		p := newGroupPipeline(distinctPipeline)
+		Expect(eval(p, cache.Added, svc1)).To(BeEmpty())
+
+		pod1, pod2 := newPod("pod1", "a", "n2"), newPod("pod2", "a", "n1")
+		expectGroup(eval(p, cache.Added, pod1), cache.Added, "svc1", []any{"n2"}, "spec", "nodes")
+		expectGroup(eval(p, cache.Added, pod2), cache.Updated, "svc1", []any{"n1", "n2"}, "spec", "nodes")
+
+		// a duplicate value does not change the result
+		pod3 := newPod("pod3", "a", "n2")
+		Expect(eval(p, cache.Added, pod3)).To(BeEmpty())
+		Expect(eval(p, cache.Deleted, pod1)).To(BeEmpty())
+
+		// the value disappears with the last row carrying it
+		expectGroup(eval(p, cache.Deleted, pod3), cache.Updated, "svc1", []any{"n1"}, "spec", "nodes")
+		expectGroup(eval(p, cache.Deleted, pod2), cache.Deleted, "svc1", []any{"n1"}, "spec", "nodes")
+	})
+
+	It("should use the default output field", func() {
+		p := newGroupPipeline(`
+'@aggregate':
+  - '@select':
+      '@exists': $.metadata.labels.app
+  - '@count':
+      key:
+        name: $.metadata.labels.app
+        namespace: $.metadata.namespace`, podGVK)
+
+		expectGroup(eval(p, cache.Added, newPod("pod1", "a", "n1")), cache.Added, "a", int64(1), "count")
+		expectGroup(eval(p, cache.Added, newPod("pod2", "a", "n1")), cache.Updated, "a", int64(2), "count")
+	})
+
+	It("should restore the groups from a saved state", func() {
+		p := newGroupPipeline(countPipeline)
+		eval(p, cache.Added, svc1)
+		pod1 := newPod("pod1", "a", "n1")
+		eval(p, cache.Added, pod1)
+		eval(p, cache.Added, newPod("pod2", "a", "n1"))
+
+		st, err := p.(StatefulEvaluator).GetState()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(st.Engines["view"].Groups).To(Equal([]GroupState{{Name: "svc1", Namespace: "default", Rows: 2}}))
+
+		p = newGroupPipeline(countPipeline)
+		Expect(p.(StatefulEvaluator).SetState(st)).To(Succeed())
+		expectGroup(eval(p, cache.Deleted, pod1), cache.Updated, "svc1", int64(1), "spec", "pods")
+	})
+
+	It("should find the fields referenced in the grouping stage", func() {
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(distinctPipeline), &config)).NotTo(HaveOccurred())
+		ps := analyzePipeline(NewSources(svcGVK, podGVK), config.Join, config.Aggregation, nil)
+		Expect(ps[podGVK]).To(ContainElement([]string{"spec", "nodeName"}))
+		Expect(ps[podGVK]).NotTo(ContainElement([]string{"spec"}))
+		Expect(ps[svcGVK]).To(ContainElement([]string{"metadata"}))
+	})
+
+	It("should reject a grouping stage that is not the last stage", func() {
+		p := newGroupPipeline(`
+'@aggregate':
+  - '@count':
+      key: $.metadata
+  - '@project':
+      metadata: $.metadata`, svcGVK)
+		_, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: svc1})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("must be the last stage"))
+	})
+
+	It("should reject a malformed grouping stage", func() {
+		p := newGroupPipeline(`
+'@aggregate':
+  - '@distinct':
+      key: $.metadata`, svcGVK)
+		_, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: svc1})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("value must be specified"))
+	})
+})
@@ -28,6 +28,9 @@ func NewJoin(engine Engine, config *opv1a1.Join) *Join {
 	}
 }
 func (j *Join) String() string {
+	if j.ID != nil {
+		return fmt.Sprintf("%s:{%s},@id:{%s}", joinOp, j.Expression.String(), j.ID.String())
+	}
 	return fmt.Sprintf("%s:{%s}", joinOp, j.Expression.String())
 }
 
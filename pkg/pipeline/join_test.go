@@ -1,6 +1,8 @@
 package pipeline
 
 import (
+	"strings"
+
 	"github.com/bsm/gomega/types"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -84,9 +86,9 @@ var _ = Describe("Joins", func() {
 		object.SetName(rs2, "default", "rs2")
 		rs2.SetLabels(map[string]string{"app": "app2"})
 
-		eng = NewDefaultEngine("view", []gvk{viewv1a1.GroupVersion.WithKind("pod"),
+		eng = NewDefaultEngine("view", NewSources(viewv1a1.GroupVersion.WithKind("pod"),
 			viewv1a1.GroupVersion.WithKind("dep"),
-			viewv1a1.GroupVersion.WithKind("rs")}, logger)
+			viewv1a1.GroupVersion.WithKind("rs")), logger)
 	})
 
 	Describe("Evaluating join expressions for Added events", func() {
@@ -363,6 +365,155 @@ var _ = Describe("Joins", func() {
 		// 			Expect(false).To(BeTrue())
 		// 		})
 	})
+
+	Describe("Evaluating join expressions with source aliases", func() {
+		It("should evaluate a self-join", func() {
+			eng = NewDefaultEngine("view", []Source{
+				{GVK: viewv1a1.GroupVersion.WithKind("pod"), Alias: "a"},
+				{GVK: viewv1a1.GroupVersion.WithKind("pod"), Alias: "b"},
+			}, logger)
+			jsonData := `{"@join":{"@and":[{"@eq":["$.a.metadata.labels.app","$.b.metadata.labels.app"]},{"@not":{"@eq":["$.a.metadata.name","$.b.metadata.name"]}}]}}`
+			j := newJoin(eng, []byte(jsonData))
+
+			deltas, err := j.Evaluate(cache.Delta{Type: cache.Added, Object: pod1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deltas).To(BeEmpty())
+
+			deltas, err = j.Evaluate(cache.Delta{Type: cache.Added, Object: pod2})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deltas).To(BeEmpty())
+
+			deltas, err = j.Evaluate(cache.Delta{Type: cache.Added, Object: pod3})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deltas).To(HaveLen(2))
+			Expect(deltas[0].Type).To(Equal(cache.Added))
+			Expect(deltas[1].Type).To(Equal(cache.Added))
+			Expect(deltas).To(ContainElement(And(objFieldEq(pod1.UnstructuredContent(), "a"),
+				objFieldEq(pod3.UnstructuredContent(), "b"))))
+			Expect(deltas).To(ContainElement(And(objFieldEq(pod3.UnstructuredContent(), "a"),
+				objFieldEq(pod1.UnstructuredContent(), "b"))))
+			Expect(deltas[0].Object.GetName()).NotTo(Equal(deltas[1].Object.GetName()))
+
+			// move pod3 to app2: pairs with pod1 disappear, pairs with pod2 appear
+			pod3.SetLabels(map[string]string{"app": "app2"})
+			deltas, err = j.Evaluate(cache.Delta{Type: cache.Updated, Object: pod3})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deltas).To(HaveLen(4))
+			Expect(deltas[0].Type).To(Equal(cache.Deleted))
+			Expect(deltas[1].Type).To(Equal(cache.Deleted))
+			Expect(deltas[2].Type).To(Equal(cache.Added))
+			Expect(deltas[3].Type).To(Equal(cache.Added))
+			Expect(deltas[2:]).To(ContainElement(And(objFieldEq(pod2.UnstructuredContent(), "a"),
+				objFieldEq(pod3.UnstructuredContent(), "b"))))
+			Expect(deltas[2:]).To(ContainElement(And(objFieldEq(pod3.UnstructuredContent(), "a"),
+				objFieldEq(pod2.UnstructuredContent(), "b"))))
+
+			// modify pod3 without changing the join: both pairs are updated
+			pod3.SetAnnotations(map[string]string{"x": "y"})
+			deltas, err = j.Evaluate(cache.Delta{Type: cache.Updated, Object: pod3})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deltas).To(HaveLen(2))
+			Expect(deltas[0].Type).To(Equal(cache.Updated))
+			Expect(deltas[1].Type).To(Equal(cache.Updated))
+
+			deltas, err = j.Evaluate(cache.Delta{Type: cache.Deleted, Object: pod3})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deltas).To(HaveLen(2))
+			Expect(deltas[0].Type).To(Equal(cache.Deleted))
+			Expect(deltas[1].Type).To(Equal(cache.Deleted))
+		})
+
+		It("should join objects of the same kind from different groups", func() {
+			gw1 := object.DeepCopy(dep1)
+			gw1.SetGroupVersionKind(gvk{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "Gateway"})
+			gw2 := object.DeepCopy(dep1)
+			gw2.SetGroupVersionKind(gvk{Group: "stunner.l7mp.io", Version: "v1", Kind: "Gateway"})
+
+			eng = NewDefaultEngine("view", []Source{
+				{GVK: gw1.GroupVersionKind(), Alias: "k8sgw"},
+				{GVK: gw2.GroupVersionKind(), Alias: "stunnergw"},
+			}, logger)
+			jsonData := `{"@join":{"@eq":["$.k8sgw.metadata.name","$.stunnergw.metadata.name"]}}`
+			j := newJoin(eng, []byte(jsonData))
+
+			eng.WithObjects(gw1)
+			deltas, err := j.Evaluate(cache.Delta{Type: cache.Added, Object: gw2})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deltas).To(HaveLen(1))
+			Expect(deltas[0].Type).To(Equal(cache.Added))
+			Expect(deltas[0].Object.UnstructuredContent()["k8sgw"]).To(Equal(gw1.UnstructuredContent()))
+			Expect(deltas[0].Object.UnstructuredContent()["stunnergw"]).To(Equal(gw2.UnstructuredContent()))
+		})
+	})
+
+	Describe("Evaluating join IDs", func() {
+		It("should generate bounded and stable default IDs", func() {
+			jsonData := `{"@join":{"@eq":["$.dep.metadata.name","$.pod.spec.parent"]}}`
+			j := newJoin(eng, []byte(jsonData))
+
+			pod1.SetName(strings.Repeat("a", 253))
+			eng.WithObjects(dep1, dep2)
+			deltas, err := j.Evaluate(cache.Delta{Type: cache.Added, Object: pod1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deltas).To(HaveLen(1))
+			name := deltas[0].Object.GetName()
+			Expect(len(name)).To(BeNumerically("<=", 253))
+			Expect(name).NotTo(ContainSubstring("pod"))
+
+			// the ID survives an update that does not change the join
+			pod1.UnstructuredContent()["spec"].(unstruct)["image"] = "newimage"
+			deltas, err = j.Evaluate(cache.Delta{Type: cache.Updated, Object: pod1})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deltas).To(HaveLen(1))
+			Expect(deltas[0].Type).To(Equal(cache.Updated))
+			Expect(deltas[0].Object.GetName()).To(Equal(name))
+		})
+
+		It("should evaluate a user-defined ID expression", func() {
+			jsonData := `
+'@join':
+  '@eq': [$.dep.metadata.name, $.pod.spec.parent]
+'@id':
+  name:
+    '@concat': [$.dep.metadata.name, "-", $.pod.metadata.name]
+  namespace: $.pod.metadata.namespace`
+			j := newJoin(eng, []byte(jsonData))
+
+			eng.WithObjects(dep1, dep2)
+			deltas, err := j.Evaluate(cache.Delta{Type: cache.Added, Object: pod2})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deltas).To(HaveLen(1))
+			Expect(deltas[0].Object.GetName()).To(Equal("dep1-pod2"))
+			Expect(deltas[0].Object.GetNamespace()).To(Equal("other"))
+		})
+
+		It("should match rows on the namespace as well as the name", func() {
+			newpod1 := object.DeepCopy(pod1)
+			newpod1.SetNamespace("other")
+
+			// same name in another namespace: a delete and an add instead of an update
+			a, m, d := diffDeltas(
+				[]cache.Delta{{Type: cache.Deleted, Object: pod1}},
+				[]cache.Delta{{Type: cache.Added, Object: newpod1}})
+			Expect(m).To(BeEmpty())
+			Expect(a).To(HaveLen(1))
+			Expect(a[0].Object.GetNamespace()).To(Equal("other"))
+			Expect(d).To(HaveLen(1))
+			Expect(d[0].Object.GetNamespace()).To(Equal("default"))
+		})
+
+		It("should err for an ID evaluating to an empty name", func() {
+			jsonData := `
+'@join':
+  '@eq': [$.dep.metadata.name, $.pod.spec.parent]
+'@id': $.pod.metadata.nonexistent`
+			j := newJoin(eng, []byte(jsonData))
+
+			eng.WithObjects(dep1, dep2)
+			_, err := j.Evaluate(cache.Delta{Type: cache.Added, Object: pod1})
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
 
 func objFieldEq(elem any, fields ...string) types.GomegaMatcher {
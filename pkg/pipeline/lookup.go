@@ -0,0 +1,352 @@
+package pipeline
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+
+	toolscache "k8s.io/client-go/tools/cache"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	viewv1a1 "hsnlab/dcontroller/pkg/api/view/v1alpha1"
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/expression"
+	"hsnlab/dcontroller/pkg/object"
+	"hsnlab/dcontroller/pkg/util"
+)
+
+const (
+	lookupOp = "@lookup"
+	// coreGroup is the name of the core API group in @lookup and semi-join stages.
+	coreGroup = "core"
+)
+
+// objectRef identifies an object across views.
+type objectRef struct {
+	gvk gvk
+	key string
+}
+
+func newObjectRef(obj object.Object) objectRef {
+	return objectRef{gvk: obj.GetObjectKind().GroupVersionKind(), key: ObjectKey(obj).String()}
+}
+
+// lookupStage is a parsed @lookup aggregation stage:
+//
+//	'@lookup':
+//	  apiGroup: core               # optional, default is the view group
+//	  kind: Namespace
+//	  key: $.metadata.namespace    # a name or a map with a name and a namespace
+//	  as: $.namespace              # the field to embed the looked-up object into
+type lookupStage struct {
+	group, kind string
+	key         *expression.Expression
+	as          string
+}
+
+func parseLookup(e *expression.Expression) (*lookupStage, error) {
+	if e.Arg == nil || e.Arg.Op != "@dict" {
+		return nil, NewAggregationError(errors.New("@lookup: argument must be a map"))
+	}
+
+	m, ok := e.Arg.Literal.(map[string]expression.Expression)
+	if !ok {
+		return nil, NewAggregationError(errors.New("@lookup: argument must be a map literal"))
+	}
+
+	l := &lookupStage{group: viewv1a1.GroupVersion.Group}
+	for k, v := range m {
+		switch k {
+		case "apiGroup":
+			s, err := asAPIGroup(v)
+			if err != nil {
+				return nil, NewAggregationError(fmt.Errorf("@lookup: apiGroup: %w", err))
+			}
+			l.group = s
+		case "kind":
+			s, err := asLiteralString(v)
+			if err != nil {
+				return nil, NewAggregationError(fmt.Errorf("@lookup: kind: %w", err))
+			}
+			l.kind = s
+		case "key":
+			l.key = &v
+		case "as":
+			s, err := asLiteralString(v)
+			if err != nil {
+				return nil, NewAggregationError(fmt.Errorf("@lookup: as: %w", err))
+			}
+			l.as = s
+		default:
+			return nil, NewAggregationError(fmt.Errorf("@lookup: unknown field %q", k))
+		}
+	}
+
+	switch {
+	case l.kind == "":
+		return nil, NewAggregationError(errors.New("@lookup: kind must be specified"))
+	case l.key == nil:
+		return nil, NewAggregationError(errors.New("@lookup: key must be specified"))
+	case l.as == "":
+		return nil, NewAggregationError(errors.New("@lookup: as must be specified"))
+	}
+
+	return l, nil
+}
+
+func asLiteralString(e expression.Expression) (string, error) {
+	s, ok := e.Literal.(string)
+	if e.Op != "@string" || e.Arg != nil || !ok {
+		return "", fmt.Errorf("expected a string literal, got %s", e.String())
+	}
+	return s, nil
+}
+
+// asAPIGroup returns the API group given in a string literal. The core API group can be given as
+// "core", since an empty string cannot be used in expressions.
+func asAPIGroup(e expression.Expression) (string, error) {
+	s, err := asLiteralString(e)
+	if err != nil {
+		return "", err
+	}
+	if s == coreGroup {
+		return "", nil
+	}
+	return s, nil
+}
+
+// LookupResources returns the resources referenced in the @lookup, @exists-in and @not-exists-in
+// stages of a pipeline. The objects of these resources must be fed into the pipeline as lookup
+// sources.
+func LookupResources(config opv1a1.Pipeline) ([]opv1a1.Resource, error) {
+	aggregations := []*opv1a1.Aggregation{config.Aggregation}
+	for _, s := range config.Steps {
+		aggregations = append(aggregations, s.Aggregation)
+	}
+
+	ret := []opv1a1.Resource{}
+	for _, a := range aggregations {
+		if a == nil {
+			continue
+		}
+		for i := range a.Expressions {
+			var group, kind string
+			switch a.Expressions[i].Op {
+			case lookupOp:
+				l, err := parseLookup(&a.Expressions[i])
+				if err != nil {
+					return nil, err
+				}
+				group, kind = l.group, l.kind
+			case existsInOp, notExistsInOp:
+				s, err := parseSemiJoin(&a.Expressions[i])
+				if err != nil {
+					return nil, err
+				}
+				group, kind = s.group, s.kind
+			default:
+				continue
+			}
+
+			if slices.ContainsFunc(ret, func(r opv1a1.Resource) bool {
+				return *r.Group == group && r.Kind == kind
+			}) {
+				continue
+			}
+
+			ret = append(ret, opv1a1.Resource{Group: &group, Kind: kind})
+		}
+	}
+
+	return ret, nil
+}
+
+func (eng *defaultEngine) IsLookup(gvk gvk) bool {
+	_, ok := eng.lookupStore[gvk]
+	return ok
+}
+
+// evalLookup resolves the object referenced by a @lookup stage from the lookup cache, embeds it
+// into the document and records the dependency of the input object on the looked-up object.
+func (eng *defaultEngine) evalLookup(e *expression.Expression, u unstruct, input objectRef) ([]unstruct, error) {
+	l, err := parseLookup(e)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := slices.IndexFunc(eng.lookups, func(g gvk) bool {
+		return g.Group == l.group && g.Kind == l.kind
+	})
+	if idx < 0 {
+		return nil, NewAggregationError(fmt.Errorf("@lookup: no lookup source for resource %s/%s",
+			l.group, l.kind))
+	}
+	g := eng.lookups[idx]
+
+	res, err := l.key.Evaluate(eng.evalCtx(u))
+	if err != nil {
+		return nil, err
+	}
+
+	var v any
+	if res != nil {
+		name, namespace, err := asObjectName(res)
+		if err != nil {
+			return nil, expression.NewExpressionError(l.key, fmt.Errorf("@lookup: invalid key: %w", err))
+		}
+
+		ref := objectRef{gvk: g, key: toolscache.ObjectName{Namespace: namespace, Name: name}.String()}
+		eng.addLookupDep(ref, input)
+
+		obj, ok, err := eng.lookupStore[g].GetByKey(ref.key)
+		if err != nil {
+			return nil, NewAggregationError(err)
+		}
+		if ok {
+			v = object.DeepCopy(obj).UnstructuredContent()
+		}
+	}
+
+	if err := e.SetJSONPath(eng.evalCtx(u), l.as, v, u); err != nil {
+		return nil, NewAggregationError(fmt.Errorf("@lookup: %w", err))
+	}
+
+	return []unstruct{u}, nil
+}
+
+func (eng *defaultEngine) addLookupDep(ref, input objectRef) {
+	if _, ok := eng.lookupDeps[ref]; !ok {
+		eng.lookupDeps[ref] = map[objectRef]bool{}
+	}
+	eng.lookupDeps[ref][input] = true
+
+	if _, ok := eng.lookupRefs[input]; !ok {
+		eng.lookupRefs[input] = map[objectRef]bool{}
+	}
+	eng.lookupRefs[input][ref] = true
+}
+
+func (eng *defaultEngine) clearLookupDeps(input objectRef) {
+	for ref := range eng.lookupRefs[input] {
+		delete(eng.lookupDeps[ref], input)
+		if len(eng.lookupDeps[ref]) == 0 {
+			delete(eng.lookupDeps, ref)
+		}
+	}
+	delete(eng.lookupRefs, input)
+}
+
+func (eng *defaultEngine) EvaluateLookup(a *Aggregation, delta cache.Delta) ([]cache.Delta, error) {
+	if delta.Object == nil {
+		return []cache.Delta{}, nil
+	}
+
+	gvk := delta.Object.GetObjectKind().GroupVersionKind()
+	store, ok := eng.lookupStore[gvk]
+	if !ok {
+		return nil, NewAggregationError(fmt.Errorf("@lookup: unknown lookup resource %s", gvk))
+	}
+
+	// only the fields the pipeline refers to are stored
+	obj := eng.project(delta.Object)
+	ref := newObjectRef(obj)
+	old, exists, err := store.GetByKey(ref.key)
+	if err != nil {
+		return nil, NewAggregationError(err)
+	}
+	if delta.Type != cache.Deleted && exists && object.DeepEqual(obj, old) {
+		eng.log.V(4).Info("lookup: ignoring duplicate event", "GVK", gvk, "event-type", delta.Type)
+		return []cache.Delta{}, nil
+	}
+
+	// collect the dependent inputs in a stable order
+	inputs := []object.Object{}
+	if a != nil {
+		// inputs that depend on the object and on the entire resource (semi-joins)
+		refs := []objectRef{}
+		for in := range eng.lookupDeps[ref] {
+			refs = append(refs, in)
+		}
+		for in := range eng.lookupDeps[objectRef{gvk: gvk}] {
+			if !eng.lookupDeps[ref][in] {
+				refs = append(refs, in)
+			}
+		}
+		slices.SortFunc(refs, func(a, b objectRef) int {
+			return cmp.Or(cmp.Compare(a.gvk.String(), b.gvk.String()), cmp.Compare(a.key, b.key))
+		})
+
+		for _, in := range refs {
+			obj, ok, err := eng.baseViewStore[in.gvk].GetByKey(in.key)
+			if err != nil {
+				return nil, NewAggregationError(err)
+			}
+			if ok {
+				inputs = append(inputs, obj)
+			}
+		}
+	}
+
+	// the dependent objects are themselves unchanged: expressions see the re-evaluation as a
+	// delete followed by an update with the same old and new object
+	defer eng.setEvent(cache.Delta{})
+
+	// retract the dependent objects using the old state of the lookup cache
+	dels := []cache.Delta{}
+	for _, obj := range inputs {
+		eng.setEvent(cache.Delta{Type: cache.Deleted, Object: obj})
+		ds, err := eng.evaluateAggregation(a, cache.Delta{Type: cache.Deleted, Object: obj})
+		if err != nil {
+			return nil, err
+		}
+		dels = append(dels, ds...)
+	}
+
+	switch delta.Type { //nolint:exhaustive
+	case cache.Deleted:
+		if exists {
+			err = store.Delete(old)
+		}
+	default:
+		err = store.Add(obj)
+	}
+	if err != nil {
+		return nil, NewAggregationError(fmt.Errorf("@lookup: could not update object %s in lookup cache: %w",
+			ref.key, err))
+	}
+
+	// re-add the dependent objects using the new state
+	adds := []cache.Delta{}
+	for _, obj := range inputs {
+		eng.setEvent(cache.Delta{Type: cache.Updated, Object: obj, OldObject: obj})
+		ds, err := eng.evaluateAggregation(a, cache.Delta{Type: cache.Added, Object: obj})
+		if err != nil {
+			return nil, err
+		}
+		adds = append(adds, ds...)
+	}
+
+	// objects not affected by the change in the looked-up object need no update
+	as, ms, ds := diffDeltas(dels, adds)
+	ms = slices.DeleteFunc(ms, func(m cache.Delta) bool {
+		return slices.ContainsFunc(dels, func(d cache.Delta) bool {
+			return object.DeepEqual(d.Object, m.Object)
+		})
+	})
+	ret := append(append(ds, ms...), as...)
+
+	// grouping stages emit the net change of the groups
+	if groupStageOf(a) != nil {
+		gs, err := eng.flushGroups(a)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, gs...)
+	}
+
+	eng.log.V(4).Info("lookup: ready", "event-type", delta.Type, "object", ref.key,
+		"result", util.Stringify(ret))
+
+	return ret, nil
+}
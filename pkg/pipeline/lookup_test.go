@@ -0,0 +1,206 @@
+package pipeline
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	viewv1a1 "hsnlab/dcontroller/pkg/api/view/v1alpha1"
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/object"
+)
+
+var _ = Describe("Lookups", func() {
+	var pod1, pod2, ns1 object.Object
+	var nsGVK = schema.GroupVersionKind{Group: "", Version: "v1", Kind: "Namespace"}
+	var sources []Source
+
+	const lookupPipeline = `
+'@aggregate':
+  - '@lookup':
+      apiGroup: core
+      kind: Namespace
+      key: $.metadata.namespace
+      as: $.ns
+  - '@project':
+      metadata:
+        name: $.metadata.name
+        namespace: $.metadata.namespace
+      team: $.ns.metadata.labels.team`
+
+	newNamespace := func(name, team string) object.Object {
+		ns := object.New()
+		ns.SetGroupVersionKind(nsGVK)
+		ns.SetName(name)
+		ns.SetLabels(map[string]string{"team": team})
+		return ns
+	}
+
+	newLookupPipeline := func(data string) Evaluator {
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(data), &config)).NotTo(HaveOccurred())
+		p, err := NewPipeline("view", sources, config, logger)
+		Expect(err).NotTo(HaveOccurred())
+		return p
+	}
+
+	BeforeEach(func() {
+		pod1 = object.NewViewObject("pod")
+		object.SetName(pod1, "default", "pod1")
+		pod2 = object.NewViewObject("pod")
+		object.SetName(pod2, "default", "pod2")
+		ns1 = newNamespace("default", "a")
+
+		sources = append(NewSources(viewv1a1.GroupVersion.WithKind("pod")),
+			Source{GVK: nsGVK, Lookup: true})
+	})
+
+	It("should collect the lookup resources from a pipeline", func() {
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(lookupPipeline), &config)).NotTo(HaveOccurred())
+		rs, err := LookupResources(config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rs).To(HaveLen(1))
+		Expect(*rs[0].Group).To(Equal(""))
+		Expect(rs[0].Kind).To(Equal("Namespace"))
+	})
+
+	It("should embed the looked-up object", func() {
+		p := newLookupPipeline(lookupPipeline)
+
+		deltas, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: ns1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(BeEmpty())
+
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Added, Object: pod1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Type).To(Equal(cache.Added))
+		Expect(deltas[0].Object.UnstructuredContent()["team"]).To(Equal("a"))
+	})
+
+	It("should store only the fields of the looked-up objects the pipeline refers to", func() {
+		p := newLookupPipeline(lookupPipeline)
+
+		ns := object.DeepCopy(ns1)
+		ns.SetAnnotations(map[string]string{"note": "large"})
+		Expect(unstructured.SetNestedField(ns.Object, "Active", "status", "phase")).To(Succeed())
+		_, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: ns})
+		Expect(err).NotTo(HaveOccurred())
+
+		st, err := p.(StatefulEvaluator).GetState()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(st.Engines["view"].Lookups).To(Equal([]map[string]any{{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata": map[string]any{
+				"name":   "default",
+				"labels": map[string]any{"team": "a"},
+			},
+		}}))
+
+		// the embedded object is not projected if it is passed through
+		p = newLookupPipeline(`
+'@aggregate':
+  - '@lookup':
+      apiGroup: core
+      kind: Namespace
+      key: $.metadata.namespace
+      as: $.ns`)
+		_, err = p.Evaluate(cache.Delta{Type: cache.Added, Object: ns})
+		Expect(err).NotTo(HaveOccurred())
+		st, err = p.(StatefulEvaluator).GetState()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(st.Engines["view"].Lookups).To(Equal([]map[string]any{ns.UnstructuredContent()}))
+	})
+
+	It("should re-emit the dependent objects when the looked-up object changes", func() {
+		p := newLookupPipeline(lookupPipeline)
+
+		// the namespace is not known yet
+		deltas, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: pod1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Object.UnstructuredContent()["team"]).To(BeNil())
+
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Added, Object: pod2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Added, Object: ns1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(2))
+		Expect(deltas[0].Type).To(Equal(cache.Updated))
+		Expect(deltas[0].Object.GetName()).To(Equal("pod1"))
+		Expect(deltas[0].Object.UnstructuredContent()["team"]).To(Equal("a"))
+		Expect(deltas[1].Type).To(Equal(cache.Updated))
+		Expect(deltas[1].Object.GetName()).To(Equal("pod2"))
+
+		// a duplicate is ignored
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Updated, Object: ns1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(BeEmpty())
+
+		// the deleted pod no longer depends on the namespace
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Deleted, Object: pod2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Type).To(Equal(cache.Deleted))
+
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Updated, Object: newNamespace("default", "b")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Type).To(Equal(cache.Updated))
+		Expect(deltas[0].Object.GetName()).To(Equal("pod1"))
+		Expect(deltas[0].Object.UnstructuredContent()["team"]).To(Equal("b"))
+
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Deleted, Object: ns1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Type).To(Equal(cache.Updated))
+		Expect(deltas[0].Object.UnstructuredContent()["team"]).To(BeNil())
+	})
+
+	It("should not re-emit objects that are not affected by the change", func() {
+		p := newLookupPipeline(`
+'@aggregate':
+  - '@lookup':
+      apiGroup: core
+      kind: Namespace
+      key: $.metadata.namespace
+      as: $.ns
+  - '@project':
+      metadata: $.metadata`)
+
+		_, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: ns1})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = p.Evaluate(cache.Delta{Type: cache.Added, Object: pod1})
+		Expect(err).NotTo(HaveOccurred())
+
+		deltas, err := p.Evaluate(cache.Delta{Type: cache.Updated, Object: newNamespace("default", "b")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(BeEmpty())
+	})
+
+	It("should reject a lookup resource that is also a source", func() {
+		sources = append(sources, Source{GVK: viewv1a1.GroupVersion.WithKind("pod"), Lookup: true})
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(lookupPipeline), &config)).NotTo(HaveOccurred())
+		_, err := NewPipeline("view", sources, config, logger)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject a malformed lookup", func() {
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(`
+'@aggregate':
+  - '@lookup':
+      kind: Namespace
+      as: $.ns`), &config)).NotTo(HaveOccurred())
+		_, err := LookupResources(config)
+		Expect(err).To(HaveOccurred())
+	})
+})
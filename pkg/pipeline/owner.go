@@ -0,0 +1,165 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	"hsnlab/dcontroller/pkg/expression"
+	"hsnlab/dcontroller/pkg/object"
+)
+
+var _ OwnerEvaluator = &Pipeline{}
+var _ OwnerEvaluator = &Chain{}
+
+// OwnerEvaluator is an evaluator that can set a controller owner reference on its output objects.
+type OwnerEvaluator interface {
+	Evaluator
+	// SetOwner sets the expression that yields the owner of the output objects. The expression
+	// is evaluated on the input of the aggregation, i.e., on the join row or the source object.
+	// Must be called before the first evaluation.
+	SetOwner(e *expression.Expression) error
+}
+
+// SetOwner sets the expression that yields the owner of the output objects of an evaluator.
+func SetOwner(p Evaluator, e *expression.Expression) error {
+	oe, ok := p.(OwnerEvaluator)
+	if !ok {
+		return fmt.Errorf("pipeline %s does not support owners", p.String())
+	}
+	return oe.SetOwner(e)
+}
+
+// SetOwner sets the owner expression of the pipeline.
+func (p *Pipeline) SetOwner(e *expression.Expression) error {
+	switch {
+	case p.Aggregation == nil:
+		return errors.New("invalid controller configuration: an owner requires an aggregation")
+	case groupStageOf(p.Aggregation) != nil:
+		return errors.New("invalid controller configuration: an owner cannot be used with " +
+			"grouping stages")
+	}
+
+	p.engine.SetOwner(e)
+
+	// the owner expression may refer to fields the rest of the pipeline does not
+	var join *opv1a1.Join
+	if p.Join != nil {
+		join = p.Join.Join
+	}
+	projections := analyzePipeline(p.sources, join, p.Aggregation.Aggregation, e)
+	for _, s := range p.sources {
+		if !s.Lookup {
+			p.engine.SetProjection(s.GVK, projections[s.GVK])
+		}
+	}
+
+	return nil
+}
+
+// SetOwner sets the owner expression of the last step of the chain.
+func (c *Chain) SetOwner(e *expression.Expression) error {
+	if len(c.steps) == 0 {
+		return errors.New("empty chain")
+	}
+	return c.steps[len(c.steps)-1].SetOwner(e)
+}
+
+// SetOwner sets the expression that yields the owner of the output objects.
+func (eng *defaultEngine) SetOwner(e *expression.Expression) { eng.owner = e }
+
+// ownerReference evaluates the owner expression on the input of the aggregation and returns the
+// controller owner reference to set on the output objects, or nil if there is no owner.
+func (eng *defaultEngine) ownerReference(u unstruct) (unstruct, error) {
+	if eng.owner == nil {
+		return nil, nil
+	}
+
+	eng.traceStart("owner", u)
+	res, err := eng.owner.Evaluate(eng.evalCtx(u))
+	if err != nil {
+		eng.traceEnd(nil, "", err)
+		return nil, err
+	}
+	ref, err := asOwnerReference(res)
+	if err != nil {
+		err = NewAggregationError(fmt.Errorf("owner: %w", err))
+		eng.traceEnd(nil, "", err)
+		return nil, err
+	}
+	eng.traceEnd(ref, "", nil)
+
+	return ref, nil
+}
+
+// asOwnerReference converts the result of an owner expression into an owner reference. The result
+// is either an object with an apiVersion, a kind and a metadata with a name and a uid, or an
+// explicit reference with an apiVersion, a kind, a name and an optional uid. A nil result means no
+// owner.
+func asOwnerReference(res any) (unstruct, error) {
+	if res == nil {
+		return nil, nil
+	}
+
+	m, ok := res.(unstruct)
+	if !ok {
+		return nil, fmt.Errorf("expected a map, got %T", res)
+	}
+
+	ref := unstruct{}
+	for _, k := range []string{"apiVersion", "kind"} {
+		v, ok := m[k].(string)
+		if !ok || v == "" {
+			return nil, fmt.Errorf("missing or invalid %q", k)
+		}
+		ref[k] = v
+	}
+
+	// objects keep the name and the uid in the metadata
+	id := m
+	if meta, ok := m["metadata"].(unstruct); ok {
+		id = meta
+	}
+	name, ok := id["name"].(string)
+	if !ok || name == "" {
+		return nil, errors.New("missing or invalid \"name\"")
+	}
+	ref["name"] = name
+	if uid, ok := id["uid"].(string); ok && uid != "" {
+		ref["uid"] = uid
+	}
+
+	ref["controller"] = true
+	ref["blockOwnerDeletion"] = true
+
+	return ref, nil
+}
+
+// setOwnerReference sets the owner reference as the controller of an object. The current
+// controller reference and any other reference to the same owner are replaced, the references to
+// the other owners are kept.
+func setOwnerReference(obj object.Object, ref unstruct) error {
+	refs, _, err := unstructured.NestedSlice(obj.UnstructuredContent(), "metadata", "ownerReferences")
+	if err != nil {
+		return fmt.Errorf("invalid owner references: %w", err)
+	}
+
+	ret := []any{}
+	for _, r := range refs {
+		m, ok := r.(unstruct)
+		if !ok {
+			return fmt.Errorf("invalid owner reference: expected a map, got %T", r)
+		}
+		if controller, _ := m["controller"].(bool); controller {
+			continue
+		}
+		if m["apiVersion"] == ref["apiVersion"] && m["kind"] == ref["kind"] && m["name"] == ref["name"] {
+			continue
+		}
+		ret = append(ret, m)
+	}
+
+	return unstructured.SetNestedSlice(obj.UnstructuredContent(), append(ret, ref), "metadata", "ownerReferences")
+}
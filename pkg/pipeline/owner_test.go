@@ -0,0 +1,170 @@
+package pipeline
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	viewv1a1 "hsnlab/dcontroller/pkg/api/view/v1alpha1"
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/expression"
+	"hsnlab/dcontroller/pkg/object"
+)
+
+var _ = Describe("Owner references", func() {
+	var svcGVK = viewv1a1.GroupVersion.WithKind("svc")
+	var podGVK = viewv1a1.GroupVersion.WithKind("pod")
+
+	newOwnedPipeline := func(data, owner string, gvks ...gvk) (Evaluator, error) {
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(data), &config)).NotTo(HaveOccurred())
+		var e expression.Expression
+		Expect(yaml.Unmarshal([]byte(owner), &e)).NotTo(HaveOccurred())
+		p, err := NewPipeline("view", NewSources(gvks...), config, logger)
+		Expect(err).NotTo(HaveOccurred())
+		return p, SetOwner(p, &e)
+	}
+
+	ownerRefs := func(obj object.Object) []any {
+		refs, ok, err := unstructured.NestedSlice(obj.Object, "metadata", "ownerReferences")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		return refs
+	}
+
+	It("should set a source object in the join row as the owner", func() {
+		p, err := newOwnedPipeline(`
+'@join':
+  '@eq': [$.svc.spec.app, $.pod.metadata.labels.app]
+'@aggregate':
+  - '@project':
+      metadata:
+        name: $.pod.metadata.name
+        namespace: $.pod.metadata.namespace`, `$.svc`, svcGVK, podGVK)
+		Expect(err).NotTo(HaveOccurred())
+
+		svc := object.NewViewObject("svc")
+		object.SetName(svc, "default", "svc1")
+		svc.SetUID(types.UID("uid-1"))
+		Expect(unstructured.SetNestedField(svc.Object, "a", "spec", "app")).To(Succeed())
+		pod := object.NewViewObject("pod")
+		object.SetName(pod, "default", "pod1")
+		pod.SetLabels(map[string]string{"app": "a"})
+
+		ds, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: svc})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ds).To(BeEmpty())
+		ds, err = p.Evaluate(cache.Delta{Type: cache.Added, Object: pod})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ds).To(HaveLen(1))
+		Expect(ds[0].Object.GetName()).To(Equal("pod1"))
+		Expect(ownerRefs(ds[0].Object)).To(Equal([]any{map[string]any{
+			"apiVersion":         "view.dcontroller.io/v1alpha1",
+			"kind":               "svc",
+			"name":               "svc1",
+			"uid":                "uid-1",
+			"controller":         true,
+			"blockOwnerDeletion": true,
+		}}))
+
+		// the retraction carries the owner as well
+		ds, err = p.Evaluate(cache.Delta{Type: cache.Deleted, Object: pod})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ds).To(HaveLen(1))
+		Expect(ds[0].Type).To(Equal(cache.Deleted))
+		Expect(ownerRefs(ds[0].Object)).To(HaveLen(1))
+	})
+
+	It("should set an explicit owner reference", func() {
+		p, err := newOwnedPipeline(`
+'@aggregate':
+  - '@project':
+      metadata:
+        name: $.metadata.name
+        namespace: $.metadata.namespace`, `
+apiVersion: v1
+kind: ConfigMap
+name: $.spec.config
+uid: $.metadata.uid`, svcGVK)
+		Expect(err).NotTo(HaveOccurred())
+
+		svc := object.NewViewObject("svc")
+		object.SetName(svc, "default", "svc1")
+		svc.SetUID(types.UID("uid-1"))
+		Expect(unstructured.SetNestedField(svc.Object, "config", "spec", "config")).To(Succeed())
+		Expect(unstructured.SetNestedField(svc.Object, "ignored", "spec", "other")).To(Succeed())
+
+		// the fields the owner refers to are kept in the engine
+		ds, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: svc})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ds).To(HaveLen(1))
+		Expect(ownerRefs(ds[0].Object)).To(Equal([]any{map[string]any{
+			"apiVersion":         "v1",
+			"kind":               "ConfigMap",
+			"name":               "config",
+			"uid":                "uid-1",
+			"controller":         true,
+			"blockOwnerDeletion": true,
+		}}))
+	})
+
+	It("should keep the owner references to other owners", func() {
+		p, err := newOwnedPipeline(`
+'@aggregate':
+  - '@project':
+      metadata:
+        name: $.metadata.name
+        namespace: $.metadata.namespace
+        ownerReferences: $.metadata.ownerReferences`, `
+apiVersion: v1
+kind: ConfigMap
+name: $.spec.config`, svcGVK)
+		Expect(err).NotTo(HaveOccurred())
+
+		other := map[string]any{"apiVersion": "v1", "kind": "Secret", "name": "other", "uid": "uid-2"}
+		svc := object.NewViewObject("svc")
+		object.SetName(svc, "default", "svc1")
+		Expect(unstructured.SetNestedField(svc.Object, "config", "spec", "config")).To(Succeed())
+		Expect(unstructured.SetNestedSlice(svc.Object, []any{
+			other,
+			map[string]any{"apiVersion": "v1", "kind": "Secret", "name": "controller", "uid": "uid-3",
+				"controller": true},
+		}, "metadata", "ownerReferences")).To(Succeed())
+
+		// the controller reference is replaced, the other owners are kept
+		ds, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: svc})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ds).To(HaveLen(1))
+		Expect(ownerRefs(ds[0].Object)).To(Equal([]any{other, map[string]any{
+			"apiVersion":         "v1",
+			"kind":               "ConfigMap",
+			"name":               "config",
+			"controller":         true,
+			"blockOwnerDeletion": true,
+		}}))
+	})
+
+	It("should reject invalid owners", func() {
+		_, err := newOwnedPipeline(`
+'@aggregate':
+  - '@count':
+      key: $.metadata`, `$.metadata`, svcGVK)
+		Expect(err).To(HaveOccurred())
+
+		p, err := newOwnedPipeline(`
+'@aggregate':
+  - '@project':
+      metadata:
+        name: $.metadata.name`, `
+kind: ConfigMap
+name: $.metadata.name`, svcGVK)
+		Expect(err).NotTo(HaveOccurred())
+		svc := object.NewViewObject("svc")
+		object.SetName(svc, "default", "svc1")
+		_, err = p.Evaluate(cache.Delta{Type: cache.Added, Object: svc})
+		Expect(err).To(HaveOccurred())
+	})
+})
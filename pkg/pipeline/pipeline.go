@@ -1,42 +1,100 @@
 package pipeline
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
 	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/object"
 	"hsnlab/dcontroller/pkg/util"
 )
 
 var _ Evaluator = &Pipeline{}
+var _ SnapshotEvaluator = &Pipeline{}
+var _ TracingEvaluator = &Pipeline{}
+var _ StatefulEvaluator = &Pipeline{}
 
 // Evaluator is a query that knows how to evaluate itself on a given delta and how to print itself.
+//
+// The deltas returned by Evaluate are in a deterministic order: first the deletes, then the
+// updates and finally the adds, each group sorted by the namespace and the name of the object.
+// Each object appears at most once in the result.
 type Evaluator interface {
 	Evaluate(cache.Delta) ([]cache.Delta, error)
 	fmt.Stringer
 }
 
+// SnapshotEvaluator is an evaluator that can also process a complete snapshot of a base view,
+// e.g., after a relist, and emit the deltas needed to bring the output in sync.
+type SnapshotEvaluator interface {
+	Evaluator
+	EvaluateSnapshot(gvk schema.GroupVersionKind, objs []object.Object) ([]cache.Delta, error)
+}
+
 // Pipeline is query that knows how to evaluate itself.
 type Pipeline struct {
 	*Join
 	*Aggregation
-	engine Engine
+	sources []Source
+	engine  Engine
 }
 
 // NewPipeline creates a new pipeline from the set of base objects and a seralized pipeline that writes into a given target.
-func NewPipeline(target string, sources []gvk, config opv1a1.Pipeline, log logr.Logger) (Evaluator, error) {
-	if len(sources) > 1 && config.Join == nil {
+func NewPipeline(target string, sources []Source, config opv1a1.Pipeline, log logr.Logger) (Evaluator, error) {
+	names, gvks := map[string]bool{}, map[gvk]bool{}
+	for _, s := range sources {
+		if s.Lookup {
+			continue
+		}
+		gvks[s.GVK] = true
+		if names[s.Name()] {
+			return nil, fmt.Errorf("invalid controller configuration: duplicate source name %q "+
+				"(use an alias to disambiguate sources of the same kind)", s.Name())
+		}
+		names[s.Name()] = true
+	}
+	for _, s := range sources {
+		if s.Lookup && gvks[s.GVK] {
+			return nil, fmt.Errorf("invalid controller configuration: resource %s cannot be "+
+				"used both as a source and in a @lookup stage", s.GVK)
+		}
+	}
+
+	if len(config.Steps) > 0 {
+		if config.Join != nil || config.Aggregation != nil {
+			return nil, errors.New("invalid controller configuration: a pipeline " +
+				"cannot specify both @steps and a top-level join or aggregation")
+		}
+		return NewChain(target, sources, config.Steps, log)
+	}
+
+	return newSinglePipeline(target, sources, config.Join, config.Aggregation, log)
+}
+
+func newSinglePipeline(target string, sources []Source, join *opv1a1.Join, aggregation *opv1a1.Aggregation, log logr.Logger) (*Pipeline, error) {
+	if numBaseViews(sources) > 1 && join == nil {
 		return nil, errors.New("invalid controller configuration: controllers " +
 			"defined on multiple base resources must specify a Join in the pipeline")
 	}
+	if err := checkStages(aggregation); err != nil {
+		return nil, err
+	}
 
 	engine := NewDefaultEngine(target, sources, log)
+	for g, p := range analyzePipeline(sources, join, aggregation, nil) {
+		engine.SetProjection(g, p)
+	}
+
 	return &Pipeline{
-		Join:        NewJoin(engine, config.Join),
-		Aggregation: NewAggregation(engine, config.Aggregation),
+		Join:        NewJoin(engine, join),
+		Aggregation: NewAggregation(engine, aggregation),
+		sources:     sources,
 		engine:      engine,
 	}, nil
 }
@@ -57,6 +115,15 @@ func (p *Pipeline) Evaluate(delta cache.Delta) ([]cache.Delta, error) {
 	eng := p.engine
 	eng.Log().V(2).Info("processing event", "event-type", delta.Type, "object", ObjectKey(delta.Object))
 
+	// objects used in @lookup stages bypass the join
+	if delta.Object != nil && eng.IsLookup(delta.Object.GetObjectKind().GroupVersionKind()) {
+		res, err := eng.EvaluateLookup(p.Aggregation, delta)
+		if err != nil {
+			return nil, err
+		}
+		return orderDeltas(res), nil
+	}
+
 	if !eng.IsValidEvent(delta) {
 		eng.Log().V(4).Info("aggregation: ignoring nil/duplicate event",
 			"event-type", delta.Type)
@@ -86,20 +153,45 @@ func (p *Pipeline) Evaluate(delta cache.Delta) ([]cache.Delta, error) {
 			}
 			res = append(res, ds...)
 		}
-
-		// the aggregation may collapse objects that come out as different (delete+add)
-		// from the join pipeline
-		res = collapseDeltas(res)
 	} else {
 		res = deltas
 	}
 
+	// the aggregation may collapse objects that come out as different (delete+add) from the
+	// join pipeline, this also puts the deltas into a deterministic order; the groups of
+	// grouping stages may change several times, once for each join delta
+	if groupStageOf(p.Aggregation) != nil {
+		res = ConsolidateDeltas(res)
+	} else {
+		res = collapseDeltas(res)
+	}
+
 	eng.Log().V(1).Info("eval ready", "event-type", delta.Type,
 		"object", ObjectKey(delta.Object), "result", util.Stringify(res))
 
 	return res, nil
 }
 
+// EvaluateWithTrace processes a pipeline expression on the given delta and records a trace of the
+// evaluation.
+func (p *Pipeline) EvaluateWithTrace(delta cache.Delta) ([]cache.Delta, *Trace, error) {
+	t := NewTrace(delta)
+	p.engine.Trace(t)
+	defer p.engine.Trace(nil)
+
+	res, err := p.Evaluate(delta)
+	t.Finish(res, err)
+
+	return res, t, err
+}
+
+// EvaluateSnapshot processes a complete snapshot of a base view.
+func (p *Pipeline) EvaluateSnapshot(gvk gvk, objs []object.Object) ([]cache.Delta, error) {
+	return p.engine.EvaluateSnapshot(p.Join, p.Aggregation, gvk, objs)
+}
+
+// collapseDeltas merges the deltas on the same object: a delete followed by an add or an update
+// becomes an update, otherwise the last delta wins. The result is ordered with orderDeltas.
 func collapseDeltas(ds []cache.Delta) []cache.Delta {
 	uniq := map[string]cache.Delta{}
 
@@ -107,21 +199,58 @@ func collapseDeltas(ds []cache.Delta) []cache.Delta {
 		key := ObjectKey(delta.Object).String()
 		if d, ok := uniq[key]; ok && d.Type == cache.Deleted && (delta.Type == cache.Added || delta.Type == cache.Updated) {
 			// del events come first
-			uniq[key] = cache.Delta{Type: cache.Updated, Object: delta.Object}
+			uniq[key] = cache.Delta{Type: cache.Updated, Object: delta.Object, OldObject: d.Object}
 		} else {
 			uniq[key] = delta
 		}
 	}
 
-	// first the deletes, then the updates and finally the adds
-	ret := []cache.Delta{}
-	for _, t := range []cache.DeltaType{cache.Deleted, cache.Updated, cache.Added, cache.Replaced, cache.Sync} {
-		for _, v := range uniq {
-			if v.Type == t {
-				ret = append(ret, v)
-			}
+	ret := make([]cache.Delta, 0, len(uniq))
+	for _, v := range uniq {
+		ret = append(ret, v)
+	}
+
+	return orderDeltas(ret)
+}
+
+// orderDeltas sorts deltas into the canonical output order of the pipeline: first the deletes,
+// then the updates, then the adds and finally any other delta type, each group sorted by the
+// namespace and the name of the object.
+func orderDeltas(ds []cache.Delta) []cache.Delta {
+	rank := func(t cache.DeltaType) int {
+		switch t { //nolint:exhaustive
+		case cache.Deleted:
+			return 0
+		case cache.Updated:
+			return 1
+		case cache.Added:
+			return 2
+		default:
+			return 3
 		}
 	}
 
-	return ret
+	slices.SortStableFunc(ds, func(a, b cache.Delta) int {
+		return cmp.Or(cmp.Compare(rank(a.Type), rank(b.Type)),
+			cmp.Compare(deltaKey(a), deltaKey(b)))
+	})
+
+	return ds
+}
+
+func deltaKey(d cache.Delta) string {
+	if d.Object == nil {
+		return ""
+	}
+	return ObjectKey(d.Object).String()
+}
+
+func numBaseViews(sources []Source) int {
+	n := 0
+	for _, s := range sources {
+		if !s.Lookup {
+			n++
+		}
+	}
+	return n
 }
@@ -1,6 +1,7 @@
 package pipeline
 
 import (
+	"slices"
 	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -19,7 +20,7 @@ import (
 )
 
 var (
-	emptyView = []gvk{}
+	emptyView = []Source{}
 	loglevel  = -10
 	logger    = zap.New(zap.UseFlagOptions(&zap.Options{
 		Development:     true,
@@ -113,9 +114,9 @@ var _ = Describe("Pipelines", func() {
 			object.SetName(rs2, "default", "rs2")
 			rs2.SetLabels(map[string]string{"app": "app2"})
 
-			eng = NewDefaultEngine("view", []gvk{viewv1a1.GroupVersion.WithKind("pod"),
+			eng = NewDefaultEngine("view", NewSources(viewv1a1.GroupVersion.WithKind("pod"),
 				viewv1a1.GroupVersion.WithKind("dep"),
-				viewv1a1.GroupVersion.WithKind("rs")}, logger)
+				viewv1a1.GroupVersion.WithKind("rs")), logger)
 		})
 
 		Describe("Evaluating pipeline expressions for Added events", func() {
@@ -582,9 +583,9 @@ var _ = Describe("Pipelines", func() {
 			object.SetName(route, "default", "route")
 			object.SetContent(route, testUDPRoute)
 			route = object.DeepCopy(route)
-			eng = NewDefaultEngine("view", []gvk{
+			eng = NewDefaultEngine("view", NewSources(
 				viewv1a1.GroupVersion.WithKind("gateway"),
-				viewv1a1.GroupVersion.WithKind("route")}, logger)
+				viewv1a1.GroupVersion.WithKind("route")), logger)
 		})
 
 		It("should implement the route attachment API with the All policy", func() {
@@ -702,8 +703,8 @@ var _ = Describe("Pipelines", func() {
 			svc1 = testutils.TestSvc.DeepCopy()
 			es1 = testutils.TestEndpointSlice.DeepCopy()
 
-			eng = NewDefaultEngine("view", []gvk{svc1.GroupVersionKind(),
-				es1.GroupVersionKind()}, logger)
+			eng = NewDefaultEngine("view", NewSources(svc1.GroupVersionKind(),
+				es1.GroupVersionKind()), logger)
 		})
 
 		It("evaluate the pipeline over a complex join expression", func() {
@@ -777,3 +778,201 @@ func newPipeline(eng Engine, data []byte) *Pipeline {
 		engine:      eng,
 	}
 }
+
+var _ = Describe("Delta ordering", func() {
+	var podGVK, depGVK = viewv1a1.GroupVersion.WithKind("pod"), viewv1a1.GroupVersion.WithKind("dep")
+
+	newPod := func(namespace, name, parent string) object.Object {
+		pod := object.NewViewObject("pod")
+		object.SetContent(pod, unstruct{"spec": unstruct{"parent": parent}})
+		object.SetName(pod, namespace, name)
+		return pod
+	}
+
+	summary := func(ds []cache.Delta) []string {
+		ret := []string{}
+		for _, d := range ds {
+			ret = append(ret, string(d.Type)+":"+d.Object.GetNamespace()+"/"+d.Object.GetName())
+		}
+		return ret
+	}
+
+	It("should order collapsed deltas by type and object key", func() {
+		ds := collapseDeltas([]cache.Delta{
+			{Type: cache.Added, Object: newPod("b", "pod1", "")},
+			{Type: cache.Added, Object: newPod("a", "pod2", "")},
+			{Type: cache.Deleted, Object: newPod("a", "pod3", "")},
+			{Type: cache.Upserted, Object: newPod("a", "pod0", "")},
+			{Type: cache.Deleted, Object: newPod("a", "pod1", "")},
+			{Type: cache.Added, Object: newPod("a", "pod1", "")},
+			{Type: cache.Deleted, Object: newPod("a", "pod0x", "")},
+			{Type: cache.Added, Object: newPod("a", "pod10", "")},
+		})
+		Expect(summary(ds)).To(Equal([]string{
+			"Deleted:a/pod0x", "Deleted:a/pod3",
+			"Updated:a/pod1",
+			"Added:a/pod10", "Added:a/pod2", "Added:b/pod1",
+			"Upserted:a/pod0",
+		}))
+	})
+
+	It("should emit the deltas of a join in object key order", func() {
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(`
+'@join':
+  '@eq': [$.dep.metadata.name, $.pod.spec.parent]
+'@aggregate':
+  - '@project':
+      metadata:
+        name: $.pod.metadata.name
+        namespace: $.pod.metadata.namespace`), &config)).NotTo(HaveOccurred())
+		p, err := NewPipeline("view", NewSources(podGVK, depGVK), config, logger)
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, name := range []string{"pod5", "pod3", "pod1", "pod4", "pod2"} {
+			_, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: newPod("default", name, "dep1")})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		dep := object.NewViewObject("dep")
+		object.SetName(dep, "default", "dep1")
+		deltas, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: dep})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary(deltas)).To(Equal([]string{
+			"Added:default/pod1", "Added:default/pod2", "Added:default/pod3",
+			"Added:default/pod4", "Added:default/pod5",
+		}))
+
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Deleted, Object: dep})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary(deltas)).To(Equal([]string{
+			"Deleted:default/pod1", "Deleted:default/pod2", "Deleted:default/pod3",
+			"Deleted:default/pod4", "Deleted:default/pod5",
+		}))
+	})
+
+	It("should emit the deltas of a join without an aggregation in object key order", func() {
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(`
+'@join':
+  '@eq': [$.dep.metadata.name, $.pod.spec.parent]`), &config)).NotTo(HaveOccurred())
+		p, err := NewPipeline("view", NewSources(podGVK, depGVK), config, logger)
+		Expect(err).NotTo(HaveOccurred())
+
+		dep := object.NewViewObject("dep")
+		object.SetName(dep, "default", "dep1")
+		_, err = p.Evaluate(cache.Delta{Type: cache.Added, Object: dep})
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, name := range []string{"pod3", "pod1", "pod2"} {
+			_, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: newPod("default", name, "dep1")})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		// the joined objects have generated names, so the order is given by the names
+		deltas, err := p.Evaluate(cache.Delta{Type: cache.Deleted, Object: dep})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(3))
+		names := []string{}
+		for _, d := range deltas {
+			Expect(d.Type).To(Equal(cache.Deleted))
+			names = append(names, d.Object.GetName())
+		}
+		Expect(slices.IsSorted(names)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Event context", func() {
+	var podGVK = viewv1a1.GroupVersion.WithKind("pod")
+
+	newPod := func(replicas int64, image string) object.Object {
+		pod := object.NewViewObject("pod")
+		object.SetContent(pod, unstruct{"spec": unstruct{"replicas": replicas, "image": image}})
+		object.SetName(pod, "default", "pod1")
+		return pod
+	}
+
+	newEventPipeline := func(data string) Evaluator {
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(data), &config)).NotTo(HaveOccurred())
+		p, err := NewPipeline("view", NewSources(podGVK), config, logger)
+		Expect(err).NotTo(HaveOccurred())
+		return p
+	}
+
+	It("should expose the event type and the old object to the aggregation", func() {
+		p := newEventPipeline(`
+'@aggregate':
+  - '@project':
+      metadata:
+        name: $.metadata.name
+        namespace: $.metadata.namespace
+      event: $event
+      replicas: $.spec.replicas
+      oldReplicas: $old.spec.replicas`)
+
+		deltas, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: newPod(1, "a")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Object.UnstructuredContent()["event"]).To(Equal("Added"))
+		Expect(deltas[0].Object.UnstructuredContent()["oldReplicas"]).To(BeNil())
+
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Updated, Object: newPod(2, "a"), OldObject: newPod(1, "a")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Type).To(Equal(cache.Updated))
+		Expect(deltas[0].Object.UnstructuredContent()["event"]).To(Equal("Updated"))
+		Expect(deltas[0].Object.UnstructuredContent()["replicas"]).To(Equal(int64(2)))
+		Expect(deltas[0].Object.UnstructuredContent()["oldReplicas"]).To(Equal(int64(1)))
+
+		// the old version of the output is also available
+		Expect(deltas[0].OldObject).NotTo(BeNil())
+		Expect(deltas[0].OldObject.UnstructuredContent()["replicas"]).To(Equal(int64(1)))
+	})
+
+	It("should fall back to the cached version when the old object is missing", func() {
+		p := newEventPipeline(`
+'@aggregate':
+  - '@project':
+      metadata: $.metadata
+      oldReplicas: $old.spec.replicas`)
+
+		_, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: newPod(1, "a")})
+		Expect(err).NotTo(HaveOccurred())
+
+		deltas, err := p.Evaluate(cache.Delta{Type: cache.Upserted, Object: newPod(2, "a")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Type).To(Equal(cache.Updated))
+		Expect(deltas[0].Object.UnstructuredContent()["oldReplicas"]).To(Equal(int64(1)))
+	})
+
+	It("should implement transition logic", func() {
+		p := newEventPipeline(`
+'@aggregate':
+  - '@select':
+      '@or':
+        - '@not':
+            '@eq': [$event, Updated]
+        - '@not':
+            '@eq': [$.spec.replicas, $old.spec.replicas]
+  - '@project':
+      metadata: $.metadata
+      replicas: $.spec.replicas`)
+
+		deltas, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: newPod(1, "a")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+
+		// the image is not projected, the update is a duplicate
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Updated, Object: newPod(1, "b"), OldObject: newPod(1, "a")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(BeEmpty())
+
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Updated, Object: newPod(3, "b"), OldObject: newPod(1, "b")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Type).To(Equal(cache.Updated))
+		Expect(deltas[0].Object.UnstructuredContent()["replicas"]).To(Equal(int64(3)))
+	})
+})
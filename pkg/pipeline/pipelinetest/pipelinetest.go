@@ -0,0 +1,351 @@
+// Package pipelinetest implements a runner for declarative pipeline tests.
+//
+// A test case is a YAML document that specifies a controller, a sequence of input deltas and the
+// deltas the pipeline of the controller is expected to emit for each input:
+//
+//	name: select the pods of dep1
+//	controller:
+//	  name: test
+//	  sources:
+//	    - kind: Pod
+//	      apiGroup: ""
+//	      version: v1
+//	  pipeline:
+//	    '@aggregate':
+//	      - '@select':
+//	          '@eq': [$.spec.parent, dep1]
+//	  target:
+//	    kind: view
+//	steps:
+//	  - input:
+//	      type: Added
+//	      object:
+//	        apiVersion: v1
+//	        kind: Pod
+//	        metadata: {name: pod1, namespace: default}
+//	        spec: {parent: dep1}
+//	    output:
+//	      - type: Added
+//	        object:
+//	          metadata: {name: pod1, namespace: default}
+//	          spec: {parent: dep1}
+//
+// The apiVersion of input objects defaults to the view group and the apiVersion and the kind of
+// the expected objects default to the target view. The version of a native source that does not
+// specify a version is taken from the input objects. A step with no output expects the pipeline to
+// emit nothing. A YAML file may contain multiple test cases separated by "---".
+//
+// Test cases can be run from a Go test:
+//
+//	func TestPipelines(t *testing.T) {
+//		pipelinetest.RunFiles(t, "testdata/*.yaml")
+//	}
+package pipelinetest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/json"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	viewv1a1 "hsnlab/dcontroller/pkg/api/view/v1alpha1"
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/object"
+	"hsnlab/dcontroller/pkg/pipeline"
+)
+
+// TestCase is a declarative pipeline test.
+type TestCase struct {
+	// Name is the name of the test case.
+	Name string `json:"name"`
+	// Controller is the controller whose pipeline is tested. Only the sources, the pipeline, the
+	// target kind and the target owner are used.
+	Controller opv1a1.Controller `json:"controller"`
+	// Steps is the sequence of the input deltas and the expected outputs.
+	Steps []Step `json:"steps"`
+}
+
+// Step is a single input delta and the deltas the pipeline is expected to emit for it.
+type Step struct {
+	// Input is the delta fed into the pipeline.
+	Input Delta `json:"input"`
+	// Output is the expected result, in the order the pipeline emits the deltas.
+	Output []Delta `json:"output,omitempty"`
+}
+
+// Delta is a delta in a test case.
+type Delta struct {
+	// Type is the type of the delta, e.g., Added, Updated or Deleted.
+	Type cache.DeltaType `json:"type"`
+	// Object is the content of the object.
+	Object map[string]any `json:"object"`
+	// OldObject is the previous version of the object for Updated input deltas. Optional.
+	OldObject map[string]any `json:"oldObject,omitempty"`
+}
+
+// UnmarshalJSON decodes a delta so that integers are represented as int64, like in unstructured
+// objects.
+func (d *Delta) UnmarshalJSON(b []byte) error {
+	type delta Delta
+	var ret delta
+	if err := json.Unmarshal(b, &ret); err != nil {
+		return err
+	}
+	*d = Delta(ret)
+	return nil
+}
+
+// Load reads the test cases from a YAML file.
+func Load(path string) ([]TestCase, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ret := []TestCase{}
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(f))
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %w", path, err)
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+
+		var tc TestCase
+		if err := yaml.Unmarshal(doc, &tc); err != nil {
+			return nil, fmt.Errorf("cannot parse test case in %s: %w", path, err)
+		}
+		if tc.Name == "" {
+			tc.Name = fmt.Sprintf("%s#%d", filepath.Base(path), len(ret))
+		}
+		ret = append(ret, tc)
+	}
+
+	return ret, nil
+}
+
+// RunFiles loads the test cases from the files matching the glob pattern and runs each test case
+// as a subtest.
+func RunFiles(t *testing.T, pattern string) {
+	t.Helper()
+
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatalf("invalid pattern %q: %s", pattern, err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no test files match %q", pattern)
+	}
+
+	for _, file := range files {
+		tcs, err := Load(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tc := range tcs {
+			t.Run(tc.Name, func(t *testing.T) {
+				if err := tc.Run(logr.Discard()); err != nil {
+					t.Errorf("%s: %s", file, err)
+				}
+			})
+		}
+	}
+}
+
+// Run runs the test case and returns an error that describes the first mismatch, if any.
+func (tc *TestCase) Run(log logr.Logger) error {
+	p, err := tc.newPipeline(log)
+	if err != nil {
+		return err
+	}
+
+	for i, step := range tc.Steps {
+		in, err := newDelta(step.Input, viewv1a1.GroupVersion.String(), "")
+		if err != nil {
+			return fmt.Errorf("step %d: invalid input: %w", i, err)
+		}
+
+		res, err := p.Evaluate(in)
+		if err != nil {
+			return fmt.Errorf("step %d: evaluating %s: %w", i, in.String(), err)
+		}
+
+		want := []Delta{}
+		for _, d := range step.Output {
+			w, err := newDelta(d, viewv1a1.GroupVersion.String(), tc.Controller.Target.Kind)
+			if err != nil {
+				return fmt.Errorf("step %d: invalid output: %w", i, err)
+			}
+			want = append(want, Delta{Type: w.Type, Object: w.Object.UnstructuredContent()})
+		}
+
+		got := []Delta{}
+		for _, d := range res {
+			g := Delta{Type: d.Type}
+			if d.Object != nil {
+				if g.Object, err = normalize(d.Object.UnstructuredContent()); err != nil {
+					return fmt.Errorf("step %d: invalid result: %w", i, err)
+				}
+			}
+			got = append(got, g)
+		}
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			return fmt.Errorf("step %d: unexpected output for %s (-want +got):\n%s", i, in.String(), diff)
+		}
+	}
+
+	return nil
+}
+
+func (tc *TestCase) newPipeline(log logr.Logger) (pipeline.Evaluator, error) {
+	c := tc.Controller
+	if c.Target.Kind == "" {
+		return nil, errors.New("invalid controller: no target kind")
+	}
+
+	sources := []pipeline.Source{}
+	for _, s := range c.Sources {
+		gvk, err := tc.resolve(s.Resource)
+		if err != nil {
+			return nil, err
+		}
+		alias := ""
+		if s.Alias != nil {
+			alias = *s.Alias
+		}
+		sources = append(sources, pipeline.Source{GVK: gvk, Alias: alias})
+	}
+
+	lookups, err := pipeline.LookupResources(c.Pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline: %w", err)
+	}
+	for _, r := range lookups {
+		gvk, err := tc.resolve(r)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, pipeline.Source{GVK: gvk, Lookup: true})
+	}
+
+	p, err := pipeline.NewPipeline(c.Target.Kind, sources, c.Pipeline, log)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline: %w", err)
+	}
+
+	if c.Target.Owner != nil {
+		if err := pipeline.SetOwner(p, c.Target.Owner); err != nil {
+			return nil, fmt.Errorf("invalid owner: %w", err)
+		}
+	}
+
+	return p, nil
+}
+
+// resolve finds the GVK of a resource. Views have a fixed version, for native resources the
+// version is either given explicitly or it is taken from the input objects.
+func (tc *TestCase) resolve(r opv1a1.Resource) (schema.GroupVersionKind, error) {
+	if r.Kind == "" {
+		return schema.GroupVersionKind{}, errors.New("invalid resource: empty kind")
+	}
+
+	if r.Group == nil || *r.Group == viewv1a1.GroupVersion.Group {
+		return viewv1a1.GroupVersion.WithKind(r.Kind), nil
+	}
+
+	if r.Version != nil {
+		return schema.GroupVersionKind{Group: *r.Group, Version: *r.Version, Kind: r.Kind}, nil
+	}
+
+	for _, step := range tc.Steps {
+		u := unstructured.Unstructured{Object: step.Input.Object}
+		gvk := u.GroupVersionKind()
+		if gvk.Group == *r.Group && gvk.Kind == r.Kind {
+			return gvk, nil
+		}
+	}
+
+	return schema.GroupVersionKind{}, fmt.Errorf("cannot find the version of resource %s/%s: "+
+		"set the version explicitly", *r.Group, r.Kind)
+}
+
+// newDelta converts a test delta into a cache delta, setting the default apiVersion and kind.
+func newDelta(d Delta, apiVersion, kind string) (cache.Delta, error) {
+	if d.Type == "" {
+		return cache.Delta{}, errors.New("empty delta type")
+	}
+	if d.Object == nil {
+		return cache.Delta{}, errors.New("no object")
+	}
+
+	obj, err := newObject(d.Object, apiVersion, kind)
+	if err != nil {
+		return cache.Delta{}, err
+	}
+	ret := cache.Delta{Type: d.Type, Object: obj}
+
+	if d.OldObject != nil {
+		if ret.OldObject, err = newObject(d.OldObject, apiVersion, kind); err != nil {
+			return cache.Delta{}, err
+		}
+	}
+
+	return ret, nil
+}
+
+func newObject(content map[string]any, apiVersion, kind string) (object.Object, error) {
+	content, err := normalize(content)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := &unstructured.Unstructured{Object: content}
+	if obj.GetAPIVersion() == "" {
+		obj.SetAPIVersion(apiVersion)
+	}
+	if obj.GetKind() == "" {
+		obj.SetKind(kind)
+	}
+	if obj.GetKind() == "" {
+		return nil, errors.New("object kind must be specified")
+	}
+	if obj.GetName() == "" {
+		return nil, errors.New("object name must be specified")
+	}
+
+	return obj, nil
+}
+
+// normalize deep-copies an object through JSON so that both the expected and the actual objects
+// use the same types.
+func normalize(content map[string]any) (map[string]any, error) {
+	b, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]any{}
+	if err := json.Unmarshal(b, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,118 @@
+package pipelinetest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestPipelineTest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Pipeline test runner")
+}
+
+func TestGoldenFiles(t *testing.T) {
+	RunFiles(t, "testdata/*.yaml")
+}
+
+var _ = Describe("Pipeline test runner", func() {
+	load := func(data string) []TestCase {
+		path := filepath.Join(GinkgoT().TempDir(), "test.yaml")
+		Expect(os.WriteFile(path, []byte(data), 0o600)).To(Succeed())
+		tcs, err := Load(path)
+		Expect(err).NotTo(HaveOccurred())
+		return tcs
+	}
+
+	const header = `
+controller:
+  name: test
+  sources:
+    - kind: pod
+  pipeline:
+    '@aggregate':
+      - '@project':
+          metadata: $.metadata
+          spec:
+            replicas: $.spec.replicas
+  target:
+    kind: view
+`
+
+	It("should load multiple test cases", func() {
+		tcs, err := Load("testdata/select.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tcs).To(HaveLen(2))
+		Expect(tcs[0].Name).To(Equal("select the pods of dep1"))
+		Expect(tcs[0].Steps).To(HaveLen(4))
+		Expect(tcs[0].Steps[1].Output).To(BeEmpty())
+	})
+
+	It("should report a readable diff on mismatch", func() {
+		tcs := load("name: mismatch" + header + `
+steps:
+  - input:
+      type: Added
+      object:
+        kind: pod
+        metadata: {name: pod1, namespace: default}
+        spec: {replicas: 2}
+    output:
+      - type: Added
+        object:
+          metadata: {name: pod1, namespace: default}
+          spec: {replicas: 3}
+`)
+		Expect(tcs).To(HaveLen(1))
+		err := tcs[0].Run(logr.Discard())
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("step 0"))
+		Expect(err.Error()).To(ContainSubstring("-want +got"))
+		Expect(err.Error()).To(ContainSubstring("int64(3)"))
+		Expect(err.Error()).To(ContainSubstring("int64(2)"))
+	})
+
+	It("should report unexpected output", func() {
+		tcs := load("name: unexpected" + header + `
+steps:
+  - input:
+      type: Added
+      object:
+        kind: pod
+        metadata: {name: pod1, namespace: default}
+`)
+		err := tcs[0].Run(logr.Discard())
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(`"Added"`))
+	})
+
+	It("should default the name of a test case", func() {
+		tcs := load(header + "steps: []\n")
+		Expect(tcs[0].Name).To(Equal("test.yaml#0"))
+		Expect(tcs[0].Run(logr.Discard())).To(Succeed())
+	})
+
+	It("should reject a native source with an unknown version", func() {
+		tcs := load(`
+controller:
+  name: test
+  sources:
+    - apiGroup: apps
+      kind: Deployment
+  pipeline:
+    '@aggregate':
+      - '@project':
+          metadata: $.metadata
+  target:
+    kind: view
+steps: []
+`)
+		err := tcs[0].Run(logr.Discard())
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("apps/Deployment"))
+	})
+})
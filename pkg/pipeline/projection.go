@@ -0,0 +1,493 @@
+package pipeline
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/ohler55/ojg/jp"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	"hsnlab/dcontroller/pkg/expression"
+	"hsnlab/dcontroller/pkg/object"
+)
+
+// Projection is the set of fields of the objects of a source or a lookup resource that a pipeline
+// may refer to, each field given as a path of map keys. Objects are stored in the engine with only
+// these fields (plus the apiVersion, the kind, and the name and the namespace), which considerably
+// reduces the memory footprint of the engine for large objects. A nil projection keeps all fields.
+type Projection [][]string
+
+// projectionAll is returned by the analysis when the referenced fields cannot be determined.
+var projectionAll Projection
+
+// alwaysProjected lists the fields that are kept in all projections.
+var alwaysProjected = Projection{
+	{"apiVersion"}, {"kind"}, {"metadata", "name"}, {"metadata", "namespace"},
+}
+
+// analyzePipeline determines the fields of each source a join, an aggregation and an optional
+// owner expression evaluated on the input of the aggregation refer to. The analysis is
+// conservative: if the referenced fields cannot be determined for a source, e.g., because an
+// expression refers to the entire object or the aggregation passes the object through without a
+// @project stage, then the source is not projected at all.
+func analyzePipeline(sources []Source, join *opv1a1.Join, aggregation *opv1a1.Aggregation, owner *expression.Expression) map[gvk]Projection {
+	ret := lookupProjections(sources, aggregation)
+
+	// the output of the last stage goes to the target as is
+	if aggregation == nil {
+		return ret
+	}
+	aggrPaths, ok := aggregationPaths(aggregation.Expressions)
+	if !ok {
+		return ret
+	}
+	ownerPaths, ok := expressionPaths(owner)
+	if !ok {
+		return ret
+	}
+	aggrPaths = append(aggrPaths, ownerPaths...)
+
+	if join == nil {
+		for _, s := range sources {
+			if !s.Lookup {
+				ret[s.GVK] = newProjection(aggrPaths)
+			}
+		}
+		return ret
+	}
+
+	joinPaths := [][]string{}
+	for _, e := range []*expression.Expression{&join.Expression, join.ID} {
+		if e == nil {
+			continue
+		}
+		ps, ok := expressionPaths(e)
+		if !ok {
+			return ret
+		}
+		joinPaths = append(joinPaths, ps...)
+	}
+
+	// join inputs are keyed by the source name
+	paths := append(joinPaths, aggrPaths...)
+	for _, s := range sources {
+		if s.Lookup {
+			continue
+		}
+		ps, all := [][]string{}, false
+		for _, p := range paths {
+			if p[0] != s.Name() {
+				continue
+			}
+			if len(p) == 1 {
+				all = true
+				break
+			}
+			ps = append(ps, p[1:])
+		}
+		if !all {
+			ret[s.GVK] = newProjection(ps)
+		}
+	}
+
+	return ret
+}
+
+// lookupProjections determines the fields of each lookup resource an aggregation refers to: the
+// fields of the object embedded by a @lookup stage that the later stages refer to, and the fields
+// of the other resource ("$$") in the condition of @exists-in and @not-exists-in stages. A lookup
+// resource is not projected if the referenced fields cannot be determined in any of the stages that
+// refer to it.
+func lookupProjections(sources []Source, aggregation *opv1a1.Aggregation) map[gvk]Projection {
+	ret := map[gvk]Projection{}
+	if aggregation == nil {
+		return ret
+	}
+
+	find := func(group, kind string) (gvk, bool) {
+		i := slices.IndexFunc(sources, func(s Source) bool {
+			return s.Lookup && s.GVK.Group == group && s.GVK.Kind == kind
+		})
+		if i < 0 {
+			return gvk{}, false
+		}
+		return sources[i].GVK, true
+	}
+
+	paths, all := map[gvk][][]string{}, map[gvk]bool{}
+	stages := aggregation.Expressions
+	for i := range stages {
+		var g gvk
+		var ps [][]string
+		var found, ok bool
+		switch stages[i].Op {
+		case lookupOp:
+			l, err := parseLookup(&stages[i])
+			if err != nil {
+				return ret
+			}
+			if g, found = find(l.group, l.kind); found {
+				ps, ok = embeddedPaths(l.as, stages[i+1:])
+			}
+		case existsInOp, notExistsInOp:
+			sj, err := parseSemiJoin(&stages[i])
+			if err != nil {
+				return ret
+			}
+			if g, found = find(sj.group, sj.kind); found {
+				ps, ok = subjectPaths(sj.condition)
+			}
+		}
+		switch {
+		case !found:
+		case !ok:
+			all[g] = true
+		default:
+			paths[g] = append(paths[g], ps...)
+		}
+	}
+
+	for g, ps := range paths {
+		if !all[g] {
+			ret[g] = newProjection(ps)
+		}
+	}
+
+	return ret
+}
+
+// embeddedPaths returns the fields of an object embedded into the document at the given JSONPath
+// that the subsequent stages of the aggregation refer to. Returns false if the referenced fields
+// cannot be determined, e.g., because the embedded object passes through to the output.
+func embeddedPaths(as string, stages []expression.Expression) ([][]string, bool) {
+	prefix, ok := jsonPathKeys(as)
+	if !ok {
+		return nil, false
+	}
+	ps, ok := aggregationPaths(stages)
+	if !ok {
+		return nil, false
+	}
+
+	ret := [][]string{}
+	for _, p := range ps {
+		switch {
+		case isPrefix(p, prefix):
+			// refers to the entire embedded object
+			return nil, false
+		case isPrefix(prefix, p):
+			ret = append(ret, p[len(prefix):])
+		}
+	}
+
+	return ret, true
+}
+
+// subjectPaths collects the JSONPaths an expression refers to in the local subject "$$". Returns
+// false if the paths cannot be determined statically or the expression rebinds the local subject.
+func subjectPaths(e *expression.Expression) ([][]string, bool) {
+	if e == nil {
+		return [][]string{}, true
+	}
+
+	ret := [][]string{}
+	switch e.Op {
+	case "@filter", "@any", "@none", "@all", "@map":
+		return nil, false
+	case "@string":
+		if e.Arg != nil {
+			// dynamic JSONPath
+			return nil, false
+		}
+		s, ok := e.Literal.(string)
+		if !ok || !strings.HasPrefix(s, "$$") {
+			return ret, true
+		}
+		p, ok := jsonPathKeys(s[1:])
+		if !ok {
+			return nil, false
+		}
+		return append(ret, p), true
+	}
+
+	if e.Arg != nil {
+		ps, ok := subjectPaths(e.Arg)
+		if !ok {
+			return nil, false
+		}
+		ret = append(ret, ps...)
+	}
+
+	switch lit := e.Literal.(type) {
+	case []expression.Expression:
+		for i := range lit {
+			ps, ok := subjectPaths(&lit[i])
+			if !ok {
+				return nil, false
+			}
+			ret = append(ret, ps...)
+		}
+	case map[string]expression.Expression:
+		for _, v := range lit {
+			ps, ok := subjectPaths(&v)
+			if !ok {
+				return nil, false
+			}
+			ret = append(ret, ps...)
+		}
+	}
+
+	return ret, true
+}
+
+// aggregationPaths returns the fields of the input document the aggregation refers to. Stages that
+// keep the document refer to the fields of the input, until a @project stage replaces the document
+// with a new one. Returns false if the referenced fields cannot be determined.
+func aggregationPaths(stages []expression.Expression) ([][]string, bool) {
+	ret := [][]string{}
+	for _, s := range stages {
+		switch s.Op {
+		case "@select", "@set":
+			ps, ok := expressionPaths(s.Arg)
+			if !ok {
+				return nil, false
+			}
+			ret = append(ret, ps...)
+		case "@unset":
+			// removes fields: does not refer to any
+		case "@lookup":
+			l, err := parseLookup(&s)
+			if err != nil {
+				return nil, false
+			}
+			ps, ok := expressionPaths(l.key)
+			if !ok {
+				return nil, false
+			}
+			ret = append(ret, ps...)
+		case existsInOp, notExistsInOp:
+			sj, err := parseSemiJoin(&s)
+			if err != nil {
+				return nil, false
+			}
+			// $$ refers to the other resource, which is not projected
+			ps, ok := expressionPaths(sj.condition)
+			if !ok {
+				return nil, false
+			}
+			ret = append(ret, ps...)
+		case countOp, distinctOp:
+			g, err := parseGroup(&s)
+			if err != nil {
+				return nil, false
+			}
+			// the group replaces the document
+			for _, e := range []*expression.Expression{g.key, g.value} {
+				if e == nil {
+					continue
+				}
+				ps, ok := expressionPaths(e)
+				if !ok {
+					return nil, false
+				}
+				ret = append(ret, ps...)
+			}
+			return ret, true
+		case "@project":
+			ps, ok := expressionPaths(s.Arg)
+			if !ok {
+				return nil, false
+			}
+			return append(ret, ps...), true
+		default:
+			// custom stage: cannot be analyzed
+			return nil, false
+		}
+	}
+
+	// the document passes through the aggregation
+	return nil, false
+}
+
+// expressionPaths collects the JSONPaths an expression refers to in the object. Returns false if an
+// expression refers to the entire object or the path cannot be determined statically.
+func expressionPaths(e *expression.Expression) ([][]string, bool) {
+	if e == nil {
+		return [][]string{}, true
+	}
+
+	ret := [][]string{}
+	switch {
+	case e.Op == "@string" && e.Arg != nil:
+		// dynamic JSONPath
+		return nil, false
+	case e.Op == "@string":
+		s, ok := e.Literal.(string)
+		if !ok || !strings.HasPrefix(s, "$") || strings.HasPrefix(s, "$$") || s == expression.EventRoot {
+			// a plain string, a reference to the local subject in @map, @filter, etc., or
+			// the event type
+			return ret, true
+		}
+		if k, ok := expression.OldObjectPath(s); ok {
+			// the old object may come from the cache so it is subject to the same projection
+			s = k
+		}
+		p, ok := jsonPathKeys(s)
+		if !ok {
+			return nil, false
+		}
+		return append(ret, p), true
+	}
+
+	if e.Arg != nil {
+		ps, ok := expressionPaths(e.Arg)
+		if !ok {
+			return nil, false
+		}
+		ret = append(ret, ps...)
+	}
+
+	switch lit := e.Literal.(type) {
+	case []expression.Expression:
+		for i := range lit {
+			ps, ok := expressionPaths(&lit[i])
+			if !ok {
+				return nil, false
+			}
+			ret = append(ret, ps...)
+		}
+	case map[string]expression.Expression:
+		// keys are the fields to set, only values are evaluated on the object
+		for _, v := range lit {
+			ps, ok := expressionPaths(&v)
+			if !ok {
+				return nil, false
+			}
+			ret = append(ret, ps...)
+		}
+	}
+
+	return ret, true
+}
+
+// jsonPathKeys returns the leading map keys of a JSONPath: e.g., the keys of "$.spec.ports[0].port"
+// are ["spec", "ports"]. Returns false for references to the root object and for filters that
+// refer to the root object.
+func jsonPathKeys(s string) ([]string, bool) {
+	if s == "$." || s == "$" {
+		return nil, false
+	}
+
+	x, err := jp.ParseString(s)
+	if err != nil {
+		return nil, false
+	}
+
+	// filters may refer to the root object
+	for _, f := range x {
+		if flt, ok := f.(*jp.Filter); ok && strings.Contains(flt.String(), "$") {
+			return nil, false
+		}
+	}
+
+	keys := []string{}
+loop:
+	for _, f := range x {
+		switch frag := f.(type) {
+		case jp.Root, jp.Bracket:
+		case jp.Child:
+			keys = append(keys, string(frag))
+		default:
+			break loop
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, false
+	}
+
+	return keys, true
+}
+
+// newProjection creates a projection from a set of paths, removing the paths that are covered by a
+// shorter path.
+func newProjection(paths [][]string) Projection {
+	ps := append(slices.Clone(alwaysProjected), paths...)
+	slices.SortFunc(ps, func(a, b []string) int { return slices.Compare(a, b) })
+
+	ret := Projection{}
+	for _, p := range ps {
+		if len(ret) > 0 && isPrefix(ret[len(ret)-1], p) {
+			continue
+		}
+		ret = append(ret, p)
+	}
+
+	return ret
+}
+
+func isPrefix(prefix, p []string) bool {
+	return len(prefix) <= len(p) && slices.Equal(prefix, p[:len(prefix)])
+}
+
+// apply returns a copy of the object that contains only the projected fields.
+func (p Projection) apply(obj object.Object) object.Object {
+	if p == nil || obj == nil {
+		return obj
+	}
+
+	src := object.DeepCopy(obj).UnstructuredContent()
+	dst := unstruct{}
+	for _, path := range p {
+		projectPath(src, dst, path)
+	}
+
+	ret := object.New()
+	ret.SetUnstructuredContent(dst)
+
+	return ret
+}
+
+// projectPath moves the value at the given path from src to dst. If an intermediate value is not a
+// map then the entire value is moved.
+func projectPath(src, dst unstruct, path []string) {
+	v, ok := src[path[0]]
+	if !ok {
+		return
+	}
+
+	m, isMap := v.(unstruct)
+	if len(path) == 1 || !isMap {
+		dst[path[0]] = v
+		return
+	}
+
+	d, ok := dst[path[0]].(unstruct)
+	if !ok {
+		d = unstruct{}
+		dst[path[0]] = d
+	}
+	projectPath(m, d, path[1:])
+}
+
+// SetProjection sets the fields of the objects of the given view or lookup resource that are stored
+// in the engine.
+func (eng *defaultEngine) SetProjection(gvk gvk, p Projection) {
+	if p == nil {
+		delete(eng.projections, gvk)
+		return
+	}
+	eng.projections[gvk] = p
+}
+
+// project strips the fields of an object that are not referenced in the pipeline.
+func (eng *defaultEngine) project(obj object.Object) object.Object {
+	if obj == nil {
+		return nil
+	}
+	p, ok := eng.projections[obj.GetObjectKind().GroupVersionKind()]
+	if !ok {
+		return obj
+	}
+	return p.apply(obj)
+}
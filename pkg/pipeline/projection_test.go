@@ -0,0 +1,165 @@
+package pipeline
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/yaml"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	viewv1a1 "hsnlab/dcontroller/pkg/api/view/v1alpha1"
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/object"
+)
+
+var _ = Describe("Projections", func() {
+	var podGVK, depGVK = viewv1a1.GroupVersion.WithKind("pod"), viewv1a1.GroupVersion.WithKind("dep")
+
+	analyze := func(sources []Source, data string) map[gvk]Projection {
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(data), &config)).NotTo(HaveOccurred())
+		return analyzePipeline(sources, config.Join, config.Aggregation, nil)
+	}
+
+	It("should find the fields referenced in an aggregation", func() {
+		ps := analyze(NewSources(podGVK), `
+'@aggregate':
+  - '@select':
+      '@eq': [$.spec.parent, dep1]
+  - '@project':
+      metadata:
+        name: $.metadata.name
+        labels: $.metadata.labels
+      containers:
+        '@map': [$$.name, $.spec.containers]
+      port: $.spec.ports[0].port
+  - '@select':
+      '@eq': [$.status.ready, true]`)
+		Expect(ps).To(HaveKey(podGVK))
+		Expect(ps[podGVK]).To(ConsistOf(
+			[]string{"apiVersion"},
+			[]string{"kind"},
+			[]string{"metadata", "labels"},
+			[]string{"metadata", "name"},
+			[]string{"metadata", "namespace"},
+			[]string{"spec", "containers"},
+			[]string{"spec", "parent"},
+			[]string{"spec", "ports"},
+		))
+	})
+
+	It("should find the fields referenced via the old object", func() {
+		ps := analyze(NewSources(podGVK), `
+'@aggregate':
+  - '@project':
+      metadata: $.metadata
+      event: $event
+      replicas: $old.spec.replicas`)
+		Expect(ps[podGVK]).To(ConsistOf(
+			[]string{"apiVersion"},
+			[]string{"kind"},
+			[]string{"metadata"},
+			[]string{"spec", "replicas"},
+		))
+	})
+
+	It("should find the fields referenced in a join", func() {
+		ps := analyze(NewSources(podGVK, depGVK), `
+'@join':
+  '@eq': [$.dep.metadata.name, $.pod.spec.parent]
+'@aggregate':
+  - '@project':
+      metadata:
+        name: $.pod.metadata.name
+      replicas: $.dep.spec.replicas`)
+		Expect(ps[podGVK]).To(ConsistOf(
+			[]string{"apiVersion"},
+			[]string{"kind"},
+			[]string{"metadata", "name"},
+			[]string{"metadata", "namespace"},
+			[]string{"spec", "parent"},
+		))
+		Expect(ps[depGVK]).To(ConsistOf(
+			[]string{"apiVersion"},
+			[]string{"kind"},
+			[]string{"metadata", "name"},
+			[]string{"metadata", "namespace"},
+			[]string{"spec", "replicas"},
+		))
+	})
+
+	It("should not project objects that pass through the pipeline", func() {
+		Expect(analyze(NewSources(podGVK), `
+'@aggregate':
+  - '@select':
+      '@eq': [$.spec.parent, dep1]`)).To(BeEmpty())
+		Expect(analyze(NewSources(podGVK), `
+'@aggregate':
+  - '@project': $.`)).To(BeEmpty())
+		Expect(analyze(NewSources(podGVK, depGVK), `
+'@join':
+  '@eq': [$.dep.metadata.name, $.pod.spec.parent]`)).To(BeEmpty())
+
+		ps := analyze(NewSources(podGVK, depGVK), `
+'@join':
+  '@eq': [$.dep.metadata.name, $.pod.spec.parent]
+'@aggregate':
+  - '@project':
+      metadata:
+        name: $.pod.metadata.name
+      dep: $.dep`)
+		Expect(ps).To(HaveKey(podGVK))
+		Expect(ps).NotTo(HaveKey(depGVK))
+	})
+
+	It("should store only the referenced fields and evaluate deletes correctly", func() {
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(`
+'@aggregate':
+  - '@project':
+      metadata:
+        name: $.metadata.name
+        namespace: $.metadata.namespace
+      parent: $.spec.parent`), &config)).NotTo(HaveOccurred())
+		e, err := NewPipeline("view", NewSources(podGVK), config, logger)
+		Expect(err).NotTo(HaveOccurred())
+		p := e.(*Pipeline)
+
+		pod := object.NewViewObject("pod")
+		object.SetContent(pod, unstruct{
+			"spec":   unstruct{"parent": "dep1", "containers": []any{"a", "b"}},
+			"status": unstruct{"conditions": []any{"ready"}},
+		})
+		object.SetName(pod, "default", "pod1")
+
+		deltas, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: pod})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Object.UnstructuredContent()["parent"]).To(Equal("dep1"))
+
+		st, err := p.GetState()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(st.Engines["view"].Objects).To(HaveLen(1))
+		Expect(st.Engines["view"].Objects[0]).To(Equal(unstruct{
+			"apiVersion": viewv1a1.GroupVersion.String(),
+			"kind":       "pod",
+			"metadata":   unstruct{"name": "pod1", "namespace": "default"},
+			"spec":       unstruct{"parent": "dep1"},
+		}))
+
+		// changes to unreferenced fields are ignored
+		pod2 := object.DeepCopy(pod)
+		object.SetContent(pod2, unstruct{
+			"spec":   unstruct{"parent": "dep1", "containers": []any{"a", "b", "c"}},
+			"status": unstruct{"conditions": []any{}},
+		})
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Updated, Object: pod2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(BeEmpty())
+
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Deleted, Object: pod})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Type).To(Equal(cache.Deleted))
+		Expect(deltas[0].Object.UnstructuredContent()["parent"]).To(Equal("dep1"))
+	})
+})
@@ -0,0 +1,131 @@
+package pipeline
+
+import (
+	"fmt"
+	"slices"
+
+	viewv1a1 "hsnlab/dcontroller/pkg/api/view/v1alpha1"
+	"hsnlab/dcontroller/pkg/expression"
+)
+
+const (
+	existsInOp    = "@exists-in"
+	notExistsInOp = "@not-exists-in"
+)
+
+// semiJoinStage is a parsed @exists-in or @not-exists-in aggregation stage:
+//
+//	'@exists-in':
+//	  apiGroup: discovery.k8s.io   # optional, default is the view group
+//	  kind: EndpointSlice
+//	  condition:                   # $ is the document, $$ is an object of the other resource
+//	    '@eq': ["$$.metadata.labels['kubernetes.io/service-name']", $.metadata.name]
+//
+// @exists-in passes the document through if the condition holds for at least one object of the
+// other resource and drops it otherwise, @not-exists-in does the opposite.
+type semiJoinStage struct {
+	op, group, kind string
+	condition       *expression.Expression
+}
+
+func parseSemiJoin(e *expression.Expression) (*semiJoinStage, error) {
+	if e.Arg == nil || e.Arg.Op != "@dict" {
+		return nil, NewAggregationError(fmt.Errorf("%s: argument must be a map", e.Op))
+	}
+
+	m, ok := e.Arg.Literal.(map[string]expression.Expression)
+	if !ok {
+		return nil, NewAggregationError(fmt.Errorf("%s: argument must be a map literal", e.Op))
+	}
+
+	s := &semiJoinStage{op: e.Op, group: viewv1a1.GroupVersion.Group}
+	for k, v := range m {
+		switch k {
+		case "apiGroup":
+			str, err := asAPIGroup(v)
+			if err != nil {
+				return nil, NewAggregationError(fmt.Errorf("%s: apiGroup: %w", e.Op, err))
+			}
+			s.group = str
+		case "kind":
+			str, err := asLiteralString(v)
+			if err != nil {
+				return nil, NewAggregationError(fmt.Errorf("%s: kind: %w", e.Op, err))
+			}
+			s.kind = str
+		case "condition":
+			s.condition = &v
+		default:
+			return nil, NewAggregationError(fmt.Errorf("%s: unknown field %q", e.Op, k))
+		}
+	}
+
+	switch {
+	case s.kind == "":
+		return nil, NewAggregationError(fmt.Errorf("%s: kind must be specified", e.Op))
+	case s.condition == nil:
+		return nil, NewAggregationError(fmt.Errorf("%s: condition must be specified", e.Op))
+	}
+
+	return s, nil
+}
+
+// evalSemiJoin evaluates a @exists-in or @not-exists-in stage by checking the condition against
+// each object of the other resource in the lookup cache. Since any change in the other resource
+// may affect the result, the input object is registered as a dependent of the entire resource:
+// when an object of the resource changes all dependent inputs are re-evaluated.
+func (eng *defaultEngine) evalSemiJoin(e *expression.Expression, u unstruct, input objectRef) ([]unstruct, error) {
+	s, err := parseSemiJoin(e)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := slices.IndexFunc(eng.lookups, func(g gvk) bool {
+		return g.Group == s.group && g.Kind == s.kind
+	})
+	if idx < 0 {
+		return nil, NewAggregationError(fmt.Errorf("%s: no lookup source for resource %s/%s",
+			s.op, s.group, s.kind))
+	}
+	g := eng.lookups[idx]
+
+	// the key of the wildcard reference is empty: it stands for all objects of the resource
+	eng.addLookupDep(objectRef{gvk: g}, input)
+
+	found := false
+	ctx := eng.evalCtx(u)
+	for _, obj := range eng.lookupStore[g].List() {
+		res, err := s.condition.Evaluate(ctx.WithSubject(obj.UnstructuredContent()))
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := expression.AsBool(res)
+		if err != nil {
+			return nil, NewAggregationError(
+				fmt.Errorf("%s: expected condition to evaluate to boolean: %w", s.op, err))
+		}
+		if b {
+			found = true
+			break
+		}
+	}
+
+	if found == (s.op == existsInOp) {
+		return []unstruct{u}, nil
+	}
+
+	return nil, nil
+}
+
+// semiJoinDropReason explains in a trace why a semi-join stage dropped a document.
+func semiJoinDropReason(e *expression.Expression) string {
+	s, err := parseSemiJoin(e)
+	if err != nil {
+		return fmt.Sprintf("%s stage produced no output", e.Op)
+	}
+	if s.op == existsInOp {
+		return fmt.Sprintf("%s: no matching %s object", s.op, s.kind)
+	}
+	return fmt.Sprintf("%s: found a matching %s object", s.op, s.kind)
+}
@@ -0,0 +1,193 @@
+package pipeline
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	viewv1a1 "hsnlab/dcontroller/pkg/api/view/v1alpha1"
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/object"
+)
+
+var _ = Describe("Semi-joins", func() {
+	var svc1, svc2 object.Object
+	var svcGVK = viewv1a1.GroupVersion.WithKind("svc")
+	var esGVK = schema.GroupVersionKind{Group: "discovery.k8s.io", Version: "v1", Kind: "EndpointSlice"}
+	var sources []Source
+
+	const existsPipeline = `
+'@aggregate':
+  - '@exists-in':
+      apiGroup: discovery.k8s.io
+      kind: EndpointSlice
+      condition:
+        '@and':
+          - '@eq': ["$$.metadata.labels['kubernetes.io/service-name']", $.metadata.name]
+          - '@eq': [$$.metadata.namespace, $.metadata.namespace]
+  - '@project':
+      metadata: $.metadata`
+
+	newEndpointSlice := func(name, service string) object.Object {
+		es := object.New()
+		es.SetGroupVersionKind(esGVK)
+		es.SetNamespace("default")
+		es.SetName(name)
+		es.SetLabels(map[string]string{"kubernetes.io/service-name": service})
+		return es
+	}
+
+	newSemiJoinPipeline := func(data string) Evaluator {
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(data), &config)).NotTo(HaveOccurred())
+		p, err := NewPipeline("view", sources, config, logger)
+		Expect(err).NotTo(HaveOccurred())
+		return p
+	}
+
+	summary := func(ds []cache.Delta) []string {
+		ret := []string{}
+		for _, d := range ds {
+			ret = append(ret, string(d.Type)+":"+d.Object.GetName())
+		}
+		return ret
+	}
+
+	BeforeEach(func() {
+		svc1 = object.NewViewObject("svc")
+		object.SetName(svc1, "default", "svc1")
+		svc2 = object.NewViewObject("svc")
+		object.SetName(svc2, "default", "svc2")
+
+		sources = append(NewSources(svcGVK), Source{GVK: esGVK, Lookup: true})
+	})
+
+	It("should collect the resources of the semi-joins", func() {
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(existsPipeline), &config)).NotTo(HaveOccurred())
+		rs, err := LookupResources(config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rs).To(HaveLen(1))
+		Expect(*rs[0].Group).To(Equal("discovery.k8s.io"))
+		Expect(rs[0].Kind).To(Equal("EndpointSlice"))
+	})
+
+	It("should emit and retract objects as partners appear and disappear", func() {
+		p := newSemiJoinPipeline(existsPipeline)
+
+		deltas, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: svc1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(BeEmpty())
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Added, Object: svc2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(BeEmpty())
+
+		es1 := newEndpointSlice("es1", "svc1")
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Added, Object: es1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary(deltas)).To(Equal([]string{"Added:svc1"}))
+
+		// a second partner does not change the result
+		es2 := newEndpointSlice("es2", "svc1")
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Added, Object: es2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(BeEmpty())
+
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Deleted, Object: es1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(BeEmpty())
+
+		// the partner moves to another service
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Updated, Object: newEndpointSlice("es2", "svc2")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary(deltas)).To(Equal([]string{"Deleted:svc1", "Added:svc2"}))
+
+		// a new service with an existing partner is emitted immediately
+		svc3 := object.NewViewObject("svc")
+		object.SetName(svc3, "default", "svc3")
+		_, err = p.Evaluate(cache.Delta{Type: cache.Added, Object: newEndpointSlice("es3", "svc3")})
+		Expect(err).NotTo(HaveOccurred())
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Added, Object: svc3})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary(deltas)).To(Equal([]string{"Added:svc3"}))
+
+		// the deleted service no longer depends on the partners
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Deleted, Object: svc3})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary(deltas)).To(Equal([]string{"Deleted:svc3"}))
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Deleted, Object: newEndpointSlice("es3", "svc3")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(BeEmpty())
+	})
+
+	It("should select objects without a partner", func() {
+		p := newSemiJoinPipeline(`
+'@aggregate':
+  - '@not-exists-in':
+      apiGroup: discovery.k8s.io
+      kind: EndpointSlice
+      condition:
+        '@eq': ["$$.metadata.labels['kubernetes.io/service-name']", $.metadata.name]
+  - '@project':
+      metadata: $.metadata`)
+
+		deltas, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: svc1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary(deltas)).To(Equal([]string{"Added:svc1"}))
+
+		es1 := newEndpointSlice("es1", "svc1")
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Added, Object: es1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary(deltas)).To(Equal([]string{"Deleted:svc1"}))
+
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Deleted, Object: es1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary(deltas)).To(Equal([]string{"Added:svc1"}))
+	})
+
+	It("should restore the dependencies from a saved state", func() {
+		p := newSemiJoinPipeline(existsPipeline)
+		_, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: svc1})
+		Expect(err).NotTo(HaveOccurred())
+
+		st, err := p.(StatefulEvaluator).GetState()
+		Expect(err).NotTo(HaveOccurred())
+
+		p = newSemiJoinPipeline(existsPipeline)
+		Expect(p.(StatefulEvaluator).SetState(st)).To(Succeed())
+
+		deltas, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: newEndpointSlice("es1", "svc1")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary(deltas)).To(Equal([]string{"Added:svc1"}))
+	})
+
+	It("should find the fields referenced in the condition", func() {
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(existsPipeline), &config)).NotTo(HaveOccurred())
+		ps := analyzePipeline(sources, config.Join, config.Aggregation, nil)
+		Expect(ps[esGVK]).To(ConsistOf(
+			[]string{"apiVersion"},
+			[]string{"kind"},
+			[]string{"metadata", "labels", "kubernetes.io/service-name"},
+			[]string{"metadata", "name"},
+			[]string{"metadata", "namespace"},
+		))
+		Expect(ps[svcGVK]).To(ConsistOf(
+			[]string{"apiVersion"},
+			[]string{"kind"},
+			[]string{"metadata"},
+		))
+	})
+
+	It("should reject a malformed semi-join", func() {
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(`
+'@aggregate':
+  - '@exists-in':
+      kind: EndpointSlice`), &config)).NotTo(HaveOccurred())
+		_, err := LookupResources(config)
+		Expect(err).To(HaveOccurred())
+	})
+})
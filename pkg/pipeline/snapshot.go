@@ -0,0 +1,151 @@
+package pipeline
+
+import (
+	"cmp"
+	"slices"
+
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/object"
+	"hsnlab/dcontroller/pkg/util"
+)
+
+// EvaluateSnapshot processes a complete snapshot of a base view: the snapshot is diffed against
+// the engine's cache, the resultant base deltas are processed through the join and the
+// aggregation, and the output deltas are consolidated into the minimal set of changes.
+func (eng *defaultEngine) EvaluateSnapshot(j *Join, a *Aggregation, gvk gvk, objs []object.Object) ([]cache.Delta, error) {
+	eng.log.V(2).Info("snapshot: processing", "GVK", gvk, "objects", len(objs))
+
+	ret := []cache.Delta{}
+	for _, delta := range eng.diffSnapshot(gvk, objs) {
+		if eng.IsLookup(gvk) {
+			ds, err := eng.EvaluateLookup(a, delta)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, ds...)
+			continue
+		}
+
+		ds := []cache.Delta{delta}
+		if j != nil {
+			var err error
+			ds, err = eng.EvaluateJoin(j, delta)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if a == nil {
+			ret = append(ret, ds...)
+			continue
+		}
+
+		for _, d := range ds {
+			as, err := eng.EvaluateAggregation(a, d)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, as...)
+		}
+	}
+
+	ret = ConsolidateDeltas(ret)
+
+	eng.log.V(2).Info("snapshot: ready", "GVK", gvk, "result", util.Stringify(ret))
+
+	return ret, nil
+}
+
+// diffSnapshot generates the base deltas that bring the cache for the given view in sync with the
+// snapshot: first the deletes, then the updates and finally the adds, each sorted by object key.
+func (eng *defaultEngine) diffSnapshot(gvk gvk, objs []object.Object) []cache.Delta {
+	store, ok := eng.lookupStore[gvk]
+	if !ok {
+		eng.initViewStore(gvk)
+		store = eng.baseViewStore[gvk]
+	}
+
+	// store only the fields the pipeline refers to
+	projected := make([]object.Object, len(objs))
+	for i, o := range objs {
+		projected[i] = eng.project(o)
+	}
+	objs = projected
+
+	current := map[string]object.Object{}
+	for _, o := range objs {
+		current[ObjectKey(o).String()] = o
+	}
+
+	dels, upds, adds := []cache.Delta{}, []cache.Delta{}, []cache.Delta{}
+	for _, o := range store.List() {
+		if _, ok := current[ObjectKey(o).String()]; !ok {
+			dels = append(dels, cache.Delta{Type: cache.Deleted, Object: o})
+		}
+	}
+
+	for _, o := range objs {
+		old, exists, err := store.Get(o)
+		switch {
+		case err != nil || !exists:
+			adds = append(adds, cache.Delta{Type: cache.Added, Object: o})
+		case !object.DeepEqual(o, old):
+			upds = append(upds, cache.Delta{Type: cache.Updated, Object: o})
+		}
+	}
+
+	ret := []cache.Delta{}
+	for _, ds := range [][]cache.Delta{dels, upds, adds} {
+		slices.SortFunc(ds, func(a, b cache.Delta) int {
+			return cmp.Compare(ObjectKey(a.Object).String(), ObjectKey(b.Object).String())
+		})
+		ret = append(ret, ds...)
+	}
+
+	return ret
+}
+
+// ConsolidateDeltas reduces a sequence of deltas to the net effect on each object: e.g., an add
+// followed by a delete cancels out, and a delete followed by an add of the same content is a
+// no-op. The result lists the deletes first, then the updates and finally the adds, each sorted by
+// the namespace and the name of the object.
+func ConsolidateDeltas(ds []cache.Delta) []cache.Delta {
+	type net struct{ first, last cache.Delta }
+
+	keys, nets := []string{}, map[string]*net{}
+	for _, d := range ds {
+		if d.Object == nil {
+			continue
+		}
+		key := d.Object.GetObjectKind().GroupVersionKind().String() + "/" + ObjectKey(d.Object).String()
+		if n, ok := nets[key]; ok {
+			n.last = d
+			continue
+		}
+		keys = append(keys, key)
+		nets[key] = &net{first: d, last: d}
+	}
+
+	dels, upds, adds := []cache.Delta{}, []cache.Delta{}, []cache.Delta{}
+	for _, key := range keys {
+		first, last := nets[key].first, nets[key].last
+		switch {
+		case first.Type == cache.Added && last.Type == cache.Deleted:
+			// transient object
+		case first.Type == cache.Added:
+			adds = append(adds, cache.Delta{Type: cache.Added, Object: last.Object})
+		case last.Type == cache.Deleted:
+			dels = append(dels, cache.Delta{Type: cache.Deleted, Object: last.Object})
+		case first.Type == cache.Deleted && object.DeepEqual(first.Object, last.Object):
+			// deleted and re-added as is
+		default:
+			upd := cache.Delta{Type: cache.Updated, Object: last.Object, OldObject: first.OldObject}
+			if first.Type == cache.Deleted {
+				upd.OldObject = first.Object
+			}
+			upds = append(upds, upd)
+		}
+	}
+
+	return orderDeltas(append(append(dels, upds...), adds...))
+}
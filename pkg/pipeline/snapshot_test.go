@@ -0,0 +1,146 @@
+package pipeline
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/yaml"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	viewv1a1 "hsnlab/dcontroller/pkg/api/view/v1alpha1"
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/object"
+)
+
+var _ = Describe("Snapshots", func() {
+	var pod1, pod2, pod3, dep1 object.Object
+	var podGVK, depGVK = viewv1a1.GroupVersion.WithKind("pod"), viewv1a1.GroupVersion.WithKind("dep")
+
+	newPod := func(name, parent string) object.Object {
+		pod := object.NewViewObject("pod")
+		object.SetContent(pod, unstruct{"spec": unstruct{"parent": parent}})
+		object.SetName(pod, "default", name)
+		return pod
+	}
+
+	newSnapshotPipeline := func(sources []Source, data string) SnapshotEvaluator {
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(data), &config)).NotTo(HaveOccurred())
+		p, err := NewPipeline("view", sources, config, logger)
+		Expect(err).NotTo(HaveOccurred())
+		s, ok := p.(SnapshotEvaluator)
+		Expect(ok).To(BeTrue())
+		return s
+	}
+
+	BeforeEach(func() {
+		pod1 = newPod("pod1", "dep1")
+		pod2 = newPod("pod2", "dep1")
+		pod3 = newPod("pod3", "dep2")
+		dep1 = object.NewViewObject("dep")
+		object.SetName(dep1, "default", "dep1")
+	})
+
+	It("should diff a snapshot against the current state of an aggregation", func() {
+		p := newSnapshotPipeline(NewSources(podGVK), `
+'@aggregate':
+  - '@select':
+      '@eq': [$.spec.parent, dep1]`)
+
+		deltas, err := p.EvaluateSnapshot(podGVK, []object.Object{pod2, pod1, pod3})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(2))
+		Expect(deltas[0].Type).To(Equal(cache.Added))
+		Expect(deltas[0].Object.GetName()).To(Equal("pod1"))
+		Expect(deltas[1].Type).To(Equal(cache.Added))
+		Expect(deltas[1].Object.GetName()).To(Equal("pod2"))
+
+		// the same snapshot is a no-op
+		deltas, err = p.EvaluateSnapshot(podGVK, []object.Object{pod1, pod2, pod3})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(BeEmpty())
+
+		// pod1 is gone, pod2 moves out of the view, pod3 moves in
+		pod2 = newPod("pod2", "dep2")
+		pod3 = newPod("pod3", "dep1")
+		deltas, err = p.EvaluateSnapshot(podGVK, []object.Object{pod2, pod3})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(3))
+		Expect(deltas[0].Type).To(Equal(cache.Deleted))
+		Expect(deltas[0].Object.GetName()).To(Equal("pod1"))
+		Expect(deltas[1].Type).To(Equal(cache.Deleted))
+		Expect(deltas[1].Object.GetName()).To(Equal("pod2"))
+		Expect(deltas[2].Type).To(Equal(cache.Added))
+		Expect(deltas[2].Object.GetName()).To(Equal("pod3"))
+	})
+
+	It("should diff a snapshot against the current state of a join", func() {
+		p := newSnapshotPipeline(NewSources(podGVK, depGVK), `
+'@join':
+  '@eq': [$.dep.metadata.name, $.pod.spec.parent]
+'@aggregate':
+  - '@project':
+      metadata:
+        name: $.pod.metadata.name
+        namespace: $.pod.metadata.namespace
+      parent: $.dep.metadata.name`)
+
+		_, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: dep1})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = p.Evaluate(cache.Delta{Type: cache.Added, Object: pod1})
+		Expect(err).NotTo(HaveOccurred())
+
+		// missed the add of pod2 and the delete of pod1
+		deltas, err := p.EvaluateSnapshot(podGVK, []object.Object{pod2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(2))
+		Expect(deltas[0].Type).To(Equal(cache.Deleted))
+		Expect(deltas[0].Object.GetName()).To(Equal("pod1"))
+		Expect(deltas[1].Type).To(Equal(cache.Added))
+		Expect(deltas[1].Object.GetName()).To(Equal("pod2"))
+
+		// an empty snapshot deletes all
+		deltas, err = p.EvaluateSnapshot(depGVK, []object.Object{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Type).To(Equal(cache.Deleted))
+		Expect(deltas[0].Object.GetName()).To(Equal("pod2"))
+	})
+
+	It("should handle sync and replace events as upserts", func() {
+		p := newSnapshotPipeline(NewSources(podGVK), `
+'@aggregate':
+  - '@project':
+      metadata: $.metadata`)
+
+		deltas, err := p.Evaluate(cache.Delta{Type: cache.Sync, Object: pod1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Type).To(Equal(cache.Added))
+
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Sync, Object: pod1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(BeEmpty())
+
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Replaced, Object: pod2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Type).To(Equal(cache.Added))
+	})
+
+	It("should consolidate deltas to the net effect", func() {
+		pod1b := newPod("pod1", "dep2")
+		ds := ConsolidateDeltas([]cache.Delta{
+			{Type: cache.Added, Object: pod1},
+			{Type: cache.Deleted, Object: pod1},
+			{Type: cache.Deleted, Object: pod2},
+			{Type: cache.Added, Object: pod2},
+			{Type: cache.Deleted, Object: pod3},
+			{Type: cache.Added, Object: newPod("pod3", "dep1")},
+			{Type: cache.Updated, Object: pod1b},
+		})
+		Expect(ds).To(Equal([]cache.Delta{
+			{Type: cache.Updated, Object: newPod("pod3", "dep1"), OldObject: pod3},
+			{Type: cache.Added, Object: pod1b},
+		}))
+	})
+})
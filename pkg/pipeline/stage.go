@@ -0,0 +1,116 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	"hsnlab/dcontroller/pkg/expression"
+)
+
+// StageFunc implements a custom aggregation stage. The function receives the argument of the stage
+// and an evaluation context that holds the current document in ctx.Object, and it returns the
+// documents emitted by the stage: none to drop the document, one for a one-to-one stage, or more
+// for a one-to-many stage. Each output document must have a unique .metadata.name and
+// .metadata.namespace. The function may modify the current document in place but distinct output
+// documents must not share state.
+//
+// Stages must be deterministic: on a delete event the engine re-evaluates the aggregation on the
+// last known version of the object to find the documents to remove from the view, and update events
+// are processed as a delete followed by an add.
+type StageFunc func(arg *expression.Expression, ctx expression.EvalCtx) ([]map[string]any, error)
+
+// builtinStages lists the aggregation stages implemented by the engine.
+var builtinStages = map[string]bool{
+	"@select":  true,
+	"@project": true,
+	"@set":     true,
+	"@unset":   true,
+	"@lookup":  true,
+
+	existsInOp:    true,
+	notExistsInOp: true,
+	countOp:       true,
+	distinctOp:    true,
+}
+
+var stageRegistry = struct {
+	sync.RWMutex
+	stages map[string]StageFunc
+}{stages: map[string]StageFunc{}}
+
+// RegisterStage registers a custom aggregation stage with the given name, e.g., "@explode". Once
+// registered, the stage can be used in the @aggregate list of any pipeline, including the ones
+// loaded from Operator resources. The name must start with "@" and must not clash with a built-in or
+// an already registered stage. Stages must be registered before creating the pipelines that use
+// them: pipelines referring to an unknown stage are rejected. The registry is safe for concurrent
+// use.
+func RegisterStage(name string, fn StageFunc) error {
+	if !strings.HasPrefix(name, "@") || len(name) < 2 {
+		return fmt.Errorf("invalid stage name %q: must start with @", name)
+	}
+	if fn == nil {
+		return errors.New("nil stage function")
+	}
+	if builtinStages[name] {
+		return fmt.Errorf("cannot override built-in stage %q", name)
+	}
+
+	stageRegistry.Lock()
+	defer stageRegistry.Unlock()
+	if _, ok := stageRegistry.stages[name]; ok {
+		return fmt.Errorf("stage %q already registered", name)
+	}
+	stageRegistry.stages[name] = fn
+
+	return nil
+}
+
+// UnregisterStage removes a custom aggregation stage.
+func UnregisterStage(name string) {
+	stageRegistry.Lock()
+	defer stageRegistry.Unlock()
+	delete(stageRegistry.stages, name)
+}
+
+func getStage(name string) (StageFunc, bool) {
+	stageRegistry.RLock()
+	defer stageRegistry.RUnlock()
+	fn, ok := stageRegistry.stages[name]
+	return fn, ok
+}
+
+// checkStages makes sure that each stage of an aggregation is either a built-in or a registered
+// stage.
+func checkStages(aggregation *opv1a1.Aggregation) error {
+	if aggregation == nil {
+		return nil
+	}
+	for _, e := range aggregation.Expressions {
+		if builtinStages[e.Op] {
+			continue
+		}
+		if _, ok := getStage(e.Op); !ok {
+			return fmt.Errorf("invalid controller configuration: unknown aggregation stage %q", e.Op)
+		}
+	}
+	return nil
+}
+
+// evalCustomStage evaluates a registered aggregation stage.
+func (eng *defaultEngine) evalCustomStage(e *expression.Expression, u unstruct) ([]unstruct, error) {
+	fn, ok := getStage(e.Op)
+	if !ok {
+		return nil, NewAggregationError(
+			fmt.Errorf("unknown aggregation stage %q", e.Op))
+	}
+
+	vs, err := fn(e.Arg, eng.evalCtx(u))
+	if err != nil {
+		return nil, NewAggregationError(fmt.Errorf("%s: %w", e.Op, err))
+	}
+
+	return vs, nil
+}
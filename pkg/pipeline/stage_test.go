@@ -0,0 +1,141 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	viewv1a1 "hsnlab/dcontroller/pkg/api/view/v1alpha1"
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/expression"
+	"hsnlab/dcontroller/pkg/object"
+)
+
+// explode emits a separate document per element of the list given in the argument.
+func explode(arg *expression.Expression, ctx expression.EvalCtx) ([]map[string]any, error) {
+	res, err := arg.Evaluate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list, err := expression.AsList(res)
+	if err != nil {
+		return nil, err
+	}
+
+	u, ok := ctx.Object.(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid document")
+	}
+	name, _, err := unstructured.NestedString(u, "metadata", "name")
+	if err != nil {
+		return nil, err
+	}
+	namespace, _, err := unstructured.NestedString(u, "metadata", "namespace")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []map[string]any{}
+	for _, e := range list {
+		ret = append(ret, map[string]any{
+			"metadata": map[string]any{
+				"name":      fmt.Sprintf("%s-%v", name, e),
+				"namespace": namespace,
+			},
+			"item": e,
+		})
+	}
+
+	return ret, nil
+}
+
+var _ = Describe("Custom stages", func() {
+	var p Evaluator
+	var obj object.Object
+
+	setList := func(list ...any) {
+		obj = object.NewViewObject("view")
+		object.SetContent(obj, unstruct{"spec": unstruct{"list": list}})
+		object.SetName(obj, "default", "obj")
+	}
+
+	BeforeEach(func() {
+		Expect(RegisterStage("@explode", explode)).NotTo(HaveOccurred())
+		DeferCleanup(func() { UnregisterStage("@explode") })
+
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(`
+'@aggregate':
+  - '@explode': $.spec.list
+  - '@select':
+      '@not':
+        '@eq': [$.item, skip]`), &config)).NotTo(HaveOccurred())
+		var err error
+		p, err = NewPipeline("view", NewSources(viewv1a1.GroupVersion.WithKind("view")), config, logger)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reject invalid registrations", func() {
+		Expect(RegisterStage("explode", explode)).To(HaveOccurred())
+		Expect(RegisterStage("@project", explode)).To(HaveOccurred())
+		Expect(RegisterStage("@explode", explode)).To(HaveOccurred())
+		Expect(RegisterStage("@other", nil)).To(HaveOccurred())
+	})
+
+	It("should reject a pipeline with an unknown stage", func() {
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(`
+'@aggregate':
+  - '@implode': $.spec.list`), &config)).NotTo(HaveOccurred())
+		_, err := NewPipeline("view", NewSources(viewv1a1.GroupVersion.WithKind("view")), config, logger)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("@implode"))
+
+		// also in the steps of a chain
+		config = opv1a1.Pipeline{}
+		Expect(yaml.Unmarshal([]byte(`
+'@steps':
+  - name: step
+    '@aggregate':
+      - '@implode': $.spec.list`), &config)).NotTo(HaveOccurred())
+		_, err = NewPipeline("view", NewSources(viewv1a1.GroupVersion.WithKind("view")), config, logger)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("@implode"))
+	})
+
+	It("should evaluate a one-to-many stage", func() {
+		summary := func(ds []cache.Delta) []string {
+			ret := []string{}
+			for _, d := range ds {
+				ret = append(ret, fmt.Sprintf("%s:%s", d.Type, d.Object.GetName()))
+			}
+			return ret
+		}
+
+		setList("a", "b", "skip")
+		deltas, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: obj})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary(deltas)).To(Equal([]string{"Added:obj-a", "Added:obj-b"}))
+
+		setList("b", "c")
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Updated, Object: obj})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary(deltas)).To(Equal([]string{"Deleted:obj-a", "Updated:obj-b", "Added:obj-c"}))
+
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Deleted, Object: obj})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(summary(deltas)).To(Equal([]string{"Deleted:obj-b", "Deleted:obj-c"}))
+	})
+
+	It("should fail on an unknown stage", func() {
+		UnregisterStage("@explode")
+		setList("a")
+		_, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: obj})
+		Expect(err).To(HaveOccurred())
+	})
+})
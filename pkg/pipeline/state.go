@@ -0,0 +1,279 @@
+package pipeline
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/object"
+)
+
+// StatefulEvaluator is an evaluator whose internal state can be saved and restored, e.g., to
+// survive a restart.
+type StatefulEvaluator interface {
+	Evaluator
+	// GetState returns a serializable copy of the internal state of the evaluator.
+	GetState() (*State, error)
+	// SetState replaces the internal state of the evaluator with a previously saved state.
+	SetState(*State) error
+}
+
+// State is the serializable state of a pipeline.
+type State struct {
+	// Pipeline is the string representation of the pipeline the state was saved from. The state
+	// cannot be restored into a different pipeline.
+	Pipeline string `json:"pipeline"`
+	// Engines is the state of the engine of each pipeline step, indexed by the view the step
+	// writes into.
+	Engines map[string]*EngineState `json:"engines"`
+}
+
+// EngineState is the serializable internal state of a pipeline engine.
+type EngineState struct {
+	// Objects are the objects in the internal view caches of the engine.
+	Objects []unstruct `json:"objects,omitempty"`
+	// Lookups are the cached objects of the lookup resources.
+	Lookups []unstruct `json:"lookups,omitempty"`
+	// LookupDeps lists the looked-up objects each input of the aggregation depends on.
+	LookupDeps []LookupDep `json:"lookupDeps,omitempty"`
+	// Groups are the reference counts of the groups of @count and @distinct stages.
+	Groups []GroupState `json:"groups,omitempty"`
+}
+
+// GroupState is the state of a group of a @count or @distinct stage.
+type GroupState struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	// Rows is the number of documents in the group.
+	Rows int64 `json:"rows"`
+	// Values is the number of documents carrying each distinct value, keyed by the JSON
+	// encoding of the value.
+	Values map[string]int64 `json:"values,omitempty"`
+}
+
+// LookupDep records that an input of the aggregation depends on a looked-up object. An empty object
+// key means that the input depends on all objects of the resource, as in @exists-in stages.
+type LookupDep struct {
+	Object ObjectRef `json:"object"`
+	Input  ObjectRef `json:"input"`
+}
+
+// ObjectRef is a serializable reference to an object.
+type ObjectRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Key        string `json:"key"`
+}
+
+func (r objectRef) export() ObjectRef {
+	apiVersion, kind := r.gvk.ToAPIVersionAndKind()
+	return ObjectRef{APIVersion: apiVersion, Kind: kind, Key: r.key}
+}
+
+func (r ObjectRef) internal() objectRef {
+	return objectRef{gvk: schema.FromAPIVersionAndKind(r.APIVersion, r.Kind), key: r.Key}
+}
+
+func compareObjectRefs(a, b objectRef) int {
+	return cmp.Or(cmp.Compare(a.gvk.String(), b.gvk.String()), cmp.Compare(a.key, b.key))
+}
+
+// GetState returns a copy of the internal state of the engine.
+func (eng *defaultEngine) GetState() (*EngineState, error) {
+	st := &EngineState{
+		Objects:    storeContent(eng.baseViewStore),
+		Lookups:    storeContent(eng.lookupStore),
+		LookupDeps: []LookupDep{},
+	}
+
+	inputs := make([]objectRef, 0, len(eng.lookupRefs))
+	for input := range eng.lookupRefs {
+		inputs = append(inputs, input)
+	}
+	slices.SortFunc(inputs, compareObjectRefs)
+	for _, input := range inputs {
+		refs := make([]objectRef, 0, len(eng.lookupRefs[input]))
+		for ref := range eng.lookupRefs[input] {
+			refs = append(refs, ref)
+		}
+		slices.SortFunc(refs, compareObjectRefs)
+		for _, ref := range refs {
+			st.LookupDeps = append(st.LookupDeps, LookupDep{Object: ref.export(), Input: input.export()})
+		}
+	}
+
+	keys := make([]string, 0, len(eng.groups))
+	for k := range eng.groups {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		g := eng.groups[k].copy()
+		gs := GroupState{Name: g.name, Namespace: g.namespace, Rows: g.rows}
+		if len(g.values) > 0 {
+			gs.Values = g.values
+		}
+		st.Groups = append(st.Groups, gs)
+	}
+
+	return st, nil
+}
+
+// SetState replaces the internal state of the engine. Looked-up objects of resources that are no
+// longer used in @lookup stages are ignored. The state of the engine is unchanged on error.
+func (eng *defaultEngine) SetState(st *EngineState) error {
+	if st == nil {
+		return errors.New("empty engine state")
+	}
+
+	baseViewStore := make(map[gvk]*cache.Store)
+	for _, u := range st.Objects {
+		obj, err := stateObject(u)
+		if err != nil {
+			return err
+		}
+		g := obj.GetObjectKind().GroupVersionKind()
+		if _, ok := baseViewStore[g]; !ok {
+			baseViewStore[g] = cache.NewStore()
+		}
+		if err := baseViewStore[g].Add(obj); err != nil {
+			return fmt.Errorf("could not restore object %s: %w", ObjectKey(obj), err)
+		}
+	}
+
+	lookupStore := make(map[gvk]*cache.Store)
+	for g := range eng.lookupStore {
+		lookupStore[g] = cache.NewStore()
+	}
+	for _, u := range st.Lookups {
+		obj, err := stateObject(u)
+		if err != nil {
+			return err
+		}
+		store, ok := lookupStore[obj.GetObjectKind().GroupVersionKind()]
+		if !ok {
+			continue
+		}
+		if err := store.Add(obj); err != nil {
+			return fmt.Errorf("could not restore looked-up object %s: %w", ObjectKey(obj), err)
+		}
+	}
+
+	groups := make(map[string]*group)
+	for _, gs := range st.Groups {
+		if gs.Name == "" || gs.Rows <= 0 {
+			return NewInvalidObjectError("invalid group in engine state: missing name or empty group")
+		}
+		g := &group{name: gs.Name, namespace: gs.Namespace, rows: gs.Rows, values: gs.Values}
+		groups[groupKey(gs.Namespace, gs.Name)] = g.copy()
+	}
+
+	eng.baseViewStore, eng.lookupStore = baseViewStore, lookupStore
+	eng.groups, eng.groupsBefore = groups, make(map[string]*group)
+	eng.lookupDeps = make(map[objectRef]map[objectRef]bool)
+	eng.lookupRefs = make(map[objectRef]map[objectRef]bool)
+	for _, dep := range st.LookupDeps {
+		eng.addLookupDep(dep.Object.internal(), dep.Input.internal())
+	}
+
+	return nil
+}
+
+// storeContent returns the content of a set of stores, sorted by GVK and object key.
+func storeContent(stores map[gvk]*cache.Store) []unstruct {
+	ret := []unstruct{}
+	gvks := make([]gvk, 0, len(stores))
+	for g := range stores {
+		gvks = append(gvks, g)
+	}
+	slices.SortFunc(gvks, func(a, b gvk) int { return cmp.Compare(a.String(), b.String()) })
+	for _, g := range gvks {
+		objs := stores[g].List()
+		slices.SortFunc(objs, func(a, b object.Object) int {
+			return cmp.Compare(ObjectKey(a).String(), ObjectKey(b).String())
+		})
+		for _, obj := range objs {
+			ret = append(ret, obj.UnstructuredContent())
+		}
+	}
+	return ret
+}
+
+func stateObject(u unstruct) (object.Object, error) {
+	obj := object.New()
+	obj.SetUnstructuredContent(u)
+	obj = object.DeepCopy(obj)
+	if obj.GetObjectKind().GroupVersionKind().Kind == "" || obj.GetName() == "" {
+		return nil, NewInvalidObjectError("invalid object in engine state: missing kind or name")
+	}
+	return obj, nil
+}
+
+// GetState returns the internal state of the pipeline.
+func (p *Pipeline) GetState() (*State, error) {
+	st, err := p.engine.GetState()
+	if err != nil {
+		return nil, err
+	}
+	return &State{
+		Pipeline: p.String(),
+		Engines:  map[string]*EngineState{p.engine.View(): st},
+	}, nil
+}
+
+// SetState restores the internal state of the pipeline.
+func (p *Pipeline) SetState(st *State) error {
+	if err := checkState(p, st); err != nil {
+		return err
+	}
+	es, ok := st.Engines[p.engine.View()]
+	if !ok {
+		return fmt.Errorf("no state for view %q", p.engine.View())
+	}
+	return p.engine.SetState(es)
+}
+
+// GetState returns the internal state of all steps of the chain.
+func (c *Chain) GetState() (*State, error) {
+	ret := &State{Pipeline: c.String(), Engines: map[string]*EngineState{}}
+	for _, step := range c.steps {
+		st, err := step.engine.GetState()
+		if err != nil {
+			return nil, err
+		}
+		ret.Engines[step.name] = st
+	}
+	return ret, nil
+}
+
+// SetState restores the internal state of all steps of the chain.
+func (c *Chain) SetState(st *State) error {
+	if err := checkState(c, st); err != nil {
+		return err
+	}
+	for _, step := range c.steps {
+		if _, ok := st.Engines[step.name]; !ok {
+			return fmt.Errorf("no state for step %q", step.name)
+		}
+	}
+	for _, step := range c.steps {
+		if err := step.engine.SetState(st.Engines[step.name]); err != nil {
+			return fmt.Errorf("step %q: %w", step.name, err)
+		}
+	}
+	return nil
+}
+
+func checkState(e Evaluator, st *State) error {
+	if st == nil {
+		return errors.New("empty pipeline state")
+	}
+	if st.Pipeline != e.String() {
+		return errors.New("the state was saved from a different pipeline")
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package pipeline
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/json"
+	"sigs.k8s.io/yaml"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	viewv1a1 "hsnlab/dcontroller/pkg/api/view/v1alpha1"
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/object"
+)
+
+var _ = Describe("State", func() {
+	var pod1, pod2, dep1 object.Object
+	var podGVK, depGVK = viewv1a1.GroupVersion.WithKind("pod"), viewv1a1.GroupVersion.WithKind("dep")
+
+	const joinPipeline = `
+'@join':
+  '@eq': [$.dep.metadata.name, $.pod.spec.parent]
+'@aggregate':
+  - '@project':
+      metadata:
+        name: $.pod.metadata.name
+        namespace: $.pod.metadata.namespace
+      replicas: $.dep.spec.replicas`
+
+	newStatefulPipeline := func(data string) StatefulEvaluator {
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(data), &config)).NotTo(HaveOccurred())
+		p, err := NewPipeline("view", NewSources(podGVK, depGVK), config, logger)
+		Expect(err).NotTo(HaveOccurred())
+		s, ok := p.(StatefulEvaluator)
+		Expect(ok).To(BeTrue())
+		return s
+	}
+
+	// roundtrip simulates saving the state and restoring it after a restart
+	roundtrip := func(st *State) *State {
+		data, err := json.Marshal(st)
+		Expect(err).NotTo(HaveOccurred())
+		ret := &State{}
+		Expect(json.Unmarshal(data, ret)).NotTo(HaveOccurred())
+		return ret
+	}
+
+	BeforeEach(func() {
+		pod1 = object.NewViewObject("pod")
+		object.SetContent(pod1, unstruct{"spec": unstruct{"parent": "dep1"}})
+		object.SetName(pod1, "default", "pod1")
+		pod2 = object.NewViewObject("pod")
+		object.SetContent(pod2, unstruct{"spec": unstruct{"parent": "dep1"}})
+		object.SetName(pod2, "default", "pod2")
+		dep1 = object.NewViewObject("dep")
+		object.SetContent(dep1, unstruct{"spec": unstruct{"replicas": int64(2)}})
+		object.SetName(dep1, "default", "dep1")
+	})
+
+	It("should restore the state of a pipeline and reconcile it against a snapshot", func() {
+		p := newStatefulPipeline(joinPipeline)
+		for _, obj := range []object.Object{dep1, pod1, pod2} {
+			_, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: obj})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		st, err := p.GetState()
+		Expect(err).NotTo(HaveOccurred())
+		st = roundtrip(st)
+
+		// restart
+		p = newStatefulPipeline(joinPipeline)
+		Expect(p.SetState(st)).NotTo(HaveOccurred())
+
+		// the initial list yields duplicates
+		deltas, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: pod1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(BeEmpty())
+		deltas, err = p.Evaluate(cache.Delta{Type: cache.Added, Object: dep1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(BeEmpty())
+
+		// pod2 was deleted while we were down
+		sp, ok := p.(SnapshotEvaluator)
+		Expect(ok).To(BeTrue())
+		deltas, err = sp.EvaluateSnapshot(podGVK, []object.Object{pod1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Type).To(Equal(cache.Deleted))
+		Expect(deltas[0].Object.GetName()).To(Equal("pod2"))
+	})
+
+	It("should restore the state of a chain", func() {
+		const chain = `
+'@steps':
+  - name: parents
+    '@aggregate':
+      - '@project':
+          metadata: $.metadata
+          parent: $.spec.parent
+  - '@aggregate':
+      - '@select':
+          '@eq': [$.parent, dep1]`
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(chain), &config)).NotTo(HaveOccurred())
+		e, err := NewPipeline("view", NewSources(podGVK), config, logger)
+		Expect(err).NotTo(HaveOccurred())
+		p := e.(StatefulEvaluator)
+
+		_, err = p.Evaluate(cache.Delta{Type: cache.Added, Object: pod1})
+		Expect(err).NotTo(HaveOccurred())
+
+		st, err := p.GetState()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(st.Engines).To(HaveKey("parents"))
+		Expect(st.Engines).To(HaveKey("view"))
+		st = roundtrip(st)
+
+		e, err = NewPipeline("view", NewSources(podGVK), config, logger)
+		Expect(err).NotTo(HaveOccurred())
+		p = e.(StatefulEvaluator)
+		Expect(p.SetState(st)).NotTo(HaveOccurred())
+
+		deltas, err := p.Evaluate(cache.Delta{Type: cache.Deleted, Object: pod1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(deltas[0].Type).To(Equal(cache.Deleted))
+		Expect(deltas[0].Object.GetName()).To(Equal("pod1"))
+	})
+
+	It("should refuse to restore the state of a different pipeline", func() {
+		p := newStatefulPipeline(joinPipeline)
+		st, err := p.GetState()
+		Expect(err).NotTo(HaveOccurred())
+
+		p = newStatefulPipeline(`
+'@join':
+  '@eq': [$.dep.metadata.name, $.pod.spec.parent]`)
+		Expect(p.SetState(st)).To(HaveOccurred())
+	})
+})
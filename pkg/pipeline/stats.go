@@ -0,0 +1,101 @@
+package pipeline
+
+import (
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/object"
+)
+
+var _ StatsEvaluator = &Pipeline{}
+var _ StatsEvaluator = &Chain{}
+var _ StoreEvaluator = &Pipeline{}
+var _ StoreEvaluator = &Chain{}
+
+// The internal stores of the engine.
+const (
+	// ObjectStore stores the objects of the base views.
+	ObjectStore = "objects"
+	// LookupStore stores the objects of the resources used in @lookup stages.
+	LookupStore = "lookups"
+	// GroupStore stores the groups of @count and @distinct stages.
+	GroupStore = "groups"
+)
+
+// StatsEvaluator is an evaluator that can report the size of its internal stores.
+type StatsEvaluator interface {
+	Evaluator
+	// GetStoreSizes returns the number of entries in each internal store of the evaluator,
+	// summed over all pipeline steps.
+	GetStoreSizes() map[string]int
+}
+
+// StoreEvaluator is an evaluator that can tell whether an object is in its internal stores.
+type StoreEvaluator interface {
+	Evaluator
+	// HasObject returns true if the object, given by the GVK, the namespace and the name, is in
+	// the internal stores of the evaluator, i.e., the evaluator has seen the object. The second
+	// return value is false if the evaluator cannot tell because it does not store the objects.
+	HasObject(obj object.Object) (bool, bool)
+}
+
+// GetStoreSizes returns the number of entries in the internal stores of the pipeline.
+func (p *Pipeline) GetStoreSizes() map[string]int {
+	return p.engine.StoreSizes()
+}
+
+// GetStoreSizes returns the number of entries in the internal stores of all steps of the chain.
+func (c *Chain) GetStoreSizes() map[string]int {
+	ret := map[string]int{}
+	for _, step := range c.steps {
+		for store, n := range step.engine.StoreSizes() {
+			ret[store] += n
+		}
+	}
+	return ret
+}
+
+// StoreSizes returns the number of entries in the internal stores of the engine.
+func (eng *defaultEngine) StoreSizes() map[string]int {
+	ret := map[string]int{ObjectStore: 0, LookupStore: 0, GroupStore: len(eng.groups)}
+	for _, s := range eng.baseViewStore {
+		ret[ObjectStore] += len(s.ListKeys())
+	}
+	for _, s := range eng.lookupStore {
+		ret[LookupStore] += len(s.ListKeys())
+	}
+	return ret
+}
+
+// HasObject returns true if the object is in the internal stores of the pipeline. Pipelines with
+// no join and no aggregation pass the objects through without storing them.
+func (p *Pipeline) HasObject(obj object.Object) (bool, bool) {
+	if p.Join == nil && p.Aggregation == nil {
+		return false, false
+	}
+	return p.engine.HasObject(obj), true
+}
+
+// HasObject returns true if the object is in the internal stores of any step of the chain.
+func (c *Chain) HasObject(obj object.Object) (bool, bool) {
+	ok := false
+	for _, step := range c.steps {
+		exists, stored := step.HasObject(obj)
+		if exists {
+			return true, true
+		}
+		ok = ok || stored
+	}
+	return false, ok
+}
+
+// HasObject returns true if the object is in the internal stores of the engine.
+func (eng *defaultEngine) HasObject(obj object.Object) bool {
+	g := obj.GetObjectKind().GroupVersionKind()
+	for _, stores := range []map[gvk]*cache.Store{eng.baseViewStore, eng.lookupStore} {
+		if s, ok := stores[g]; ok {
+			if _, exists, err := s.Store.Get(obj); err == nil && exists {
+				return true
+			}
+		}
+	}
+	return false
+}
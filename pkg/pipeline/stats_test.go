@@ -0,0 +1,49 @@
+package pipeline
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/yaml"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	viewv1a1 "hsnlab/dcontroller/pkg/api/view/v1alpha1"
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/object"
+)
+
+var _ = Describe("Store sizes", func() {
+	var podGVK, depGVK = viewv1a1.GroupVersion.WithKind("pod"), viewv1a1.GroupVersion.WithKind("dep")
+
+	It("should report the number of entries in the engine stores", func() {
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(`
+'@join':
+  '@eq': [$.dep.metadata.name, $.pod.spec.parent]
+'@aggregate':
+  - '@project':
+      metadata:
+        name: $.pod.metadata.name
+        namespace: $.pod.metadata.namespace`), &config)).NotTo(HaveOccurred())
+		e, err := NewPipeline("view", NewSources(podGVK, depGVK), config, logger)
+		Expect(err).NotTo(HaveOccurred())
+		p, ok := e.(StatsEvaluator)
+		Expect(ok).To(BeTrue())
+		Expect(p.GetStoreSizes()).To(Equal(map[string]int{ObjectStore: 0, LookupStore: 0, GroupStore: 0}))
+
+		pod := object.NewViewObject("pod")
+		object.SetContent(pod, unstruct{"spec": unstruct{"parent": "dep1"}})
+		object.SetName(pod, "default", "pod1")
+		dep := object.NewViewObject("dep")
+		object.SetName(dep, "default", "dep1")
+		for _, obj := range []object.Object{pod, dep} {
+			_, err := e.Evaluate(cache.Delta{Type: cache.Added, Object: obj})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		// the base objects and the join row
+		Expect(p.GetStoreSizes()).To(HaveKeyWithValue(ObjectStore, 3))
+
+		_, err = e.Evaluate(cache.Delta{Type: cache.Deleted, Object: pod})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.GetStoreSizes()).To(HaveKeyWithValue(ObjectStore, 1))
+	})
+})
@@ -0,0 +1,158 @@
+package pipeline
+
+import (
+	"time"
+
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/expression"
+)
+
+// TracingEvaluator is an evaluator that can record a trace of the evaluation of a delta.
+type TracingEvaluator interface {
+	Evaluator
+	EvaluateWithTrace(cache.Delta) ([]cache.Delta, *Trace, error)
+}
+
+// Trace is a structured record of the evaluation of a pipeline on a single input delta.
+type Trace struct {
+	// Time is the time the evaluation started.
+	Time time.Time `json:"time"`
+	// Input is the input delta.
+	Input TraceDelta `json:"input"`
+	// Stages is the list of the stages evaluated, in the order of evaluation.
+	Stages []*TraceStage `json:"stages"`
+	// Result is the list of the output deltas.
+	Result []TraceDelta `json:"result"`
+	// Error is the error returned from the evaluation, if any.
+	Error string `json:"error,omitempty"`
+
+	current *TraceStage
+}
+
+// TraceDelta is a delta in a trace.
+type TraceDelta struct {
+	Type   cache.DeltaType `json:"type"`
+	Object any             `json:"object,omitempty"`
+}
+
+// TraceStage is the record of the evaluation of a single pipeline stage on a single object.
+type TraceStage struct {
+	// View is the target view of the engine that evaluated the stage.
+	View string `json:"view"`
+	// Stage is the name of the stage, e.g., "@join" or "@select".
+	Stage string `json:"stage"`
+	// Input is the input document of the stage.
+	Input any `json:"input,omitempty"`
+	// Output is the output of the stage.
+	Output any `json:"output,omitempty"`
+	// Expressions lists the value of each sub-expression evaluated in the stage.
+	Expressions []TraceExpression `json:"expressions,omitempty"`
+	// Dropped is the reason why the stage dropped the object, if it did.
+	Dropped string `json:"dropped,omitempty"`
+	// Error is the error returned by the stage, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// TraceExpression is the value of an expression evaluated in a stage.
+type TraceExpression struct {
+	Expression string `json:"expression"`
+	Result     any    `json:"result"`
+}
+
+// NewTrace creates a new trace for an input delta.
+func NewTrace(delta cache.Delta) *Trace {
+	return &Trace{
+		Time:   time.Now(),
+		Input:  newTraceDelta(delta),
+		Stages: []*TraceStage{},
+		Result: []TraceDelta{},
+	}
+}
+
+// Finish records the result of the evaluation in the trace.
+func (t *Trace) Finish(res []cache.Delta, err error) {
+	for _, d := range res {
+		t.Result = append(t.Result, newTraceDelta(d))
+	}
+	if err != nil {
+		t.Error = err.Error()
+	}
+	t.current = nil
+}
+
+func newTraceDelta(delta cache.Delta) TraceDelta {
+	ret := TraceDelta{Type: delta.Type}
+	if delta.Object != nil {
+		ret.Object = traceCopy(delta.Object.UnstructuredContent())
+	}
+	return ret
+}
+
+// traceStart opens a new stage in the trace: expressions evaluated until the stage is closed
+// are recorded in the stage.
+func (eng *defaultEngine) traceStart(stage string, input any) {
+	if eng.trace == nil {
+		return
+	}
+	st := &TraceStage{View: eng.targetView, Stage: stage, Input: traceCopy(input)}
+	eng.trace.Stages = append(eng.trace.Stages, st)
+	eng.trace.current = st
+}
+
+// traceEnd closes the current stage.
+func (eng *defaultEngine) traceEnd(output any, dropped string, err error) {
+	if eng.trace == nil || eng.trace.current == nil {
+		return
+	}
+	st := eng.trace.current
+	st.Output = traceCopy(output)
+	st.Dropped = dropped
+	if err != nil {
+		st.Error = err.Error()
+	}
+	eng.trace.current = nil
+}
+
+// traceDrop records that an object was dropped for the given reason.
+func (eng *defaultEngine) traceDrop(stage string, input any, reason string) {
+	eng.traceStart(stage, input)
+	eng.traceEnd(nil, reason, nil)
+}
+
+// traceExpression records the result of an expression evaluated in the current stage.
+func (eng *defaultEngine) traceExpression(e *expression.Expression, result any) {
+	if eng.trace == nil || eng.trace.current == nil {
+		return
+	}
+	eng.trace.current.Expressions = append(eng.trace.current.Expressions,
+		TraceExpression{Expression: e.String(), Result: traceCopy(result)})
+}
+
+// Trace sets the trace to record the evaluation into, or stops tracing if the trace is nil.
+func (eng *defaultEngine) Trace(t *Trace) { eng.trace = t }
+
+// traceCopy deep-copies maps and lists so that the trace is not affected by later modifications.
+func traceCopy(v any) any {
+	switch x := v.(type) {
+	case map[string]any:
+		ret := make(map[string]any, len(x))
+		for k, e := range x {
+			ret[k] = traceCopy(e)
+		}
+		return ret
+	case []any:
+		ret := make([]any, len(x))
+		for i, e := range x {
+			ret[i] = traceCopy(e)
+		}
+		return ret
+	case []unstruct:
+		ret := make([]any, len(x))
+		for i, e := range x {
+			ret[i] = traceCopy(e)
+		}
+		return ret
+	default:
+		return v
+	}
+}
@@ -0,0 +1,135 @@
+package pipeline
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/json"
+	"sigs.k8s.io/yaml"
+
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	viewv1a1 "hsnlab/dcontroller/pkg/api/view/v1alpha1"
+	"hsnlab/dcontroller/pkg/cache"
+	"hsnlab/dcontroller/pkg/object"
+)
+
+var _ = Describe("Traces", func() {
+	var pod1, dep1 object.Object
+	var podGVK, depGVK = viewv1a1.GroupVersion.WithKind("pod"), viewv1a1.GroupVersion.WithKind("dep")
+
+	newTracingPipeline := func(sources []Source, data string) TracingEvaluator {
+		var config opv1a1.Pipeline
+		Expect(yaml.Unmarshal([]byte(data), &config)).NotTo(HaveOccurred())
+		p, err := NewPipeline("view", sources, config, logger)
+		Expect(err).NotTo(HaveOccurred())
+		t, ok := p.(TracingEvaluator)
+		Expect(ok).To(BeTrue())
+		return t
+	}
+
+	BeforeEach(func() {
+		pod1 = object.NewViewObject("pod")
+		object.SetContent(pod1, unstruct{"spec": unstruct{"parent": "dep1"}})
+		object.SetName(pod1, "default", "pod1")
+		dep1 = object.NewViewObject("dep")
+		object.SetName(dep1, "default", "dep1")
+	})
+
+	It("should record the stages and the expressions of an aggregation", func() {
+		p := newTracingPipeline(NewSources(podGVK), `
+'@aggregate':
+  - '@project':
+      metadata: $.metadata
+      parent: $.spec.parent
+  - '@select':
+      '@eq': [$.parent, dep2]`)
+
+		deltas, t, err := p.EvaluateWithTrace(cache.Delta{Type: cache.Added, Object: pod1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(BeEmpty())
+
+		Expect(t.Input.Type).To(Equal(cache.Added))
+		Expect(t.Input.Object).To(Equal(pod1.UnstructuredContent()))
+		Expect(t.Result).To(BeEmpty())
+		Expect(t.Error).To(BeEmpty())
+
+		Expect(t.Stages).To(HaveLen(2))
+		Expect(t.Stages[0].Stage).To(Equal("@project"))
+		Expect(t.Stages[0].View).To(Equal("view"))
+		Expect(t.Stages[0].Dropped).To(BeEmpty())
+		Expect(t.Stages[0].Output).To(Equal([]any{unstruct{
+			"metadata": unstruct{"name": "pod1", "namespace": "default"},
+			"parent":   "dep1",
+		}}))
+
+		Expect(t.Stages[1].Stage).To(Equal("@select"))
+		Expect(t.Stages[1].Dropped).To(Equal("@select condition evaluated to false"))
+		Expect(t.Stages[1].Expressions).To(ContainElement(TraceExpression{
+			Expression: `"$.parent"`, Result: "dep1",
+		}))
+		Expect(t.Stages[1].Expressions).To(ContainElement(HaveField("Result", false)))
+
+		// the trace can be serialized
+		_, err = json.Marshal(t)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should explain why a join dropped an object", func() {
+		p := newTracingPipeline(NewSources(podGVK, depGVK), `
+'@join':
+  '@eq': [$.dep.metadata.name, $.pod.spec.parent]`)
+
+		deltas, t, err := p.EvaluateWithTrace(cache.Delta{Type: cache.Added, Object: pod1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(BeEmpty())
+		Expect(t.Stages).To(HaveLen(1))
+		Expect(t.Stages[0].Stage).To(Equal("@join"))
+		Expect(t.Stages[0].Dropped).To(Equal("join condition evaluated to false (no objects yet in dep)"))
+
+		deltas, t, err = p.EvaluateWithTrace(cache.Delta{Type: cache.Added, Object: dep1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(t.Stages).To(HaveLen(1))
+		Expect(t.Stages[0].Dropped).To(BeEmpty())
+		Expect(t.Result).To(HaveLen(1))
+		Expect(t.Result[0].Type).To(Equal(cache.Added))
+	})
+
+	It("should record duplicate events", func() {
+		p := newTracingPipeline(NewSources(podGVK), `
+'@aggregate':
+  - '@project':
+      metadata: $.metadata`)
+
+		_, err := p.Evaluate(cache.Delta{Type: cache.Added, Object: pod1})
+		Expect(err).NotTo(HaveOccurred())
+
+		deltas, t, err := p.EvaluateWithTrace(cache.Delta{Type: cache.Updated, Object: pod1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(BeEmpty())
+		Expect(t.Stages).To(HaveLen(1))
+		Expect(t.Stages[0].Stage).To(Equal("input"))
+		Expect(t.Stages[0].Dropped).To(Equal("duplicate event: the object is unchanged"))
+	})
+
+	It("should trace all steps of a chain", func() {
+		p := newTracingPipeline(NewSources(podGVK), `
+'@steps':
+  - name: parents
+    '@aggregate':
+      - '@project':
+          metadata: $.metadata
+          parent: $.spec.parent
+  - '@aggregate':
+      - '@select':
+          '@eq': [$.parent, dep1]`)
+
+		deltas, t, err := p.EvaluateWithTrace(cache.Delta{Type: cache.Added, Object: pod1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deltas).To(HaveLen(1))
+		Expect(t.Stages).To(HaveLen(2))
+		Expect(t.Stages[0].View).To(Equal("parents"))
+		Expect(t.Stages[1].View).To(Equal("view"))
+		Expect(t.Stages[1].Stage).To(Equal("@select"))
+		Expect(t.Result).To(HaveLen(1))
+	})
+})
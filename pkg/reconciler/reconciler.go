@@ -15,6 +15,10 @@ import (
 	"hsnlab/dcontroller/pkg/util"
 )
 
+// Request is a reconcile request for an object. Requests are used as work queue keys so that
+// repeated events on the same object are deduplicated: requests carry only the identity of the
+// object and the event type. The previous version of the object in Updated events is taken from
+// the pipeline's own copy.
 type Request struct {
 	Namespace, Name string
 	EventType       cache.DeltaType
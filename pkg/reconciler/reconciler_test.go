@@ -305,7 +305,7 @@ var _ = Describe("Reconciler", func() {
 			Expect(mgr).NotTo(BeNil())
 
 			// Register source
-			target := NewTarget(mgr, opv1a1.Target{Resource: opv1a1.Resource{Kind: "view"}})
+			target := NewTarget(mgr, opv1a1.Target{Resource: opv1a1.Resource{Kind: "view"}}, TargetOptions{})
 
 			// Start the manager
 			go func() { mgr.Start(ctx) }()
@@ -369,7 +369,7 @@ var _ = Describe("Reconciler", func() {
 					Version: &version,
 					Kind:    "Pod",
 				},
-			})
+			}, TargetOptions{})
 
 			// Push a view object to the target
 			err = target.Write(ctx, cache.Delta{Type: cache.Added, Object: pod2})
@@ -444,6 +444,43 @@ var _ = Describe("Reconciler", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 
+		It("should resolve the owner references of native objects written to Updater targets", func() {
+			cm := object.New()
+			cm.SetGroupVersionKind(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"})
+			object.SetName(cm, "testns", "owner")
+			cm.SetUID(types.UID("owner-uid"))
+			mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger}, cm)
+			Expect(err).NotTo(HaveOccurred())
+
+			group, version := "", "v1"
+			target := NewTarget(mgr, opv1a1.Target{
+				Resource: opv1a1.Resource{Group: &group, Version: &version, Kind: "Pod"},
+			}, TargetOptions{})
+
+			// an explicit owner reference without a UID
+			pod := object.DeepCopy(pod2)
+			on := true
+			pod.SetOwnerReferences([]metav1.OwnerReference{{
+				APIVersion: "v1", Kind: "ConfigMap", Name: "owner",
+				Controller: &on, BlockOwnerDeletion: &on,
+			}})
+			Expect(target.Write(ctx, cache.Delta{Type: cache.Added, Object: pod})).To(Succeed())
+
+			getFromTracker, err := mgr.GetObjectTracker().Get(schema.GroupVersionResource{
+				Version: "v1", Resource: "pods"}, "testns", "testpod")
+			Expect(err).NotTo(HaveOccurred())
+			p, ok := getFromTracker.(*corev1.Pod)
+			Expect(ok).To(BeTrue())
+			Expect(p.GetOwnerReferences()).To(Equal([]metav1.OwnerReference{{
+				APIVersion: "v1", Kind: "ConfigMap", Name: "owner", UID: types.UID("owner-uid"),
+				Controller: &on, BlockOwnerDeletion: &on,
+			}}))
+
+			// a missing owner is an error
+			pod.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "v1", Kind: "ConfigMap", Name: "missing"}})
+			Expect(target.Write(ctx, cache.Delta{Type: cache.Updated, Object: pod})).NotTo(Succeed())
+		})
+
 		It("should be able to write view objects to Patch targets", func() {
 			// Start manager and push a native object into the runtime client fake
 			mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger})
@@ -451,7 +488,7 @@ var _ = Describe("Reconciler", func() {
 			Expect(mgr).NotTo(BeNil())
 
 			// Register source
-			target := NewTarget(mgr, opv1a1.Target{Resource: opv1a1.Resource{Kind: "view"}, Type: "Patcher"})
+			target := NewTarget(mgr, opv1a1.Target{Resource: opv1a1.Resource{Kind: "view"}, Type: "Patcher"}, TargetOptions{})
 
 			// Start the manager
 			// go mgr.Start(ctx) // will stop with a context cancelled erro
@@ -489,7 +526,7 @@ var _ = Describe("Reconciler", func() {
 			// object.SetContent(res, map[string]any{"b": int64(2)})
 			Expect(event.Object.(object.Object)).To(Equal(res))
 
-			// Push a delete to the target
+			// Push a delete to the target: only the fields of the last patch are removed
 			view2 = object.DeepCopy(view)
 			object.SetContent(view2, map[string]any{"a": int64(1)})
 			err = target.Write(ctx, cache.Delta{Type: cache.Deleted, Object: view2})
@@ -500,7 +537,7 @@ var _ = Describe("Reconciler", func() {
 			Expect(event.Type).To(Equal(watch.Modified))
 			res = view.DeepCopy()
 			object.SetName(res, "default", "viewname")
-			object.SetContent(res, map[string]any{"b": int64(2)})
+			object.SetContent(res, map[string]any{"a": int64(1)})
 			Expect(event.Object).To(Equal(res))
 
 			// Get should not fail now
@@ -509,6 +546,178 @@ var _ = Describe("Reconciler", func() {
 			Expect(res).To(Equal(res2))
 		})
 
+		It("should be able to write view objects to Applier targets", func() {
+			mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mgr).NotTo(BeNil())
+
+			target := NewTarget(mgr, opv1a1.Target{Resource: opv1a1.Resource{Kind: "view"}, Type: "Applier"},
+				TargetOptions{FieldManager: "test"})
+			go func() { mgr.Start(ctx) }()
+
+			vcache := mgr.GetCompositeCache().GetViewCache()
+			Expect(vcache).NotTo(BeNil())
+			watcher, err := vcache.Watch(ctx, object.NewViewObjectList("view"))
+			Expect(err).NotTo(HaveOccurred())
+
+			// Apply creates the object
+			err = target.Write(ctx, cache.Delta{Type: cache.Added, Object: view})
+			Expect(err).NotTo(HaveOccurred())
+
+			event, ok := tryWatchWatcher(watcher, interval)
+			Expect(ok).To(BeTrue())
+			Expect(event.Type).To(Equal(watch.Added))
+			Expect(object.DeepEqual(view, event.Object.(object.Object))).To(BeTrue())
+
+			// Apply merges into the object
+			view2 := object.DeepCopy(view)
+			object.SetContent(view2, map[string]any{"b": int64(2)})
+			err = target.Write(ctx, cache.Delta{Type: cache.Updated, Object: view2})
+			Expect(err).NotTo(HaveOccurred())
+
+			event, ok = tryWatchWatcher(watcher, interval)
+			Expect(ok).To(BeTrue())
+			Expect(event.Type).To(Equal(watch.Modified))
+			res := view.DeepCopy()
+			object.SetContent(res, map[string]any{"a": int64(1), "b": int64(2)})
+			Expect(event.Object.(object.Object)).To(Equal(res))
+
+			// Delete removes the fields
+			err = target.Write(ctx, cache.Delta{Type: cache.Deleted, Object: view2})
+			Expect(err).NotTo(HaveOccurred())
+
+			event, ok = tryWatchWatcher(watcher, interval)
+			Expect(ok).To(BeTrue())
+			Expect(event.Type).To(Equal(watch.Modified))
+			Expect(event.Object.(object.Object)).To(Equal(view))
+		})
+
+		It("should be able to write the status of view objects to Updater targets", func() {
+			mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mgr).NotTo(BeNil())
+
+			target := NewTarget(mgr, opv1a1.Target{Resource: opv1a1.Resource{Kind: "view"},
+				Subresource: opv1a1.StatusSubresource}, TargetOptions{})
+			go func() { mgr.Start(ctx) }()
+
+			vcache := mgr.GetCompositeCache().GetViewCache()
+			Expect(vcache).NotTo(BeNil())
+
+			// the status can be written only to an existing object
+			Expect(vcache.Add(view)).NotTo(HaveOccurred())
+			watcher, err := vcache.Watch(ctx, object.NewViewObjectList("view"))
+			Expect(err).NotTo(HaveOccurred())
+			event, ok := tryWatchWatcher(watcher, interval)
+			Expect(ok).To(BeTrue())
+			Expect(event.Type).To(Equal(watch.Added))
+
+			// Only the status is written
+			view2 := object.DeepCopy(view)
+			object.SetContent(view2, map[string]any{"b": int64(2), "status": map[string]any{"ready": true}})
+			err = target.Write(ctx, cache.Delta{Type: cache.Added, Object: view2})
+			Expect(err).NotTo(HaveOccurred())
+
+			event, ok = tryWatchWatcher(watcher, interval)
+			Expect(ok).To(BeTrue())
+			Expect(event.Type).To(Equal(watch.Modified))
+			res := view.DeepCopy()
+			object.SetContent(res, map[string]any{"a": int64(1), "status": map[string]any{"ready": true}})
+			Expect(event.Object.(object.Object)).To(Equal(res))
+
+			// Delete removes the status but keeps the object
+			err = target.Write(ctx, cache.Delta{Type: cache.Deleted, Object: view2})
+			Expect(err).NotTo(HaveOccurred())
+
+			event, ok = tryWatchWatcher(watcher, interval)
+			Expect(ok).To(BeTrue())
+			Expect(event.Type).To(Equal(watch.Modified))
+			Expect(event.Object.(object.Object)).To(Equal(view))
+		})
+
+		It("should be able to write the status of view objects to Patcher targets", func() {
+			mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mgr).NotTo(BeNil())
+
+			target := NewTarget(mgr, opv1a1.Target{Resource: opv1a1.Resource{Kind: "view"}, Type: "Patcher",
+				Subresource: opv1a1.StatusSubresource}, TargetOptions{})
+			go func() { mgr.Start(ctx) }()
+
+			vcache := mgr.GetCompositeCache().GetViewCache()
+			Expect(vcache).NotTo(BeNil())
+
+			object.SetContent(view, map[string]any{"a": int64(1), "status": map[string]any{"x": "y"}})
+			Expect(vcache.Add(view)).NotTo(HaveOccurred())
+			watcher, err := vcache.Watch(ctx, object.NewViewObjectList("view"))
+			Expect(err).NotTo(HaveOccurred())
+			event, ok := tryWatchWatcher(watcher, interval)
+			Expect(ok).To(BeTrue())
+			Expect(event.Type).To(Equal(watch.Added))
+
+			// The status is patched, the rest of the patch is ignored
+			view2 := object.DeepCopy(view)
+			object.SetContent(view2, map[string]any{"b": int64(2), "status": map[string]any{"ready": true}})
+			err = target.Write(ctx, cache.Delta{Type: cache.Added, Object: view2})
+			Expect(err).NotTo(HaveOccurred())
+
+			event, ok = tryWatchWatcher(watcher, interval)
+			Expect(ok).To(BeTrue())
+			Expect(event.Type).To(Equal(watch.Modified))
+			res := view.DeepCopy()
+			object.SetContent(res, map[string]any{"a": int64(1), "status": map[string]any{"x": "y", "ready": true}})
+			Expect(event.Object.(object.Object)).To(Equal(res))
+
+			// Delete reverts the status patch
+			err = target.Write(ctx, cache.Delta{Type: cache.Deleted, Object: view2})
+			Expect(err).NotTo(HaveOccurred())
+
+			event, ok = tryWatchWatcher(watcher, interval)
+			Expect(ok).To(BeTrue())
+			Expect(event.Type).To(Equal(watch.Modified))
+			Expect(event.Object.(object.Object)).To(Equal(view))
+		})
+
+		It("should reject the status subresource in Applier targets", func() {
+			mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger})
+			Expect(err).NotTo(HaveOccurred())
+
+			target := NewTarget(mgr, opv1a1.Target{Resource: opv1a1.Resource{Kind: "view"}, Type: "Applier",
+				Subresource: opv1a1.StatusSubresource}, TargetOptions{FieldManager: "test"})
+			err = target.Write(ctx, cache.Delta{Type: cache.Added, Object: view})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should report the API verb of the writes", func() {
+			mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger})
+			Expect(err).NotTo(HaveOccurred())
+
+			group, version := "", "v1"
+			native := opv1a1.Resource{Group: &group, Version: &version, Kind: "Pod"}
+			view := opv1a1.Resource{Kind: "view"}
+			verbs := func(t opv1a1.Target) []string {
+				target := NewTarget(mgr, t, TargetOptions{})
+				ret := []string{}
+				for _, e := range []cache.DeltaType{cache.Added, cache.Updated, cache.Deleted} {
+					ret = append(ret, target.Verb(cache.Delta{Type: e}))
+				}
+				return ret
+			}
+
+			Expect(verbs(opv1a1.Target{Resource: native, Type: opv1a1.Updater})).
+				To(Equal([]string{"create", "update", "delete"}))
+			Expect(verbs(opv1a1.Target{Resource: native, Type: opv1a1.Updater,
+				Subresource: opv1a1.StatusSubresource})).To(Equal([]string{"update", "update", "update"}))
+			Expect(verbs(opv1a1.Target{Resource: native, Type: opv1a1.Patcher})).
+				To(Equal([]string{"patch", "patch", "patch"}))
+			Expect(verbs(opv1a1.Target{Resource: native, Type: opv1a1.Patcher,
+				Subresource: opv1a1.StatusSubresource})).To(Equal([]string{"patch", "patch", "patch"}))
+			Expect(verbs(opv1a1.Target{Resource: view, Type: opv1a1.Patcher})).
+				To(Equal([]string{"patch", "patch", "update"}))
+			Expect(verbs(opv1a1.Target{Resource: native, Type: opv1a1.Applier})).
+				To(Equal([]string{"apply", "apply", "apply"}))
+		})
+
 		It("should be able to write native objects to Patcher targets", func() {
 			mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger}, pod2)
 			Expect(err).NotTo(HaveOccurred())
@@ -523,7 +732,7 @@ var _ = Describe("Reconciler", func() {
 					Kind:    "Pod",
 				},
 				Type: "Patcher",
-			})
+			}, TargetOptions{})
 
 			// Object should already be registered in the runtime cache client
 			c := mgr.GetClient()
@@ -569,7 +778,15 @@ var _ = Describe("Reconciler", func() {
 			Expect(p.Spec.Containers[0].Image).To(Equal("nginx"))
 			Expect(p.Spec.RestartPolicy).To(Equal(corev1.RestartPolicy("Always")))
 
-			// Delete patch to the target
+			// the fake runtime cache does not follow the object tracker
+			content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(p)
+			Expect(err).NotTo(HaveOccurred())
+			patched := &unstructured.Unstructured{Object: content}
+			patched.SetGroupVersionKind(pod2.GroupVersionKind())
+			Expect(patched.GetAnnotations()).To(HaveKey(LastPatchAnnotation))
+			Expect(mgr.GetRuntimeCache().Update(pod2, patched)).To(Succeed())
+
+			// Delete patch to the target: only the fields set by the last patch are removed
 			newPod = object.DeepCopy(pod2)
 
 			unstructured.SetNestedField(newPod.UnstructuredContent(), nil, "spec", "restartPolicy")
@@ -597,7 +814,189 @@ var _ = Describe("Reconciler", func() {
 			Expect(p.Spec.Containers).To(HaveLen(1))
 			Expect(p.Spec.Containers[0].Name).To(Equal("nginx"))
 			Expect(p.Spec.Containers[0].Image).To(Equal("nginx"))
-			Expect(p.Spec.RestartPolicy).To(Equal(corev1.RestartPolicy("")))
+			// the value overwritten by the patch is restored
+			Expect(p.Spec.RestartPolicy).To(Equal(corev1.RestartPolicy("OnFailure")))
+			Expect(p.GetAnnotations()).NotTo(HaveKey(LastPatchAnnotation))
+		})
+
+		It("should revert only the last patch in native Patcher targets", func() {
+			mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger}, pod2)
+			Expect(err).NotTo(HaveOccurred())
+
+			group, version := "", "v1"
+			target := NewTarget(mgr, opv1a1.Target{
+				Resource: opv1a1.Resource{
+					Group:   &group,
+					Version: &version,
+					Kind:    "Pod",
+				},
+				Type: "Patcher",
+			}, TargetOptions{})
+
+			gvr := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}
+			tracker := mgr.GetObjectTracker()
+			getPod := func() *corev1.Pod {
+				obj, err := tracker.Get(gvr, "testns", "testpod")
+				Expect(err).NotTo(HaveOccurred())
+				p, ok := obj.(*corev1.Pod)
+				Expect(ok).To(BeTrue())
+				return p
+			}
+
+			// add a container and an annotation
+			newPod := object.New()
+			newPod.SetGroupVersionKind(pod2.GroupVersionKind())
+			object.SetName(newPod, "testns", "testpod")
+			newPod.SetAnnotations(map[string]string{"test": "a"})
+			Expect(unstructured.SetNestedSlice(newPod.UnstructuredContent(), []any{
+				map[string]any{"name": "sidecar", "image": "busybox"},
+			}, "spec", "containers")).To(Succeed())
+			err = target.Write(ctx, cache.Delta{Type: cache.Added, Object: newPod})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getPod().Spec.Containers).To(HaveLen(2))
+
+			// someone else modifies the annotation
+			p := getPod()
+			p.Annotations["test"] = "b"
+			Expect(tracker.Update(gvr, p, "testns")).To(Succeed())
+
+			// the fake runtime cache does not follow the object tracker
+			content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(p)
+			Expect(err).NotTo(HaveOccurred())
+			patched := &unstructured.Unstructured{Object: content}
+			patched.SetGroupVersionKind(pod2.GroupVersionKind())
+			Expect(mgr.GetRuntimeCache().Update(pod2, patched)).To(Succeed())
+
+			err = target.Write(ctx, cache.Delta{Type: cache.Deleted, Object: newPod})
+			Expect(err).NotTo(HaveOccurred())
+
+			p = getPod()
+			Expect(p.Spec.Containers).To(HaveLen(1))
+			Expect(p.Spec.Containers[0].Name).To(Equal("nginx"))
+			Expect(p.GetAnnotations()).To(Equal(map[string]string{"test": "b"}))
+		})
+
+		It("should revert the fields dropped from the last patch in native Patcher targets", func() {
+			mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger}, pod2)
+			Expect(err).NotTo(HaveOccurred())
+
+			group, version := "", "v1"
+			target := NewTarget(mgr, opv1a1.Target{
+				Resource: opv1a1.Resource{
+					Group:   &group,
+					Version: &version,
+					Kind:    "Pod",
+				},
+				Type: "Patcher",
+			}, TargetOptions{})
+
+			gvr := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}
+			tracker := mgr.GetObjectTracker()
+			getPod := func() *corev1.Pod {
+				obj, err := tracker.Get(gvr, "testns", "testpod")
+				Expect(err).NotTo(HaveOccurred())
+				p, ok := obj.(*corev1.Pod)
+				Expect(ok).To(BeTrue())
+
+				// the fake runtime cache does not follow the object tracker
+				content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(p)
+				Expect(err).NotTo(HaveOccurred())
+				patched := &unstructured.Unstructured{Object: content}
+				patched.SetGroupVersionKind(pod2.GroupVersionKind())
+				Expect(mgr.GetRuntimeCache().Update(pod2, patched)).To(Succeed())
+
+				return p
+			}
+
+			// add a container and override the restart policy
+			newPod := object.New()
+			newPod.SetGroupVersionKind(pod2.GroupVersionKind())
+			object.SetName(newPod, "testns", "testpod")
+			Expect(unstructured.SetNestedSlice(newPod.UnstructuredContent(), []any{
+				map[string]any{"name": "sidecar", "image": "busybox"},
+			}, "spec", "containers")).To(Succeed())
+			Expect(unstructured.SetNestedField(newPod.UnstructuredContent(), "Always",
+				"spec", "restartPolicy")).To(Succeed())
+			err = target.Write(ctx, cache.Delta{Type: cache.Added, Object: newPod})
+			Expect(err).NotTo(HaveOccurred())
+			p := getPod()
+			Expect(p.Spec.Containers).To(HaveLen(2))
+			Expect(p.Spec.RestartPolicy).To(Equal(corev1.RestartPolicyAlways))
+
+			// the next patch sets the hostname only
+			newPod = object.New()
+			newPod.SetGroupVersionKind(pod2.GroupVersionKind())
+			object.SetName(newPod, "testns", "testpod")
+			Expect(unstructured.SetNestedField(newPod.UnstructuredContent(), "host",
+				"spec", "hostname")).To(Succeed())
+			err = target.Write(ctx, cache.Delta{Type: cache.Updated, Object: newPod})
+			Expect(err).NotTo(HaveOccurred())
+			p = getPod()
+			Expect(p.Spec.Containers).To(HaveLen(1))
+			Expect(p.Spec.Containers[0].Name).To(Equal("nginx"))
+			Expect(p.Spec.RestartPolicy).To(Equal(corev1.RestartPolicyOnFailure))
+			Expect(p.Spec.Hostname).To(Equal("host"))
+
+			// reverting the last patch leaves the original object
+			err = target.Write(ctx, cache.Delta{Type: cache.Deleted, Object: newPod})
+			Expect(err).NotTo(HaveOccurred())
+			p = getPod()
+			Expect(p.Spec.Containers).To(HaveLen(1))
+			Expect(p.Spec.RestartPolicy).To(Equal(corev1.RestartPolicyOnFailure))
+			Expect(p.Spec.Hostname).To(BeEmpty())
+			Expect(p.GetAnnotations()).NotTo(HaveKey(LastPatchAnnotation))
+		})
+
+		It("should merge lists by the merge key in native Patcher targets", func() {
+			Expect(unstructured.SetNestedSlice(pod2.UnstructuredContent(), []any{
+				map[string]any{"name": "nginx", "image": "nginx", "ports": []any{
+					map[string]any{"containerPort": int64(80)},
+				}},
+				map[string]any{"name": "sidecar", "image": "busybox"},
+			}, "spec", "containers")).To(Succeed())
+
+			mgr, err := manager.NewFakeManager(runtimeManager.Options{Logger: logger}, pod2)
+			Expect(err).NotTo(HaveOccurred())
+
+			group, version := "", "v1"
+			target := NewTarget(mgr, opv1a1.Target{
+				Resource: opv1a1.Resource{
+					Group:   &group,
+					Version: &version,
+					Kind:    "Pod",
+				},
+				Type: "Patcher",
+			}, TargetOptions{})
+
+			// patch the env and a new port into the first container
+			newPod := object.DeepCopy(pod2)
+			Expect(unstructured.SetNestedSlice(newPod.UnstructuredContent(), []any{
+				map[string]any{
+					"name":  "nginx",
+					"env":   []any{map[string]any{"name": "KEY", "value": "value"}},
+					"ports": []any{map[string]any{"containerPort": int64(443)}},
+				},
+			}, "spec", "containers")).To(Succeed())
+			err = target.Write(ctx, cache.Delta{Type: cache.Updated, Object: newPod})
+			Expect(err).NotTo(HaveOccurred())
+
+			getFromTracker, err := mgr.GetObjectTracker().Get(schema.GroupVersionResource{
+				Group:    "",
+				Version:  "v1",
+				Resource: "pods",
+			}, "testns", "testpod")
+			Expect(err).NotTo(HaveOccurred())
+			p, ok := getFromTracker.(*corev1.Pod)
+			Expect(ok).To(BeTrue())
+			Expect(p.Spec.Containers).To(HaveLen(2))
+			Expect(p.Spec.Containers[0].Name).To(Equal("nginx"))
+			Expect(p.Spec.Containers[0].Image).To(Equal("nginx"))
+			Expect(p.Spec.Containers[0].Env).To(Equal([]corev1.EnvVar{{Name: "KEY", Value: "value"}}))
+			Expect(p.Spec.Containers[0].Ports).To(Equal([]corev1.ContainerPort{
+				{ContainerPort: 443}, {ContainerPort: 80},
+			}))
+			Expect(p.Spec.Containers[1].Name).To(Equal("sidecar"))
+			Expect(p.Spec.Containers[1].Image).To(Equal("busybox"))
 		})
 	})
 })
@@ -4,14 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/go-logr/logr"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	runtimeManager "sigs.k8s.io/controller-runtime/pkg/manager"
 	runtimePredicate "sigs.k8s.io/controller-runtime/pkg/predicate"
 	runtimeSource "sigs.k8s.io/controller-runtime/pkg/source"
@@ -98,6 +102,8 @@ func (r *resource) getGVKByGroupKind(gr schema.GroupKind) (schema.GroupVersionKi
 type Source interface {
 	Resource
 	GetSource() (runtimeSource.TypedSource[Request], error)
+	// List returns the current objects of the source, filtered the same way as the watch events.
+	List(ctx context.Context) ([]object.Object, error)
 	fmt.Stringer
 }
 
@@ -134,6 +140,66 @@ func (s *source) GetSource() (runtimeSource.TypedSource[Request], error) {
 	obj.GetObjectKind().SetGroupVersionKind(gvk)
 
 	// prepare the predicate
+	ps, err := s.predicates()
+	if err != nil {
+		return nil, err
+	}
+
+	// generic handler
+	src := runtimeSource.TypedKind(s.mgr.GetCache(), obj, EventHandler[client.Object]{}, ps...)
+
+	s.log.V(4).Info("watch source: ready", "GVK", gvk.String(), "predicate-num", len(ps))
+
+	return src, nil
+}
+
+// List returns the current objects of the source from the cache. Objects are filtered using the
+// namespace, the label selector and the predicate of the source, in the latter case as if the
+// object has just been created.
+func (s *source) List(ctx context.Context) ([]object.Object, error) {
+	gvk, err := s.GetGVK()
+	if err != nil {
+		return nil, err
+	}
+
+	ps, err := s.predicates()
+	if err != nil {
+		return nil, err
+	}
+
+	list := &unstructured.UnstructuredList{}
+	if gvk.Group == viewv1a1.GroupVersion.Group {
+		list.SetGroupVersionKind(gvk)
+	} else {
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	}
+
+	if err := s.mgr.GetClient().List(ctx, list); err != nil {
+		return nil, err
+	}
+
+	ret := []object.Object{}
+	for i := range list.Items {
+		obj := &list.Items[i]
+		obj.SetGroupVersionKind(gvk)
+		keep := true
+		for _, p := range ps {
+			if !p.Create(event.TypedCreateEvent[client.Object]{Object: obj}) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			ret = append(ret, obj)
+		}
+	}
+
+	s.log.V(4).Info("list source: ready", "GVK", gvk.String(), "objects", len(ret))
+
+	return ret, nil
+}
+
+func (s *source) predicates() ([]runtimePredicate.TypedPredicate[client.Object], error) {
 	ps := []runtimePredicate.TypedPredicate[client.Object]{}
 	if s.source.Predicate != nil {
 		p, err := predicate.FromPredicate(*s.source.Predicate)
@@ -155,33 +221,56 @@ func (s *source) GetSource() (runtimeSource.TypedSource[Request], error) {
 		ps = append(ps, predicate.FromNamespace(*s.source.Namespace))
 	}
 
-	// generic handler
-	src := runtimeSource.TypedKind(s.mgr.GetCache(), obj, EventHandler[client.Object]{}, ps...)
-
-	s.log.V(4).Info("watch source: ready", "GVK", gvk.String(), "predicate-num", len(ps))
-
-	return src, nil
+	return ps, nil
 }
 
 // Target is a generic writer that knows how to create controller runtime objects in a target resource.
 type Target interface {
 	Resource
 	Write(context.Context, cache.Delta) error
+	// Verb returns the API verb the target uses to write a delta.
+	Verb(cache.Delta) string
 	fmt.Stringer
 }
 
+// TargetOptions are the options of a target.
+type TargetOptions struct {
+	// FieldManager is the field manager Applier targets use for server-side apply and the key
+	// Patcher targets record their last patch under. Default is DefaultFieldManager.
+	FieldManager string
+}
+
+// DefaultFieldManager is the default field manager for server-side apply.
+const DefaultFieldManager = "dcontroller"
+
+// LastPatchAnnotation is the annotation where Patcher targets record the last patch written by
+// each controller into a native target object, keyed by the field manager of the controller. This
+// is used to revert only the fields set by the controller when the object is deleted from the
+// output.
+const LastPatchAnnotation = "dcontroller.io/last-patch"
+
 type target struct {
 	Resource
-	mgr    runtimeManager.Manager
-	target opv1a1.Target
-	log    logr.Logger
+	mgr          runtimeManager.Manager
+	target       opv1a1.Target
+	fieldManager string
+	patchMeta    *object.PatchMetaResolver
+	localPatches map[client.ObjectKey]any
+	mu           sync.Mutex
+	log          logr.Logger
 }
 
-func NewTarget(mgr runtimeManager.Manager, t opv1a1.Target) Target {
+func NewTarget(mgr runtimeManager.Manager, t opv1a1.Target, opts TargetOptions) Target {
 	target := &target{
-		Resource: NewResource(mgr, t.Resource),
-		mgr:      mgr,
-		target:   t,
+		Resource:     NewResource(mgr, t.Resource),
+		mgr:          mgr,
+		target:       t,
+		fieldManager: opts.FieldManager,
+		patchMeta:    object.NewPatchMetaResolver(mgr.GetScheme(), mgr.GetRESTMapper(), mgr.GetAPIReader()),
+		localPatches: map[client.ObjectKey]any{},
+	}
+	if target.fieldManager == "" {
+		target.fieldManager = DefaultFieldManager
 	}
 
 	log := mgr.GetLogger().WithName("target").WithValues("name", target.Resource.String())
@@ -197,8 +286,19 @@ func (t *target) String() string {
 // Write enforces a delta on a target. The behavior depends on the target type:
 //   - For Updaters the delta is enforced as is to the target
 //   - For Patchers the delta object is applied as a strategic merge patch: for Add and Update
-//     deltas the target is patched with the delta object, while for Delete the delta object
-//     content is removed from the target using a strategic merge patch.
+//     deltas the target is patched with the delta object, merging lists using the merge keys of
+//     the target resource (e.g., containers by name), and the patch is recorded in the
+//     LastPatchAnnotation of the target (in memory for views). For Delete the recorded patch is
+//     reverted: the fields and the list elements set by the patch are removed, unless they were
+//     changed by someone else.
+//   - For Appliers the delta object is written with server-side apply: for Add and Update deltas
+//     the target is applied with the delta object, taking ownership of the fields, while for
+//     Delete the ownership of the fields is released by applying an empty object, which removes
+//     the fields not owned by other field managers.
+//
+// Updater and Patcher targets with the status subresource write only the status of the target,
+// which must already exist: Updaters overwrite the status and remove it on Delete, while Patchers
+// patch the status and revert the patch on Delete.
 func (t *target) Write(ctx context.Context, delta cache.Delta) error {
 	if delta.Object == nil {
 		return errors.New("write: empty object in delta")
@@ -216,16 +316,69 @@ func (t *target) Write(ctx context.Context, delta cache.Delta) error {
 	// make sure delta object gets the correct GVK applied
 	delta.Object.SetGroupVersionKind(gvk)
 
+	switch t.target.Subresource {
+	case "":
+	case opv1a1.StatusSubresource:
+		if t.target.Type == opv1a1.Applier {
+			return errors.New("the status subresource is not supported for Applier targets")
+		}
+	default:
+		return fmt.Errorf("unknown target subresource: %s", t.target.Subresource)
+	}
+
+	if delta.Type != cache.Deleted && gvk.Group != viewv1a1.GroupVersion.Group {
+		if err := t.resolveOwners(ctx, delta.Object); err != nil {
+			return err
+		}
+	}
+
 	switch t.target.Type {
 	case opv1a1.Updater, "":
+		if t.isStatus() {
+			return t.updateStatus(ctx, delta)
+		}
 		return t.update(ctx, delta)
 	case opv1a1.Patcher:
 		return t.patch(ctx, delta)
+	case opv1a1.Applier:
+		return t.apply(ctx, delta)
 	default:
 		return fmt.Errorf("unknown target type: %s", t.target.Type)
 	}
 }
 
+// Verb returns the API verb of the client call Write uses to write a delta:
+//   - Updaters create, update and delete the target, while status Updaters update the status
+//     both for writes and for deletes,
+//   - Patchers patch the target, except for reverting patches in views, which is an update,
+//   - Appliers apply the target both for writes and for deletes.
+//
+// Patchers reverting the fields dropped from the last patch issue an extra call before the patch,
+// which is not reported separately.
+func (t *target) Verb(delta cache.Delta) string {
+	switch t.target.Type {
+	case opv1a1.Applier:
+		return "apply"
+	case opv1a1.Patcher:
+		if gvk, err := t.GetGVK(); err == nil && delta.Type == cache.Deleted &&
+			gvk.Group == viewv1a1.GroupVersion.Group {
+			return "update"
+		}
+		return "patch"
+	default:
+		switch {
+		case t.isStatus():
+			return "update"
+		case delta.Type == cache.Added:
+			return "create"
+		case delta.Type == cache.Deleted:
+			return "delete"
+		default:
+			return "update"
+		}
+	}
+}
+
 func (t *target) update(ctx context.Context, delta cache.Delta) error {
 	c := t.mgr.GetClient()
 
@@ -246,6 +399,29 @@ func (t *target) update(ctx context.Context, delta cache.Delta) error {
 	}
 }
 
+// updateStatus writes the status of the delta object into the target, or removes the status of
+// the target on delete.
+func (t *target) updateStatus(ctx context.Context, delta cache.Delta) error {
+	c := t.mgr.GetClient()
+
+	//nolint:nolintlint
+	switch delta.Type { //nolint:exhaustive
+	case cache.Added, cache.Updated, cache.Replaced:
+		t.log.V(4).Info("update-status", "event-type", delta.Type, "object", client.ObjectKeyFromObject(delta.Object))
+		return c.Status().Update(ctx, delta.Object)
+	case cache.Deleted:
+		t.log.V(4).Info("delete-status", "event-type", delta.Type, "object", client.ObjectKeyFromObject(delta.Object))
+		unstructured.RemoveNestedField(delta.Object.UnstructuredContent(), "status")
+		if err := c.Status().Update(ctx, delta.Object); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	default:
+		t.log.V(2).Info("target: ignoring delta", "type", delta.Type)
+		return nil
+	}
+}
+
 func (t *target) patch(ctx context.Context, delta cache.Delta) error {
 	c := t.mgr.GetClient()
 
@@ -255,11 +431,6 @@ func (t *target) patch(ctx context.Context, delta cache.Delta) error {
 		t.log.V(4).Info("update-patch", "event-type", delta.Type,
 			"key", client.ObjectKeyFromObject(delta.Object).String())
 
-		patch, err := json.Marshal(object.DeepCopy(delta.Object).UnstructuredContent())
-		if err != nil {
-			return err
-		}
-
 		oldObj := object.New()
 		oldObj.SetGroupVersionKind(delta.Object.GroupVersionKind())
 		oldObj.SetName(delta.Object.GetName())
@@ -268,38 +439,134 @@ func (t *target) patch(ctx context.Context, delta cache.Delta) error {
 			return err
 		}
 
-		// TODO: strategic merge patch fails with error "unable to find api field in struct
-		// Unstructured for the json field \"metadata\""}"
-		// return c.Patch(ctx, result, client.RawPatch(types.StrategicMergePatchType, patch))
+		meta, err := t.patchMeta.Lookup(ctx, oldObj.GroupVersionKind())
+		if err != nil {
+			return err
+		}
+
+		// revert the fields set by the last patch that the new patch no longer sets
+		patches := t.lastPatches(oldObj)
+		last, _ := patches[t.fieldManager].(map[string]any)
+		dropped, err := object.DroppedPatchContent(last, patchContent(delta.Object), meta)
+		if err != nil {
+			return err
+		}
+		if dropped != nil {
+			if oldObj, err = t.revertPatch(ctx, oldObj, dropped, patches, meta); err != nil {
+				return err
+			}
+		}
+
+		// record the patch so that a later delete can revert it, marking the list elements the
+		// patch adds to the target and the values it overwrites
+		content, err := object.MarkPatch(oldObj, patchContent(delta.Object), last, meta)
+		if err != nil {
+			return err
+		}
+		patches[t.fieldManager] = content
+		obj := object.DeepCopy(delta.Object)
+		if err := t.setLastPatches(obj, patches); err != nil {
+			return err
+		}
+		// the patch is applied by the API server on native objects
+		obj.SetGroupVersionKind(oldObj.GroupVersionKind())
+
+		patch, err := json.Marshal(obj.UnstructuredContent())
+		if err != nil {
+			return err
+		}
 
-		// fall back to simple merge patches
-		return c.Patch(ctx, oldObj, client.RawPatch(types.MergePatchType, patch))
+		// the client merges lists using the patch metadata of the target resource
+		return t.patchObject(ctx, oldObj, client.RawPatch(types.StrategicMergePatchType, patch))
 
 	case cache.Deleted:
-		// apply the patch locally so that we fully control the behavior
-		patch := removeNested(delta.Object.UnstructuredContent())
-
-		// make sure we do not remove crucial metadata: the GVK and the namespace/name
+		key := client.ObjectKeyFromObject(delta.Object)
 		gvk := delta.Object.GroupVersionKind()
-		gr := schema.GroupVersion{Group: gvk.Group, Version: gvk.Version}
-		unstructured.SetNestedField(patch, gr.String(), "apiVersion")                            //nolint:errcheck
-		unstructured.SetNestedField(patch, gvk.Kind, "kind")                                     //nolint:errcheck
-		unstructured.SetNestedField(patch, delta.Object.GetNamespace(), "metadata", "namespace") //nolint:errcheck
-		unstructured.SetNestedField(patch, delta.Object.GetName(), "metadata", "name")           //nolint:errcheck
+		oldObj := object.New()
+		oldObj.SetGroupVersionKind(gvk)
+		if err := c.Get(ctx, key, oldObj); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
 
-		b, err := json.Marshal(patch)
+		// revert the last patch we recorded, or the delta object if there is none
+		patches := t.lastPatches(oldObj)
+		content, ok := patches[t.fieldManager].(map[string]any)
+		if !ok {
+			content = patchContent(delta.Object)
+		}
+		delete(patches, t.fieldManager)
+
+		meta, err := t.patchMeta.Lookup(ctx, gvk)
 		if err != nil {
 			return err
 		}
 
-		t.log.V(4).Info("delete-patch", "event-type", delta.Type,
-			"object", client.ObjectKeyFromObject(delta.Object),
-			"patch", util.Stringify(patch), "raw-patch", string(b))
+		t.log.V(4).Info("delete-patch", "event-type", delta.Type, "key", key.String(),
+			"patch", util.Stringify(content))
 
-		if err := c.Patch(context.Background(), delta.Object, client.RawPatch(types.StrategicMergePatchType, b)); err != nil {
-			if !apierrors.IsNotFound(err) {
-				return err
+		if _, err := t.revertPatch(ctx, oldObj, content, patches, meta); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+
+		return nil
+
+	default:
+		t.log.V(2).Info("target: ignoring delta", "type", delta.Type)
+
+		return nil
+	}
+}
+
+func (t *target) apply(ctx context.Context, delta cache.Delta) error {
+	c := t.mgr.GetClient()
+
+	//nolint:nolintlint
+	switch delta.Type { //nolint:exhaustive
+	case cache.Added, cache.Updated, cache.Replaced:
+		t.log.V(4).Info("apply", "event-type", delta.Type,
+			"key", client.ObjectKeyFromObject(delta.Object).String(), "field-manager", t.fieldManager)
+
+		// server-side apply rejects managed fields and a stale resource version would fail the
+		// apply, these may come from pipelines that copy the metadata of the source
+		delta.Object.SetManagedFields(nil)
+		delta.Object.SetResourceVersion("")
+
+		return c.Patch(ctx, delta.Object, client.Apply, client.FieldOwner(t.fieldManager),
+			client.ForceOwnership)
+
+	case cache.Deleted:
+		gvk := delta.Object.GroupVersionKind()
+		if gvk.Group == viewv1a1.GroupVersion.Group {
+			// views do not track field ownership: remove the fields of the delta object
+			return t.patch(ctx, delta)
+		}
+
+		// never create the object when releasing the fields
+		key := client.ObjectKeyFromObject(delta.Object)
+		oldObj := object.New()
+		oldObj.SetGroupVersionKind(gvk)
+		if err := c.Get(ctx, key, oldObj); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil
 			}
+			return err
+		}
+
+		// applying an object with no fields releases all the fields owned by the field manager
+		obj := object.New()
+		obj.SetGroupVersionKind(gvk)
+		obj.SetNamespace(delta.Object.GetNamespace())
+		obj.SetName(delta.Object.GetName())
+
+		t.log.V(4).Info("release-apply", "event-type", delta.Type, "key", key.String(),
+			"field-manager", t.fieldManager)
+
+		if err := c.Patch(ctx, obj, client.Apply, client.FieldOwner(t.fieldManager),
+			client.ForceOwnership); err != nil && !apierrors.IsNotFound(err) {
+			return err
 		}
 
 		return nil
@@ -311,17 +578,184 @@ func (t *target) patch(ctx context.Context, delta cache.Delta) error {
 	}
 }
 
-func removeNested(m map[string]any) map[string]any {
-	result := make(map[string]any)
-	for k, v := range m {
-		if nestedMap, ok := v.(map[string]any); ok {
-			result[k] = removeNested(nestedMap)
-		} else if nestedSlice, ok := v.([]any); ok {
-			// TODO: handle nested slices!!!!
-			result[k] = nestedSlice
+// resolveOwners fills in the UID of the owner references that do not specify one, e.g., the
+// explicit owner references set by the pipeline, using the owner object from the cache.
+func (t *target) resolveOwners(ctx context.Context, obj object.Object) error {
+	refs := obj.GetOwnerReferences()
+	changed := false
+	for i, ref := range refs {
+		if ref.UID != "" {
+			continue
+		}
+
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil {
+			return fmt.Errorf("invalid owner reference %s/%s: %w", ref.Kind, ref.Name, err)
+		}
+		gvk := gv.WithKind(ref.Kind)
+
+		// owners are either in the namespace of the object or cluster-scoped
+		namespace := obj.GetNamespace()
+		mapping, err := t.mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return fmt.Errorf("cannot find REST mapping for owner %s: %w", gvk.String(), err)
+		}
+		if mapping != nil && mapping.Scope.Name() == meta.RESTScopeNameRoot {
+			namespace = ""
+		}
+
+		owner := object.New()
+		owner.SetGroupVersionKind(gvk)
+		key := client.ObjectKey{Namespace: namespace, Name: ref.Name}
+		if err := t.mgr.GetClient().Get(ctx, key, owner); err != nil {
+			return fmt.Errorf("cannot get owner %s %s: %w", gvk.Kind, key.String(), err)
+		}
+
+		refs[i].UID = owner.GetUID()
+		changed = true
+	}
+
+	if changed {
+		obj.SetOwnerReferences(refs)
+	}
+
+	return nil
+}
+
+func (t *target) isStatus() bool { return t.target.Subresource == opv1a1.StatusSubresource }
+
+// patchObject patches the target object, or its status for status targets.
+func (t *target) patchObject(ctx context.Context, obj client.Object, patch client.Patch) error {
+	c := t.mgr.GetClient()
+	if t.isStatus() {
+		return c.Status().Patch(ctx, obj, patch)
+	}
+	return c.Patch(ctx, obj, patch)
+}
+
+// revertPatch reverts the patch content on the target object, records the given patches and
+// returns the updated object.
+func (t *target) revertPatch(ctx context.Context, oldObj object.Object, content, patches map[string]any, meta strategicpatch.LookupPatchMeta) (object.Object, error) {
+	newObj, err := object.RevertStrategicMergePatch(oldObj, &unstructured.Unstructured{Object: content}, meta)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.setLastPatches(newObj, patches); err != nil {
+		return nil, err
+	}
+
+	if oldObj.GroupVersionKind().Group == viewv1a1.GroupVersion.Group {
+		// views do not implement merge patches of lists
+		err = t.updateObject(ctx, newObj)
+	} else {
+		err = t.patchObject(ctx, newObj, client.MergeFrom(oldObj))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newObj, nil
+}
+
+// updateObject updates the target object, or its status for status targets.
+func (t *target) updateObject(ctx context.Context, obj client.Object) error {
+	c := t.mgr.GetClient()
+	if t.isStatus() {
+		return c.Status().Update(ctx, obj)
+	}
+	return c.Update(ctx, obj)
+}
+
+// lastPatches returns the patches recorded for a target object, keyed by field manager. Views
+// are not persisted and status writes cannot set annotations, so for these the patch is kept in
+// memory instead of an annotation.
+func (t *target) lastPatches(obj object.Object) map[string]any {
+	ret := map[string]any{}
+	if t.recordInMemory(obj) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if p, ok := t.localPatches[client.ObjectKeyFromObject(obj)]; ok {
+			ret[t.fieldManager] = p
+		}
+		return ret
+	}
+
+	v, ok := obj.GetAnnotations()[LastPatchAnnotation]
+	if !ok {
+		return ret
+	}
+	if err := json.Unmarshal([]byte(v), &ret); err != nil {
+		t.log.Info("ignoring invalid last-patch annotation", "key", client.ObjectKeyFromObject(obj).String(),
+			"error", err.Error())
+		return map[string]any{}
+	}
+	return ret
+}
+
+// setLastPatches records the patches for a target object, removing the annotation if there are
+// none.
+func (t *target) setLastPatches(obj object.Object, patches map[string]any) error {
+	if t.recordInMemory(obj) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		key := client.ObjectKeyFromObject(obj)
+		if p, ok := patches[t.fieldManager]; ok {
+			t.localPatches[key] = p
 		} else {
-			result[k] = nil
+			delete(t.localPatches, key)
+		}
+		return nil
+	}
+
+	anns := obj.GetAnnotations()
+	if len(patches) == 0 {
+		if _, ok := anns[LastPatchAnnotation]; ok {
+			delete(anns, LastPatchAnnotation)
+			obj.SetAnnotations(anns)
+		}
+		return nil
+	}
+
+	b, err := json.Marshal(patches)
+	if err != nil {
+		return err
+	}
+	if anns == nil {
+		anns = map[string]string{}
+	}
+	anns[LastPatchAnnotation] = string(b)
+	obj.SetAnnotations(anns)
+
+	return nil
+}
+
+func (t *target) recordInMemory(obj object.Object) bool {
+	return t.isStatus() || obj.GroupVersionKind().Group == viewv1a1.GroupVersion.Group
+}
+
+// patchContent returns the content of a delta object as recorded for reverting it later: the
+// identity of the object and all metadata except the labels and the annotations is removed.
+func patchContent(obj object.Object) map[string]any {
+	ret := object.DeepCopy(obj).UnstructuredContent()
+	delete(ret, "apiVersion")
+	delete(ret, "kind")
+
+	meta := map[string]any{}
+	if m, ok := ret["metadata"].(map[string]any); ok {
+		if labels, ok := m["labels"]; ok {
+			meta["labels"] = labels
+		}
+		if anns, ok := m["annotations"].(map[string]any); ok {
+			delete(anns, LastPatchAnnotation)
+			if len(anns) > 0 {
+				meta["annotations"] = anns
+			}
 		}
 	}
-	return result
+	delete(ret, "metadata")
+	if len(meta) > 0 {
+		ret["metadata"] = meta
+	}
+
+	return ret
 }
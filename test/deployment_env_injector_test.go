@@ -0,0 +1,162 @@
+package integration
+
+import (
+	"context"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/yaml"
+
+	"hsnlab/dcontroller/internal/testutils"
+	opv1a1 "hsnlab/dcontroller/pkg/api/operator/v1alpha1"
+	"hsnlab/dcontroller/pkg/object"
+	"hsnlab/dcontroller/pkg/operator"
+)
+
+const (
+	injectEnvAnnotationName = "dcontroller.io/inject-env"
+	injectorFieldManager    = "dcontroller-deployment-env-injector-deployment-env-injector"
+)
+
+var _ = Describe("Applier target test:", Ordered, func() {
+	// inject an env var into a container of the Deployments that have the inject-env annotation,
+	// using server-side apply so that the other containers and fields are kept intact
+	Context("When creating a Deployment env injector operator", Ordered, Label("operator"), func() {
+		var (
+			ctx    context.Context
+			cancel context.CancelFunc
+			op     opv1a1.Operator
+			dp     object.Object
+		)
+
+		getDeployment := func() (*appsv1.Deployment, error) {
+			dpget := &appsv1.Deployment{}
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(dp), dpget)
+			return dpget, err
+		}
+
+		// containerEnv returns the env of the test container, or nil if the Deployment is not
+		// in the expected shape: both containers present with their original images
+		containerEnv := func() []corev1.EnvVar {
+			dpget, err := getDeployment()
+			if err != nil {
+				return nil
+			}
+			cs := dpget.Spec.Template.Spec.Containers
+			if len(cs) != 2 || cs[0].Name != "test-container" || cs[0].Image != "nginx:latest" ||
+				cs[1].Name != "sidecar" || cs[1].Image != "busybox:latest" {
+				return nil
+			}
+			if cs[0].Env == nil {
+				return []corev1.EnvVar{}
+			}
+			return cs[0].Env
+		}
+
+		// the operator may update the Deployment concurrently: retry on conflict
+		setAnnotations := func(anns map[string]string) {
+			Eventually(func() error {
+				dpget, err := getDeployment()
+				if err != nil {
+					return err
+				}
+				dpget.SetAnnotations(anns)
+				return k8sClient.Update(ctx, dpget)
+			}, timeout, interval).Should(Succeed())
+		}
+
+		BeforeAll(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+
+			dp = testutils.TestDeployment.DeepCopy()
+			dp.SetName("test-deploy-injector")
+			dp.SetNamespace("default")
+			dp.SetAnnotations(map[string]string{injectEnvAnnotationName: "value1"})
+			Expect(unstructured.SetNestedSlice(dp.UnstructuredContent(), []any{
+				map[string]any{"name": "test-container", "image": "nginx:latest"},
+				map[string]any{"name": "sidecar", "image": "busybox:latest"},
+			}, "spec", "template", "spec", "containers")).To(Succeed())
+		})
+
+		AfterAll(func() {
+			cancel()
+		})
+
+		It("should create and start the operator controller", func() {
+			setupLog.Info("setting up operator controller")
+			c, err := operator.NewController(cfg, operator.ControllerOptions{Options: ctrl.Options{
+				Scheme:                 scheme,
+				LeaderElection:         false, // disable leader-election
+				HealthProbeBindAddress: "0",   // disable health-check
+				Metrics: metricsserver.Options{
+					BindAddress: "0", // disable the metrics server
+				},
+				Logger: logger,
+			}})
+			Expect(err).NotTo(HaveOccurred())
+
+			setupLog.Info("starting operator controller")
+			go func() {
+				defer GinkgoRecover()
+				err := c.Start(ctx)
+				Expect(err).ToNot(HaveOccurred(), "failed to run controller")
+			}()
+		})
+
+		It("should let an operator to be attached to the manager", func() {
+			yamlData, err := os.ReadFile("deployment_env_injector.yaml")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(yaml.Unmarshal(yamlData, &op)).NotTo(HaveOccurred())
+			Expect(k8sClient.Create(ctx, &op)).Should(Succeed())
+
+			Eventually(func() bool {
+				get := &opv1a1.Operator{}
+				return k8sClient.Get(ctx, client.ObjectKeyFromObject(&op), get) == nil
+			}, timeout, interval).Should(BeTrue())
+		})
+
+		It("should merge the env into the container list", func() {
+			Expect(k8sClient.Create(ctx, dp)).Should(Succeed())
+
+			Eventually(containerEnv, timeout, interval).Should(Equal([]corev1.EnvVar{
+				{Name: "INJECTED", Value: "value1"},
+			}))
+
+			dpget, err := getDeployment()
+			Expect(err).NotTo(HaveOccurred())
+			managers := []string{}
+			for _, mf := range dpget.GetManagedFields() {
+				managers = append(managers, mf.Manager)
+			}
+			Expect(managers).To(ContainElement(injectorFieldManager))
+		})
+
+		It("should update the env when the annotation changes", func() {
+			setAnnotations(map[string]string{injectEnvAnnotationName: "value2"})
+
+			Eventually(containerEnv, timeout, interval).Should(Equal([]corev1.EnvVar{
+				{Name: "INJECTED", Value: "value2"},
+			}))
+		})
+
+		It("should release the env when the annotation is removed", func() {
+			setAnnotations(nil)
+
+			Eventually(containerEnv, timeout, interval).Should(Equal([]corev1.EnvVar{}))
+			Consistently(containerEnv, timeout/5, interval).Should(Equal([]corev1.EnvVar{}))
+		})
+
+		It("should delete the objects added", func() {
+			Expect(k8sClient.Delete(ctx, dp)).Should(Succeed())
+			Expect(k8sClient.Delete(ctx, &op)).Should(Succeed())
+		})
+	})
+})
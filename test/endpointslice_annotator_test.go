@@ -71,7 +71,7 @@ var _ = Describe("EndpointSlice annotator operator test:", Ordered, func() {
 
 		It("should create and start the operator controller", func() {
 			setupLog.Info("setting up operator controller")
-			c, err := operator.NewController(cfg, ctrl.Options{
+			c, err := operator.NewController(cfg, operator.ControllerOptions{Options: ctrl.Options{
 				Scheme:                 scheme,
 				LeaderElection:         false, // disable leader-election
 				HealthProbeBindAddress: "0",   // disable health-check
@@ -79,7 +79,7 @@ var _ = Describe("EndpointSlice annotator operator test:", Ordered, func() {
 					BindAddress: "0", // disable the metrics server
 				},
 				Logger: logger,
-			})
+			}})
 			Expect(err).NotTo(HaveOccurred())
 
 			setupLog.Info("starting operator controller")
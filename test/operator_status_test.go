@@ -39,7 +39,7 @@ var _ = Describe("Operator status report test:", Ordered, func() {
 
 		It("should create and start the operator controller", func() {
 			setupLog.Info("setting up operator controller")
-			c, err := operator.NewController(cfg, ctrl.Options{
+			c, err := operator.NewController(cfg, operator.ControllerOptions{Options: ctrl.Options{
 				Scheme:                 scheme,
 				LeaderElection:         false, // disable leader-election
 				HealthProbeBindAddress: "0",   // disable health-check
@@ -47,7 +47,7 @@ var _ = Describe("Operator status report test:", Ordered, func() {
 					BindAddress: "0", // disable the metrics server
 				},
 				Logger: logger,
-			})
+			}})
 			Expect(err).NotTo(HaveOccurred())
 
 			setupLog.Info("starting operator controller")
@@ -135,7 +135,7 @@ spec:
 
 		It("should create and start the operator controller", func() {
 			setupLog.Info("setting up operator controller")
-			c, err := operator.NewController(cfg, ctrl.Options{
+			c, err := operator.NewController(cfg, operator.ControllerOptions{Options: ctrl.Options{
 				Scheme:                 scheme,
 				LeaderElection:         false, // disable leader-election
 				HealthProbeBindAddress: "0",   // disable health-check
@@ -143,7 +143,7 @@ spec:
 					BindAddress: "0", // disable the metrics server
 				},
 				Logger: logger,
-			})
+			}})
 			Expect(err).NotTo(HaveOccurred())
 
 			setupLog.Info("starting operator controller")